@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+)
+
+// AggregateConfig defines a value computed across items each poll round and
+// published to aggregates/{name}.
+type AggregateConfig struct {
+	Name string `toml:"name"`
+	// Op is one of sum, avg, min or max
+	Op string `toml:"op"`
+	// Sources are "category/field" (the field of every item of the category)
+	// or "category/item/field" entries.
+	Sources []string `toml:"sources"`
+}
+
+// validate checks name, operation and source syntax of an aggregate.
+func (a AggregateConfig) validate() error {
+	if a.Name == "" || strings.ContainsAny(a.Name, "/+#") {
+		return fmt.Errorf("aggregates: invalid name %q", a.Name)
+	}
+	switch a.Op {
+	case "sum", "avg", "min", "max":
+	default:
+		return fmt.Errorf("aggregates.%s: unsupported op %q", a.Name, a.Op)
+	}
+	if len(a.Sources) == 0 {
+		return fmt.Errorf("aggregates.%s: at least one source is required", a.Name)
+	}
+	for _, source := range a.Sources {
+		parts := strings.Split(source, "/")
+		if (len(parts) != 2 && len(parts) != 3) || slices.Contains(parts, "") {
+			return fmt.Errorf("aggregates.%s: invalid source %q (use category/field or category/item/field)", a.Name, source)
+		}
+	}
+	return nil
+}
+
+// aggregateValues collects the last known numeric values of the given sources.
+// Missing sources and non-numeric values are skipped.
+func (b *Bridge) aggregateValues(sources []string) []float64 {
+	b.historyMu.RLock()
+	defer b.historyMu.RUnlock()
+
+	var values []float64
+	add := func(value any) {
+		switch v := value.(type) {
+		case int64:
+			values = append(values, float64(v))
+		case float64:
+			values = append(values, v)
+		}
+	}
+
+	for _, source := range sources {
+		parts := strings.Split(source, "/")
+		if len(parts) == 3 {
+			if entry, ok := b.history[source]; ok {
+				add(entry.value)
+			}
+			continue
+		}
+		// category/field: every item of the category
+		prefix, suffix := parts[0]+"/", "/"+parts[1]
+		for key, entry := range b.history {
+			if strings.HasPrefix(key, prefix) && strings.HasSuffix(key, suffix) && strings.Count(key, "/") == 2 {
+				add(entry.value)
+			}
+		}
+	}
+	return values
+}
+
+// computeAggregate applies op to values. ok is false if there are no values.
+func computeAggregate(op string, values []float64) (result float64, ok bool) {
+	if len(values) == 0 {
+		return 0, false
+	}
+	switch op {
+	case "sum", "avg":
+		for _, v := range values {
+			result += v
+		}
+		if op == "avg" {
+			result /= float64(len(values))
+		}
+	case "min":
+		result = math.Inf(1)
+		for _, v := range values {
+			result = min(result, v)
+		}
+	case "max":
+		result = math.Inf(-1)
+		for _, v := range values {
+			result = max(result, v)
+		}
+	}
+	return result, true
+}
+
+// publishAggregates computes and publishes all configured aggregates. An
+// aggregate without any known source value is not published.
+func (b *Bridge) publishAggregates() {
+	for _, a := range b.cfg.Aggregates {
+		result, ok := computeAggregate(a.Op, b.aggregateValues(a.Sources))
+		if !ok {
+			slog.Debug("No values for aggregate", "name", a.Name)
+			continue
+		}
+		if err := b.publish("aggregates/"+a.Name, result); err != nil {
+			slog.Error("Failed to publish aggregate", "name", a.Name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+func newAggregateBridge(t *testing.T, aggregates []AggregateConfig) (*Bridge, *MockMQTT) {
+	t.Helper()
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{
+		"energycosts": {{Name: "actPower", Type: "float"}, {Name: "name", Type: "string"}},
+		"roomtemps":   {{Name: "temperature", Type: "float"}, {Name: "mode", Type: "int"}},
+	}
+	bridge, err := NewBridge(&Config{Aggregates: aggregates}, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return bridge, mockMQTT
+}
+
+func lastPublished(m *MockMQTT, topic string) (any, bool) {
+	for i := len(m.published) - 1; i >= 0; i-- {
+		if m.published[i].Topic == topic {
+			return m.published[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+func TestPublishAggregates_Sum(t *testing.T) {
+	bridge, mockMQTT := newAggregateBridge(t, []AggregateConfig{
+		{Name: "total_power", Op: "sum", Sources: []string{"energycosts/actPower"}},
+	})
+
+	bridge.processItem("energycosts", "item0", map[string]any{"value": "1.5;PV"})
+	bridge.processItem("energycosts", "item1", map[string]any{"value": "2.25;Grid"})
+	bridge.processItem("roomtemps", "item0", map[string]any{"value": "100;1"})
+	bridge.publishAggregates()
+
+	value, ok := lastPublished(mockMQTT, "aggregates/total_power")
+	if !ok {
+		t.Fatal("expected aggregates/total_power to be published")
+	}
+	if value != 3.75 {
+		t.Errorf("expected sum 3.75, got %v", value)
+	}
+}
+
+func TestPublishAggregates_AvgSkipsMissingSources(t *testing.T) {
+	bridge, mockMQTT := newAggregateBridge(t, []AggregateConfig{
+		{Name: "avg_temperature", Op: "avg", Sources: []string{
+			"roomtemps/item0/temperature",
+			"roomtemps/item1/temperature",
+			"roomtemps/item9/temperature", // never reported
+		}},
+		{Name: "unknown", Op: "max", Sources: []string{"meteo/temperature"}},
+	})
+
+	bridge.processItem("roomtemps", "item0", map[string]any{"value": "21.0;1"})
+	bridge.processItem("roomtemps", "item1", map[string]any{"value": "22.0;1"})
+	bridge.publishAggregates()
+
+	value, ok := lastPublished(mockMQTT, "aggregates/avg_temperature")
+	if !ok {
+		t.Fatal("expected aggregates/avg_temperature to be published")
+	}
+	if value != 21.5 {
+		t.Errorf("expected avg 21.5, got %v", value)
+	}
+	if _, ok := lastPublished(mockMQTT, "aggregates/unknown"); ok {
+		t.Error("expected aggregate without values not to be published")
+	}
+}
+
+func TestAggregateConfig_Validate(t *testing.T) {
+	cases := map[string]AggregateConfig{
+		"no name":       {Op: "sum", Sources: []string{"a/b"}},
+		"bad op":        {Name: "x", Op: "median", Sources: []string{"a/b"}},
+		"no sources":    {Name: "x", Op: "sum"},
+		"bad source":    {Name: "x", Op: "sum", Sources: []string{"a"}},
+		"empty part":    {Name: "x", Op: "sum", Sources: []string{"a//b"}},
+		"wildcard name": {Name: "x/#", Op: "sum", Sources: []string{"a/b"}},
+	}
+	for name, a := range cases {
+		if err := a.validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if err := (AggregateConfig{Name: "x", Op: "min", Sources: []string{"a/b", "a/item0/b"}}).validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+)
+
+// publishAlarms fetches the alarm list (alarms_endpoint) and publishes the
+// active alarms as a JSON array to alarms and their number to alarms/count.
+// Both are only published when the active alarms change.
+func (b *Bridge) publishAlarms() {
+	endpoint := b.cfg.MyGekko.AlarmsEndpoint
+	if endpoint == "" {
+		return
+	}
+	raw, err := b.gekko.GetAlarms(b.ctx, endpoint)
+	if err != nil {
+		if b.ctx.Err() == nil {
+			b.failures.Add(1)
+			slog.Error("Failed to fetch alarms", "endpoint", endpoint, "error", err)
+		}
+		return
+	}
+
+	alarms := activeAlarms(raw)
+	key := fmt.Sprint(alarms)
+	if b.alarmsPublished && key == b.lastAlarms || b.quietStart {
+		return
+	}
+	if err := b.publishJSON("alarms", alarms); err != nil {
+		slog.Error("Failed to publish", "topic", "alarms", "error", err)
+		return
+	}
+	b.lastAlarms, b.alarmsPublished = key, true
+	if err := b.publish("alarms/count", len(alarms)); err != nil {
+		slog.Error("Failed to publish", "topic", "alarms/count", "error", err)
+	}
+}
+
+// activeAlarms returns the active alarms of an alarm list. The list is an
+// array of alarm objects or an object of them keyed by id, which is added to
+// each as "id". An alarm is active unless its "active" or "state" key says
+// otherwise (false or 0).
+func activeAlarms(raw any) []map[string]any {
+	var entries []map[string]any
+	switch list := raw.(type) {
+	case []any:
+		for _, entry := range list {
+			if alarm, ok := entry.(map[string]any); ok {
+				entries = append(entries, alarm)
+			}
+		}
+	case map[string]any:
+		for _, id := range slices.Sorted(maps.Keys(list)) {
+			alarm, ok := list[id].(map[string]any)
+			if !ok {
+				continue
+			}
+			alarm = maps.Clone(alarm)
+			if _, ok := alarm["id"]; !ok {
+				alarm["id"] = id
+			}
+			entries = append(entries, alarm)
+		}
+	}
+
+	active := []map[string]any{}
+	for _, alarm := range entries {
+		if alarmActive(alarm) {
+			active = append(active, alarm)
+		}
+	}
+	return active
+}
+
+func alarmActive(alarm map[string]any) bool {
+	for _, key := range []string{"active", "state"} {
+		switch v := alarm[key].(type) {
+		case bool:
+			return v
+		case float64:
+			return v != 0
+		case string:
+			return v != "" && v != "0" && v != "false"
+		}
+	}
+	return true
+}
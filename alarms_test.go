@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPublishAlarms(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{AlarmsEndpoint: "var/globals/alarm/status"}}
+	mockGekko := NewMockGekko("TestGekko")
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, map[string][]FieldDef{}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	mockGekko.alarms = map[string]any{
+		"alarm1": map[string]any{"text": "Water leak", "state": 1.0},
+		"alarm0": map[string]any{"text": "Window open", "state": 0.0},
+		"alarm2": map[string]any{"text": "Frost", "active": true},
+	}
+	bridge.publishAlarms()
+	if len(mockMQTT.jsonPublished) != 1 {
+		t.Fatalf("expected the alarms published, got %v", mockMQTT.jsonPublished)
+	}
+	alarms := mockMQTT.jsonPublished[0].Data.([]map[string]any)
+	if len(alarms) != 2 || alarms[0]["id"] != "alarm1" || alarms[1]["text"] != "Frost" {
+		t.Errorf("expected the active alarms alarm1 and alarm2, got %v", alarms)
+	}
+	if got, _ := lastPublished(mockMQTT, "alarms/count"); got != 2 {
+		t.Errorf("expected count 2, got %v", got)
+	}
+
+	// Unchanged alarms and a failed fetch publish nothing
+	bridge.publishAlarms()
+	mockGekko.alarmsErr = errors.New("not found")
+	bridge.publishAlarms()
+	if len(mockMQTT.jsonPublished) != 1 {
+		t.Errorf("expected no further publish, got %d", len(mockMQTT.jsonPublished))
+	}
+
+	// An array, with every alarm inactive
+	mockGekko.alarmsErr = nil
+	mockGekko.alarms = []any{map[string]any{"text": "Water leak", "state": "0"}}
+	bridge.publishAlarms()
+	if alarms := mockMQTT.jsonPublished[1].Data.([]map[string]any); len(alarms) != 0 {
+		t.Errorf("expected no active alarms, got %v", alarms)
+	}
+	if got, _ := lastPublished(mockMQTT, "alarms/count"); got != 0 {
+		t.Errorf("expected count 0, got %v", got)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ServeAPI serves the read-only state API (api_addr) on ln until the bridge
+// is stopped. The listener is opened before the sandbox, so a privileged
+// port works too.
+func (b *Bridge) ServeAPI(ln net.Listener) {
+	srv := &http.Server{
+		Handler:           b.apiHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-b.ctx.Done()
+		srv.Close()
+	}()
+
+	slog.Info("Serving state API", "addr", ln.Addr())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		b.failures.Add(1)
+		slog.Error("State API failed", "error", err)
+	}
+}
+
+// apiHandler returns the handler of the state API:
+//
+//	GET /state             last published value of every field
+//	GET /state/{category}  the same, for one category
+//
+// Both answer with a JSON object keyed by category/item/field.
+func (b *Bridge) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /state", func(w http.ResponseWriter, r *http.Request) {
+		writeState(w, b.state(""))
+	})
+	mux.HandleFunc("GET /state/{category...}", func(w http.ResponseWriter, r *http.Request) {
+		category := r.PathValue("category")
+		if _, ok := b.fieldDefs()[category]; !ok {
+			http.Error(w, "unknown category", http.StatusNotFound)
+			return
+		}
+		writeState(w, b.state(category))
+	})
+	return mux
+}
+
+// state returns a snapshot of the history values, of all categories or only
+// of the given one.
+func (b *Bridge) state(category string) map[string]any {
+	b.historyMu.RLock()
+	defer b.historyMu.RUnlock()
+
+	state := make(map[string]any)
+	for histKey, entry := range b.history {
+		if category != "" && !strings.HasPrefix(histKey, category+"/") {
+			continue
+		}
+		state[histKey] = entry.value
+	}
+	return state
+}
+
+func writeState(w http.ResponseWriter, state map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		slog.Debug("Failed to write state", "error", err)
+	}
+}
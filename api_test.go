@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIHandler_State(t *testing.T) {
+	fieldDefs := map[string][]FieldDef{
+		"blinds":    {{Name: "position", Type: "int"}},
+		"lights":    {{Name: "state", Type: "int"}},
+		"roomtemps": {{Name: "temperature", Type: "float"}},
+	}
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), NewMockMQTT(), fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+	bridge.recordValue("blinds", "item0", "position", 50)
+	bridge.recordValue("lights", "item1", "state", 1)
+	handler := bridge.apiHandler()
+
+	for _, tc := range []struct {
+		path string
+		code int
+		want map[string]any
+	}{
+		{"/state", http.StatusOK, map[string]any{"blinds/item0/position": 50.0, "lights/item1/state": 1.0}},
+		{"/state/blinds", http.StatusOK, map[string]any{"blinds/item0/position": 50.0}},
+		{"/state/roomtemps", http.StatusOK, map[string]any{}},
+		{"/state/unknown", http.StatusNotFound, nil},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d", tc.path, tc.code, rec.Code)
+			continue
+		}
+		if tc.want == nil {
+			continue
+		}
+		var got map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: invalid JSON %q: %v", tc.path, rec.Body.String(), err)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.path, tc.want, got)
+		}
+		for key, value := range tc.want {
+			if got[key] != value {
+				t.Errorf("%s: expected %s = %v, got %v", tc.path, key, value, got[key])
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/state", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected POST to be rejected, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// breaker is the circuit breaker around the status requests of the getter.
+// After breaker_threshold consecutive failed requests it opens: the regular
+// polls are skipped and the controller is only probed every
+// breaker_probe_interval until it answers again. Owned by the getter.
+type breaker struct {
+	threshold int
+	failures  int
+	open      bool
+	// announced is set once the controller state was published
+	announced bool
+}
+
+// recordFetch updates the circuit breaker after a status request; err is
+// the final error after all retries, nil on success. Opening and closing the
+// circuit is published, retained, to controller/{will_topic}.
+func (b *Bridge) recordFetch(err error) {
+	br := &b.breaker
+	if br.threshold <= 0 || b.ctx.Err() != nil {
+		return
+	}
+	if err == nil {
+		if br.open {
+			slog.Info("MyGEKKO reachable again, closing circuit", "failures", br.failures)
+		}
+		if br.open || !br.announced {
+			b.publishRunning("controller", true)
+		}
+		br.failures, br.open, br.announced = 0, false, true
+		return
+	}
+
+	br.failures++
+	if !br.open && br.failures >= br.threshold {
+		slog.Warn("MyGEKKO unreachable, opening circuit", "failures", br.failures,
+			"probe_interval", time.Duration(b.cfg.MyGekko.BreakerProbeInterval*float64(time.Second)))
+		br.open, br.announced = true, true
+		b.publishRunning("controller", false)
+	}
+}
+
+// probe sends a single status request while the circuit is open and
+// reports whether the controller answered, closing the circuit.
+func (b *Bridge) probe(categories []string) bool {
+	if len(categories) > 1 {
+		categories = categories[:1]
+	}
+	slog.Debug("Probing MyGEKKO", "categories", categories)
+	_, err := b.gekko.GetStatus(b.ctx, categories)
+	b.recordFetch(err)
+	return err == nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestBreaker_OpensAndCloses(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{BreakerThreshold: 2, BreakerProbeInterval: 60},
+		MQTT:    MQTTConfig{WillTopic: "online", WillOnline: "true", WillOffline: "false"},
+	}
+	gekko := NewMockGekko("TestGekko")
+	var requests int
+	var down bool
+	gekko.getStatus = func(categories []string) (map[string]any, error) {
+		requests++
+		if down {
+			return nil, errors.New("connection refused")
+		}
+		return map[string]any{}, nil
+	}
+	bridge, err := NewBridge(cfg, gekko, newTestMQTTClient(paho), map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+		"lights": {{Name: "state", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+	categories := []string{"blinds", "lights"}
+	controllerStates := func() []string {
+		var states []string
+		for _, msg := range paho.published {
+			if msg.Topic == "test/TestGekko/controller/online" {
+				states = append(states, string(msg.Value.([]byte)))
+			}
+		}
+		return states
+	}
+
+	bridge.pollRound(categories)
+	if want := []string{"true"}; !slices.Equal(controllerStates(), want) {
+		t.Fatalf("expected %v after the first successful poll, got %v", want, controllerStates())
+	}
+
+	// The second failure opens the circuit and skips the rest of the round
+	down = true
+	requests = 0
+	bridge.pollRound([]string{"blinds"})
+	if bridge.breaker.open {
+		t.Fatal("expected the circuit to stay closed below the threshold")
+	}
+	bridge.pollRound(categories)
+	if !bridge.breaker.open || requests != 2 {
+		t.Fatalf("expected the circuit open after 2 requests, got open=%v after %d", bridge.breaker.open, requests)
+	}
+	bridge.pollRound(categories)
+	if requests != 2 {
+		t.Errorf("expected no polls while open, got %d requests", requests)
+	}
+
+	if bridge.probe(categories) || requests != 3 {
+		t.Errorf("expected a single failing probe request, got %d requests", requests)
+	}
+	down = false
+	if !bridge.probe(categories) || bridge.breaker.open {
+		t.Error("expected a successful probe to close the circuit")
+	}
+	if want := []string{"true", "false", "true"}; !slices.Equal(controllerStates(), want) {
+		t.Errorf("expected controller states %v, got %v", want, controllerStates())
+	}
+}
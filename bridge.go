@@ -2,34 +2,78 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
-	"os"
+	"maps"
+	"math"
+	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // FieldDef defines a field name and its type for parsing status values
 type FieldDef struct {
 	Name string
-	Type string // "int", "float", "string", or "" to skip
+	Type string // "int", "float", "string", "bool", "color", or "" to skip
+	// EnumValues are the labels of an enum field, indexed by value
+	EnumValues []string
+	// Min and Max bound a numeric field if HasRange ("float[0.0:100.0]")
+	Min, Max float64
+	HasRange bool
+	// Allowed lists the permitted values of a numeric field ("int[0,1,2]")
+	Allowed []string
+	// Unit is the engineering unit or suffix after the bracket
+	// ("float[...](unit:°C)" -> "°C"), empty if there is none
+	Unit string
+}
+
+// ItemInfo is the descriptive metadata of an item from the definitions: its
+// display name and the page (room) it is placed on, if any.
+type ItemInfo struct {
+	Name string `json:"name,omitempty"`
+	Page string `json:"page,omitempty"`
 }
 
 // MQTTPublisher defines the interface for MQTT operations
 type MQTTPublisher interface {
 	Publish(topic string, value any) error
 	PublishJSON(topic string, data any) error
+	// PublishTransient publishes a JSON document that is never retained,
+	// e.g. the result of a command, so a new subscriber does not receive
+	// stale ones.
+	PublishTransient(topic string, data any) error
+	// Subscribe subscribes to a topic below the root; the handler receives
+	// the topic of a message relative to the root as well.
 	Subscribe(topic string, handler func(topic string, payload []byte)) error
+	Unsubscribe(topic string) error
+}
+
+// skipError is returned for items the getter cannot process and skips; it
+// holds the reason.
+type skipError string
+
+func (e skipError) Error() string { return string(e) }
+
+// statsReporter is implemented by MQTT clients that can report connection
+// statistics (see MQTTClient.Stats)
+type statsReporter interface {
+	Stats() MQTTStats
 }
 
 // GekkoClient defines the interface for MyGEKKO API operations
 type GekkoClient interface {
-	GetStatus(categories []string) (map[string]any, error)
-	SetValue(category, item, value string) error
+	GetStatus(ctx context.Context, categories []string) (map[string]any, error)
+	SetValue(ctx context.Context, category, item, value string) error
+	SendCommand(ctx context.Context, category, item, command, value string) error
 	GetGekkoName() (string, error)
-	GetDefinitions() (map[string]any, error)
+	GetDefinitions(ctx context.Context) (map[string]any, error)
+	GetAlarms(ctx context.Context, endpoint string) (any, error)
+	GetGlobal(ctx context.Context, path string) (map[string]any, error)
 }
 
 type Bridge struct {
@@ -37,11 +81,104 @@ type Bridge struct {
 	gekko     GekkoClient
 	mqtt      MQTTPublisher
 	fieldDef  map[string][]FieldDef
+	defsMu    sync.RWMutex // guards fieldDef and itemInfo, replaced on refresh
 	gekkoName string
-	history   map[string]any
+	history   map[string]historyEntry
+	historyMu sync.RWMutex // guards history, read by the setter
 	ctx       context.Context
 	cancel    context.CancelFunc
 
+	// pollCh requests an immediate poll of a category, or of all polled
+	// categories for "" (bridge/poll)
+	pollCh chan string
+	// reloadCh hands reloaded poll settings to the getter (Reload)
+	reloadCh chan pollSettings
+
+	// republishInterval forces unchanged values to be published again
+	// (republish_interval, 0 disables)
+	republishInterval time.Duration
+	// historyTTL evicts history entries not polled for this long
+	// (history_ttl, 0 disables)
+	historyTTL time.Duration
+	// setDebounce collapses the set commands of an item within this window
+	// into the last one (set_debounce, 0 disables); debounced holds the
+	// pending command per category/item.
+	setDebounce time.Duration
+	debounceMu  sync.Mutex
+	debounced   map[string]pendingSet
+	// subscribed lists the topics subscribed with subscribe, for Stop
+	subsMu     sync.Mutex
+	subscribed []string
+	// wg tracks the goroutines started with Go, for Stop
+	wg sync.WaitGroup
+	// quietStart makes the initial poll of the getter fill the history
+	// without publishing values (suppress_initial_publish); the getter
+	// clears it once that poll is done.
+	quietStart bool
+	// breaker stops the polls while the controller is unreachable
+	// (breaker_threshold)
+	breaker breaker
+
+	// lastAlarms holds the active alarms last published (alarms_endpoint),
+	// to publish them only on change. Owned by the getter.
+	lastAlarms      string
+	alarmsPublished bool
+	// lastPoll is the time of the last successful category poll, for
+	// bridge/last_poll. Owned by the getter.
+	lastPoll time.Time
+
+	// transformers decode fields before the default type conversion, see
+	// RegisterTransformer
+	transformers []Transformer
+
+	// clock returns the current time for timestamps, the history and the
+	// health of the categories (time.Now, replaced in tests)
+	clock func() time.Time
+
+	// Run counters for the shutdown summary
+	started     time.Time
+	polls       atomic.Uint64
+	publishes   atomic.Uint64
+	setCommands atomic.Uint64
+	failures    atomic.Uint64
+
+	// staleAfter is stale_after (0 disables); stale holds the published
+	// stale state per item ("category/item"). Owned by the getter.
+	staleAfter time.Duration
+	stale      map[string]bool
+
+	// errorTopics holds the error topics set by reportError, to clear them
+	// on the next success (publish_errors); used by getter and setter.
+	errorsMu    sync.Mutex
+	errorTopics map[string]bool
+
+	// pollFailures tracks the failing poll groups by their categories, for
+	// throttling the error log (error_log_interval). Owned by the getter.
+	pollFailures     map[string]*pollFailure
+	errorLogInterval time.Duration
+
+	// absences counts consecutive polls an item ("category/item") was missing
+	// from its category's response, for removing items that disappeared.
+	absences map[string]int
+	// health tracks per category the last successful poll and the failures
+	// since then; LogStats reads it from the signal handler, hence the lock.
+	healthMu sync.Mutex
+	health   map[string]*categoryHealth
+	// indexed holds per category the items of the last published index, to
+	// publish it only when they change; cleared when the definitions are
+	// refreshed.
+	indexed map[string]string
+	// skippedReported records the categories whose skipped items were
+	// already published (publish_skipped).
+	skippedReported map[string]bool
+	// itemInfo holds name and page per category and item (SetItemInfo);
+	// slugs are the topic segments of the items for item_names
+	itemInfo map[string]map[string]ItemInfo
+	slugs    map[string]map[string]string
+	// loadDefinitions reloads fieldDef and itemInfo from the controller for
+	// definitions_refresh_interval (SetDefinitionsLoader)
+	loadDefinitions definitionsLoader
+
 	// Incoming set commands are queued here so the MQTT receive loop never
 	// blocks on the (synchronous, potentially slow) MyGEKKO HTTP call. A
 	// single worker drains the queues, which serializes commands and spaces
@@ -57,63 +194,296 @@ type Bridge struct {
 	throttlePrefixes map[string][]string // category -> payload prefixes that are throttled
 }
 
+// historyEntry is the last published value of a field
+type historyEntry struct {
+	value     any
+	unchanged int       // consecutive polls that returned the same value
+	published time.Time // last time the value was published
+	seen      time.Time // last time the value was polled
+	changed   time.Time // last time the value changed
+}
+
+// categoryHealth is the poll state of a category
+type categoryHealth struct {
+	lastSuccess time.Time
+	failures    int // consecutive failed polls
+}
+
 type setCommand struct {
 	topic   string
 	payload []byte
+	// command is the scmd verb of a cmd/{verb} topic, empty for set
+	command string
+	// global is the path of a writable global, set by globals/{path}/set
+	global string
 }
 
 func NewBridge(cfg *Config, gekko GekkoClient, mqtt MQTTPublisher, fieldDefinitions map[string][]FieldDef, gekkoName string) (*Bridge, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	history := make(map[string]historyEntry)
+	if cfg.MyGekko.HistoryFile != "" {
+		history = loadHistory(cfg.MyGekko.HistoryFile)
+	}
+
 	return &Bridge{
-		cfg:              cfg,
-		gekko:            gekko,
-		mqtt:             mqtt,
-		fieldDef:         fieldDefinitions,
-		gekkoName:        gekkoName,
-		history:          make(map[string]any),
-		ctx:              ctx,
-		cancel:           cancel,
-		cmdQueue:         make(chan setCommand, 256),
-		immediateQueue:   make(chan setCommand, 64),
-		cmdInterval:      time.Duration(cfg.MyGekko.CommandInterval * float64(time.Second)),
-		throttlePrefixes: cfg.MyGekko.ThrottlePrefixes,
+		cfg:               cfg,
+		gekko:             gekko,
+		mqtt:              mqtt,
+		fieldDef:          fieldDefinitions,
+		gekkoName:         gekkoName,
+		history:           history,
+		absences:          make(map[string]int),
+		stale:             make(map[string]bool),
+		pollFailures:      make(map[string]*pollFailure),
+		errorLogInterval:  time.Duration(cfg.MyGekko.ErrorLogInterval * float64(time.Second)),
+		errorTopics:       make(map[string]bool),
+		health:            make(map[string]*categoryHealth),
+		indexed:           make(map[string]string),
+		skippedReported:   make(map[string]bool),
+		started:           time.Now(),
+		clock:             time.Now,
+		transformers:      slices.Clone(transformers),
+		ctx:               ctx,
+		cancel:            cancel,
+		cmdQueue:          make(chan setCommand, 256),
+		immediateQueue:    make(chan setCommand, 64),
+		reloadCh:          make(chan pollSettings, 1),
+		pollCh:            make(chan string, 16),
+		cmdInterval:       time.Duration(cfg.MyGekko.CommandInterval * float64(time.Second)),
+		republishInterval: time.Duration(cfg.MyGekko.RepublishInterval * float64(time.Second)),
+		historyTTL:        time.Duration(cfg.MyGekko.HistoryTTL * float64(time.Second)),
+		staleAfter:        time.Duration(cfg.MyGekko.StaleAfter * float64(time.Second)),
+		quietStart:        cfg.MyGekko.SuppressInitialPublish,
+		setDebounce:       time.Duration(cfg.MyGekko.SetDebounce * float64(time.Second)),
+		throttlePrefixes:  cfg.MyGekko.ThrottlePrefixes,
+		breaker:           breaker{threshold: cfg.MyGekko.BreakerThreshold},
 	}, nil
 }
 
+// publishRunning publishes whether a bridge loop ("getter" or "setter") runs,
+// retained, to {loop}/{will_topic} with the will_online/will_offline payloads,
+// next to the availability topic of the whole bridge.
+func (b *Bridge) publishRunning(loop string, running bool) {
+	pub, ok := b.mqtt.(rawPublisher)
+	if !ok {
+		return
+	}
+	payload := b.cfg.MQTT.WillOffline
+	if running {
+		payload = b.cfg.MQTT.WillOnline
+	}
+	topic := pub.Topic(loop + "/" + b.cfg.MQTT.WillTopic)
+	if err := pub.PublishRaw(topic, []byte(payload)); err != nil {
+		b.failures.Add(1)
+		slog.Error("Failed to publish loop state", "topic", topic, "error", err)
+		return
+	}
+	b.publishes.Add(1)
+}
+
+// Go runs fn in a goroutine that Stop waits for, e.g. RunGetter.
+func (b *Bridge) Go(fn func()) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn()
+	}()
+}
+
+// Stop stops the bridge: it cancels the running polls and commands, waits up
+// to shutdown_timeout for the goroutines started with Go to finish, and then
+// publishes that the getter and setter are offline.
 func (b *Bridge) Stop() {
 	b.cancel()
+	if timeout := time.Duration(b.cfg.MyGekko.ShutdownTimeout * float64(time.Second)); timeout > 0 {
+		done := make(chan struct{})
+		go func() {
+			b.wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			slog.Warn("Shutdown timed out, stopping anyway", "timeout", timeout)
+		}
+	}
+	b.unsubscribeAll()
+	b.publishRunning("getter", false)
+	if !b.cfg.MyGekko.ReadOnly {
+		b.publishRunning("setter", false)
+	}
+	if err := b.SaveHistory(); err != nil {
+		b.failures.Add(1)
+		slog.Error("Failed to save history", "error", err)
+	}
+	b.LogStats("Bridge summary")
+}
+
+// publishTelemetry publishes the uptime in seconds, the number of successful
+// category polls and the time of the last one to bridge/uptime,
+// bridge/poll_count and bridge/last_poll, for monitoring with MQTT only.
+func (b *Bridge) publishTelemetry() {
+	values := map[string]any{
+		"bridge/uptime":     int64(time.Since(b.started).Seconds()),
+		"bridge/poll_count": b.polls.Load(),
+	}
+	if !b.lastPoll.IsZero() {
+		values["bridge/last_poll"] = b.timestamp(b.lastPoll)
+	}
+	for _, topic := range slices.Sorted(maps.Keys(values)) {
+		if err := b.publish(topic, values[topic]); err != nil {
+			slog.Error("Failed to publish", "topic", topic, "error", err)
+		}
+	}
+}
+
+// LogStats logs the run counters of the bridge and, if available, the MQTT
+// connection statistics.
+func (b *Bridge) LogStats(msg string) {
+	if reporter, ok := b.mqtt.(statsReporter); ok {
+		s := reporter.Stats()
+		slog.Info("MQTT statistics", "connected", s.Connected, "published", s.Published, "acked", s.Acked,
+			"failed", s.Failed, "in_flight", s.InFlight, "reconnects", s.Reconnects)
+	}
+	slog.Info(msg,
+		"uptime", time.Since(b.started).Round(time.Second),
+		"polls", b.polls.Load(),
+		"publishes", b.publishes.Load(),
+		"set_commands", b.setCommands.Load(),
+		"errors", b.failures.Load())
+
+	b.healthMu.Lock()
+	defer b.healthMu.Unlock()
+	for category, h := range b.health {
+		if h.failures > 0 {
+			slog.Warn("Category failing", "category", category, "failures", h.failures, "last_success", h.lastSuccess)
+		}
+	}
+}
+
+// recordPoll updates the health of a category after a poll; err is the
+// fetch error, nil on success.
+func (b *Bridge) recordPoll(category string, err error) {
+	b.healthMu.Lock()
+	defer b.healthMu.Unlock()
+	h := b.health[category]
+	if h == nil {
+		h = &categoryHealth{}
+		b.health[category] = h
+	}
+	if err != nil {
+		h.failures++
+		return
+	}
+	if h.failures > 0 {
+		slog.Info("Category recovered", "category", category, "failures", h.failures, "last_success", h.lastSuccess)
+	}
+	h.failures = 0
+	h.lastSuccess = b.clock()
+}
+
+// publish publishes a value below the root topic and counts the outcome.
+func (b *Bridge) publish(topic string, value any) error {
+	if err := b.mqtt.Publish(topic, value); err != nil {
+		b.failures.Add(1)
+		return err
+	}
+	b.publishes.Add(1)
+	return nil
+}
+
+// publishJSON is like publish, for JSON documents.
+func (b *Bridge) publishJSON(topic string, data any) error {
+	if err := b.mqtt.PublishJSON(topic, data); err != nil {
+		b.failures.Add(1)
+		return err
+	}
+	b.publishes.Add(1)
+	return nil
+}
+
+// publishTransient is like publishJSON, never retained.
+func (b *Bridge) publishTransient(topic string, data any) error {
+	if err := b.mqtt.PublishTransient(topic, data); err != nil {
+		b.failures.Add(1)
+		return err
+	}
+	b.publishes.Add(1)
+	return nil
 }
 
 func (b *Bridge) RunGetter() {
 	slog.Info("Starting getter...")
-	ticker := time.NewTicker(time.Duration(b.cfg.MyGekko.Interval * float64(time.Second)))
+	b.publishRunning("getter", true)
+	settings := newPollSettings(b.cfg)
+	ticker := time.NewTicker(settings.interval)
 	defer ticker.Stop()
 
 	// Poll immediately on start, then on every tick
 	// Start at IntervalRounds so first poll() fetches everything
-	round := b.cfg.MyGekko.IntervalRounds
+	round := settings.intervalRounds
 	poll := func() {
 		round++
 
 		// Always poll interval_items
-		if len(b.cfg.MyGekko.IntervalItems) > 0 {
-			slog.Debug("Polling interval items", "items", b.cfg.MyGekko.IntervalItems)
-			b.pollCategories(b.cfg.MyGekko.IntervalItems)
+		if len(settings.intervalItems) > 0 {
+			slog.Debug("Polling interval items", "items", settings.intervalItems)
+			b.pollRound(settings.intervalItems)
 		}
 
 		// Poll main_items every N rounds
-		if round >= b.cfg.MyGekko.IntervalRounds {
+		if round >= settings.intervalRounds {
 			round = 0
-			if len(b.cfg.MyGekko.MainItems) > 0 {
-				slog.Info("Polling main items", "items", b.cfg.MyGekko.MainItems)
-				b.pollCategories(b.cfg.MyGekko.MainItems)
+			if len(settings.mainItems) > 0 {
+				slog.Info("Polling main items", "items", settings.mainItems)
+				b.pollRound(settings.mainItems)
 			}
+			b.publishAlarms()
+			b.publishGlobals()
+			b.publishStats()
+			b.publishTelemetry()
+			b.evictHistory(b.clock())
 		}
+
+		b.publishAggregates()
+	}
+
+	if b.cfg.MyGekko.PublishMeta {
+		b.publishItemInfo()
 	}
 
+	// Periodic definitions refresh (definitions_refresh_interval)
+	var refresh <-chan time.Time
+	if interval := b.cfg.MyGekko.DefinitionsRefreshInterval; interval > 0 && b.loadDefinitions != nil {
+		refreshTicker := time.NewTicker(time.Duration(interval * float64(time.Second)))
+		defer refreshTicker.Stop()
+		refresh = refreshTicker.C
+	}
+
+	// Probe the controller while the circuit breaker is open
+	var probe <-chan time.Time
+	if b.breaker.threshold > 0 {
+		probeTicker := time.NewTicker(time.Duration(b.cfg.MyGekko.BreakerProbeInterval * float64(time.Second)))
+		defer probeTicker.Stop()
+		probe = probeTicker.C
+	}
+
+	// Categories of category_intervals run on their own tickers, which hand
+	// them to this loop when due
+	due := make(chan string, 16)
+	stopTickers := b.startCategoryTickers(settings.categoryIntervals, due)
+	defer func() { stopTickers() }()
+
 	// Initial poll immediately
+	if own := slices.Sorted(maps.Keys(settings.categoryIntervals)); len(own) > 0 {
+		b.pollRound(own)
+	}
 	poll()
+	if b.quietStart {
+		b.quietStart = false
+		slog.Info("Initial poll recorded without publishing, publishing changes from now on")
+	}
 
 	for {
 		select {
@@ -122,19 +492,225 @@ func (b *Bridge) RunGetter() {
 			return
 		case <-ticker.C:
 			poll()
+		case category := <-due:
+			slog.Debug("Polling category on its own interval", "category", category)
+			b.pollRound([]string{category})
+			b.publishAggregates()
+		case category := <-b.pollCh:
+			// Manual polls run here, in the getter, so they never overlap
+			// with a scheduled one
+			categories := []string{category}
+			if category == "" {
+				categories = settings.allItems()
+			}
+			slog.Info("Polling on request", "items", categories)
+			b.pollRound(categories)
+			b.publishAggregates()
+		case <-refresh:
+			b.refreshDefinitions(settings)
+		case <-probe:
+			if b.breaker.open && b.probe(settings.allItems()) {
+				poll()
+			}
+		case settings = <-b.reloadCh:
+			ticker.Reset(settings.interval)
+			stopTickers()
+			stopTickers = b.startCategoryTickers(settings.categoryIntervals, due)
+			slog.Info("Applied reloaded poll settings", "interval", settings.interval,
+				"interval_items", settings.intervalItems, "main_items", settings.mainItems,
+				"interval_rounds", settings.intervalRounds, "category_intervals", settings.categoryIntervals)
 		}
 	}
 }
 
-func (b *Bridge) pollCategories(categories []string) {
+// startCategoryTickers starts a ticker per category of category_intervals
+// that sends the category to due when its poll is due. A tick is skipped if
+// the getter is still busy with earlier ones. The tickers run until the
+// returned function is called or the bridge is stopped.
+func (b *Bridge) startCategoryTickers(intervals map[string]time.Duration, due chan<- string) (stop func()) {
+	done := make(chan struct{})
+	for category, interval := range intervals {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-b.ctx.Done():
+					return
+				case <-done:
+					return
+				case <-ticker.C:
+					select {
+					case due <- category:
+					default:
+						slog.Warn("Skipping poll, getter busy", "category", category)
+					}
+				}
+			}
+		}()
+	}
+	return func() { close(done) }
+}
+
+// PublishName publishes the gekko name as reported by the controller,
+// before cleaning it for the topics, to bridge/name.
+func (b *Bridge) PublishName(name string) {
+	if err := b.publish("bridge/name", name); err != nil {
+		slog.Error("Failed to publish gekko name", "error", err)
+	}
+}
+
+// PublishVersion publishes the version of the bridge to bridge/version, so
+// a rollout can be checked per gekko.
+func (b *Bridge) PublishVersion(info buildInfo) {
+	if err := b.publishJSON("bridge/version", info); err != nil {
+		slog.Error("Failed to publish bridge version", "error", err)
+	}
+}
+
+// SetItemInfo sets the item metadata parsed from the definitions.
+func (b *Bridge) SetItemInfo(info map[string]map[string]ItemInfo) {
+	slugs := itemSlugs(info)
+	b.defsMu.Lock()
+	defer b.defsMu.Unlock()
+	b.itemInfo, b.slugs = info, slugs
+}
+
+// fieldDefs returns the field definitions per category. The map is replaced,
+// never modified, by refreshDefinitions, so it can be read without the lock.
+func (b *Bridge) fieldDefs() map[string][]FieldDef {
+	b.defsMu.RLock()
+	defer b.defsMu.RUnlock()
+	return b.fieldDef
+}
+
+// items returns name and page per category and item, like fieldDefs.
+func (b *Bridge) items() map[string]map[string]ItemInfo {
+	b.defsMu.RLock()
+	defer b.defsMu.RUnlock()
+	return b.itemInfo
+}
+
+// itemMeta is the metadata document of an item: name, page and the fields
+// of its category
+type itemMeta struct {
+	ItemInfo
+	// Item is the item key, set if the topic uses the name (item_names)
+	Item   string      `json:"item,omitempty"`
+	Fields []fieldMeta `json:"fields"`
+}
+
+// fieldMeta describes a field for generic consumers
+type fieldMeta struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Enum    []string `json:"enum,omitempty"`
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	Allowed []string `json:"allowed,omitempty"`
+	Unit    string   `json:"unit,omitempty"`
+}
+
+// fieldsMeta describes the published fields of a category.
+func fieldsMeta(fields []FieldDef) []fieldMeta {
+	result := make([]fieldMeta, 0, len(fields))
+	for _, field := range fields {
+		if field.Name == "" || field.Type == "" {
+			continue
+		}
+		meta := fieldMeta{Name: field.Name, Type: field.Type, Enum: field.EnumValues, Allowed: field.Allowed, Unit: field.Unit}
+		if field.HasRange {
+			meta.Min, meta.Max = &field.Min, &field.Max
+		}
+		result = append(result, meta)
+	}
+	return result
+}
+
+// publishItemInfo publishes name and page of every item of a known category,
+// with the names, types and constraints of its fields, to
+// {category}/{item}/meta, so consumers can group items by room and build
+// dashboards without knowing the categories.
+func (b *Bridge) publishItemInfo() {
+	fieldDefs := b.fieldDefs()
+	for category, items := range b.items() {
+		fields, ok := fieldDefs[category]
+		if !ok {
+			continue
+		}
+		meta := fieldsMeta(fields)
+		for item, info := range items {
+			doc := itemMeta{ItemInfo: info, Fields: meta}
+			if b.cfg.MyGekko.ItemNames {
+				doc.Item = item
+			}
+			if err := b.publishJSON(fmt.Sprintf("%s/%s/meta", category, b.itemTopic(category, item)), doc); err != nil {
+				slog.Error("Failed to publish item metadata", "category", category, "item", item, "error", err)
+			}
+		}
+	}
+}
+
+// pollRound polls categories and keeps the getter running on failures: a
+// category that could not be fetched is retried on its next round.
+func (b *Bridge) pollRound(categories []string) {
+	if b.breaker.open {
+		slog.Debug("Circuit open, skipping poll", "items", categories)
+		return
+	}
+	err := b.pollCategories(categories)
+	switch {
+	case b.ctx.Err() != nil:
+	case err != nil:
+		b.logPollError(categories, err)
+	default:
+		b.logPollRecovered(categories)
+	}
+}
+
+// pollCategories fetches and publishes the given categories. A category that
+// cannot be fetched is skipped, so it does not hold up the others; the
+// returned error joins all fetch failures. With bulk_status, the status of
+// all categories is fetched in one request (var/status) and the categories
+// are taken from it.
+func (b *Bridge) pollCategories(categories []string) error {
+	var bulk map[string]any
+	if b.cfg.MyGekko.BulkStatus && len(categories) > 0 {
+		var err error
+		if bulk, err = b.getStatus(nil); err != nil {
+			for _, category := range categories {
+				b.recordPoll(category, err)
+				b.reportError(category+"/error", err)
+			}
+			b.failures.Add(1)
+			return fmt.Errorf("status: %w", err)
+		}
+	}
+
+	var errs []error
 	for _, category := range categories {
+		if b.breaker.open {
+			// Opened by a failure of this round: leave the rest to the probe
+			break
+		}
 		slog.Debug("category", "category", category)
 
-		status, err := b.gekko.GetStatus([]string{category})
+		status := bulk
+		var err error
+		if status == nil {
+			status, err = b.getStatus([]string{category})
+		}
+		b.recordPoll(category, err)
 		if err != nil {
-			slog.Error("Can't connect MyGekko", "error", err)
-			os.Exit(11)
+			b.failures.Add(1)
+			errs = append(errs, fmt.Errorf("%s: %w", category, err))
+			b.reportError(category+"/error", err)
+			continue
 		}
+		b.clearError(category + "/error")
+
+		b.polls.Add(1)
+		b.lastPoll = b.clock()
 
 		catData, ok := status[category]
 		if !ok {
@@ -147,55 +723,413 @@ func (b *Bridge) pollCategories(categories []string) {
 			continue
 		}
 
+		seen := make(map[string]bool, len(catMap))
+		skipped := make(map[string]string)
 		for item, itemData := range catMap {
 			if strings.HasPrefix(item, "group") {
+				skipped[item] = "group"
 				continue
 			}
+			seen[item] = true
 
 			itemMap, ok := itemData.(map[string]any)
 			if !ok {
+				skipped[item] = "item is not an object"
 				continue
 			}
 
 			sumstate, ok := itemMap["sumstate"]
 			if !ok {
+				skipped[item] = "no sumstate"
 				continue
 			}
 
-			b.processItem(category, item, sumstate)
+			var skip skipError
+			if err := b.processItem(category, item, sumstate); errors.As(err, &skip) {
+				skipped[item] = string(skip)
+			}
 		}
+		b.trackPresence(category, seen)
+		b.checkStale(category, seen)
+		b.publishIndex(category, seen)
+		b.publishSkipped(category, skipped)
 
 		// Publish timestamp for category
-		if err := b.mqtt.Publish(fmt.Sprintf("%s/get/time", category), time.Now().Unix()); err != nil {
+		if err := b.publish(fmt.Sprintf("%s/get/time", category), b.timestamp(b.clock())); err != nil {
 			slog.Error("Failed to publish timestamp", "category", category, "error", err)
-			os.Exit(6)
 		}
 	}
+	return errors.Join(errs...)
 }
 
-func (b *Bridge) processItem(category, item string, sumstate any) {
-	sumstateMap, ok := sumstate.(map[string]any)
+// indexEntry describes an item in the index of its category
+type indexEntry struct {
+	Item  string `json:"item"`
+	Topic string `json:"topic"`
+	Name  string `json:"name,omitempty"`
+	Page  string `json:"page,omitempty"`
+}
+
+// publishIndex publishes the items found in a poll of a category, with their
+// topic segment, name and page, as a JSON list to {category}/index, so a
+// dashboard can enumerate them. It is only published when the items change.
+func (b *Bridge) publishIndex(category string, seen map[string]bool) {
+	items := slices.SortedFunc(maps.Keys(seen), compareItems)
+	key := strings.Join(items, ",")
+	if indexed, ok := b.indexed[category]; ok && indexed == key {
+		return
+	}
+
+	info := b.items()[category]
+	index := make([]indexEntry, 0, len(items))
+	for _, item := range items {
+		index = append(index, indexEntry{
+			Item:  item,
+			Topic: b.itemTopic(category, item),
+			Name:  info[item].Name,
+			Page:  info[item].Page,
+		})
+	}
+	topic := fmt.Sprintf("%s/index", category)
+	if err := b.publishJSON(topic, index); err != nil {
+		slog.Error("Failed to publish", "topic", topic, "error", err)
+		return
+	}
+	b.indexed[category] = key
+}
+
+// publishSkipped publishes the number of items of a category the getter
+// skipped, and once per category the skipped item keys with their reasons,
+// if publish_skipped is enabled.
+func (b *Bridge) publishSkipped(category string, skipped map[string]string) {
+	if !b.cfg.MyGekko.PublishSkipped {
+		return
+	}
+	topic := fmt.Sprintf("%s/get/skipped", category)
+	if err := b.publish(topic, len(skipped)); err != nil {
+		slog.Error("Failed to publish", "topic", topic, "error", err)
+	}
+	if len(skipped) == 0 || b.skippedReported[category] {
+		return
+	}
+	b.skippedReported[category] = true
+	topic = fmt.Sprintf("%s/get/skipped_items", category)
+	if err := b.publishJSON(topic, skipped); err != nil {
+		slog.Error("Failed to publish", "topic", topic, "error", err)
+	}
+}
+
+// getStatus fetches the status of the given categories, or of all for nil,
+// retrying failed requests up to
+// retry_attempts times in total with exponential backoff starting at
+// retry_delay, capped by max_backoff. The controller often drops a request
+// while it is busy, so a retry usually succeeds; permanent errors such as a
+// 401 are not retried. After a 429 the client additionally holds the retry
+// back until the response's Retry-After elapsed.
+func (b *Bridge) getStatus(categories []string) (map[string]any, error) {
+	attempts := max(b.cfg.MyGekko.RetryAttempts, 1)
+	delay := time.Duration(b.cfg.MyGekko.RetryDelay * float64(time.Second))
+	maxDelay := time.Duration(b.cfg.MyGekko.MaxBackoff * float64(time.Second))
+	for attempt := 1; ; attempt++ {
+		status, err := b.gekko.GetStatus(b.ctx, categories)
+		if err == nil {
+			b.recordFetch(nil)
+			return status, nil
+		}
+		var statusErr *httpStatusError
+		if attempt >= attempts || errors.As(err, &statusErr) && statusErr.permanent() {
+			b.recordFetch(err)
+			return nil, err
+		}
+		if maxDelay > 0 {
+			delay = min(delay, maxDelay)
+		}
+		slog.Debug("Retrying status request", "categories", categories, "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-b.ctx.Done():
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+// trackPresence updates the absence counters of a category's items after a
+// poll. An item missing from removal_polls consecutive responses is considered
+// removed from the controller: its retained topics are cleared with an empty
+// payload and its history is dropped.
+func (b *Bridge) trackPresence(category string, seen map[string]bool) {
+	for item := range seen {
+		b.absences[category+"/"+item] = 0
+	}
+
+	limit := b.cfg.MyGekko.RemovalPolls
+	if limit <= 0 {
+		return
+	}
+
+	prefix := category + "/"
+	for key := range b.absences {
+		item, ok := strings.CutPrefix(key, prefix)
+		if !ok || seen[item] {
+			continue
+		}
+		b.absences[key]++
+		if b.absences[key] < limit {
+			continue
+		}
+
+		slog.Info("Item disappeared, clearing its topics", "category", category, "item", item, "polls", b.absences[key])
+		delete(b.absences, key)
+		itemTopic := b.itemTopic(category, item)
+		for _, field := range b.dropHistory(category, item) {
+			topic := fmt.Sprintf("%s/%s/get/%s", category, itemTopic, field)
+			if err := b.publish(topic, ""); err != nil {
+				slog.Error("Failed to clear topic", "topic", topic, "error", err)
+			}
+		}
+		jsonTopic := fmt.Sprintf("%s/%s/get/json", category, itemTopic)
+		if err := b.publish(jsonTopic, ""); err != nil {
+			slog.Error("Failed to clear topic", "topic", jsonTopic, "error", err)
+		}
+		if _, ok := b.stale[key]; ok {
+			delete(b.stale, key)
+			staleTopic := fmt.Sprintf("%s/%s/stale", category, itemTopic)
+			if err := b.publish(staleTopic, ""); err != nil {
+				slog.Error("Failed to clear topic", "topic", staleTopic, "error", err)
+			}
+		}
+	}
+}
+
+// recordValue stores a polled field value in the history and reports whether
+// it must be published. Unchanged values are deduplicated; a field configured
+// in republish_rounds is published again once it stayed unchanged for that
+// many polls, to prove the sensor is still alive, and every field is
+// published again once republish_interval passed since its last publish.
+func (b *Bridge) recordValue(category, item, field string, value any) bool {
+	histKey := fmt.Sprintf("%s/%s/%s", category, item, field)
+
+	b.historyMu.Lock()
+	defer b.historyMu.Unlock()
+
+	now := b.clock()
+	changed := now
+	if entry, exists := b.history[histKey]; exists && (entry.value == value || b.withinDeadband(category, field, entry.value, value)) {
+		entry.unchanged++
+		limit := b.cfg.MyGekko.RepublishRounds[category][field]
+		heartbeat := b.republishInterval > 0 && now.Sub(entry.published) >= b.republishInterval
+		if (limit <= 0 || entry.unchanged < limit) && !heartbeat {
+			entry.seen = now
+			b.history[histKey] = entry
+			return false
+		}
+		slog.Debug("Republishing unchanged value", "category", category, "item", item, "field", field, "polls", entry.unchanged)
+		changed = entry.changed
+	}
+	b.history[histKey] = historyEntry{value: value, published: now, seen: now, changed: changed}
+	return true
+}
+
+// scaleValue applies the scale and offset configured for a field to an int or
+// float value. ok is false if neither is configured.
+func (b *Bridge) scaleValue(category, field string, value any) (any, bool) {
+	scale, hasScale := b.cfg.MyGekko.Scale[category][field]
+	offset, hasOffset := b.cfg.MyGekko.Offset[category][field]
+	if !hasScale && !hasOffset {
+		return nil, false
+	}
+	if !hasScale {
+		scale = 1
+	}
+
+	var v float64
+	switch n := value.(type) {
+	case int64:
+		v = float64(n)
+	case float64:
+		v = n
+	default:
+		return nil, false
+	}
+	return v*scale + offset, true
+}
+
+// withinDeadband reports whether a float value differs from the last
+// published one by no more than the deadband of its field. Other types are
+// only deduplicated by exact match.
+func (b *Bridge) withinDeadband(category, field string, last, value any) bool {
+	delta, ok := b.cfg.MyGekko.Deadband[category][field]
+	if !ok {
+		return false
+	}
+	lastFloat, ok := last.(float64)
+	if !ok {
+		return false
+	}
+	valueFloat, ok := value.(float64)
 	if !ok {
+		return false
+	}
+	return math.Abs(valueFloat-lastFloat) <= delta
+}
+
+// evictHistory drops the history entries of fields that were not polled for
+// longer than history_ttl, e.g. of items or fields that vanished from the
+// controller, so the history does not grow forever. An evicted field that
+// shows up again is simply published anew.
+func (b *Bridge) evictHistory(now time.Time) {
+	if b.historyTTL <= 0 {
 		return
 	}
 
-	// Get the semicolon-separated value string
-	valueStr, ok := sumstateMap["value"].(string)
+	b.historyMu.Lock()
+	defer b.historyMu.Unlock()
+
+	for histKey, entry := range b.history {
+		if now.Sub(entry.seen) > b.historyTTL {
+			delete(b.history, histKey)
+		}
+	}
+}
+
+// lastValue returns the last published value of a field.
+func (b *Bridge) lastValue(category, item, field string) (any, bool) {
+	b.historyMu.RLock()
+	defer b.historyMu.RUnlock()
+	entry, ok := b.history[fmt.Sprintf("%s/%s/%s", category, item, field)]
+	return entry.value, ok
+}
+
+// forgetValue drops the history entry of a single field, so its next value is
+// published even if unchanged.
+func (b *Bridge) forgetValue(category, item, field string) {
+	b.historyMu.Lock()
+	defer b.historyMu.Unlock()
+	delete(b.history, fmt.Sprintf("%s/%s/%s", category, item, field))
+}
+
+// dropHistory removes all history entries of an item and returns the names of
+// the dropped fields.
+func (b *Bridge) dropHistory(category, item string) []string {
+	prefix := category + "/" + item + "/"
+
+	b.historyMu.Lock()
+	defer b.historyMu.Unlock()
+
+	var fields []string
+	for histKey := range b.history {
+		if field, ok := strings.CutPrefix(histKey, prefix); ok {
+			fields = append(fields, field)
+			delete(b.history, histKey)
+		}
+	}
+	return fields
+}
+
+// publishStats publishes the MQTT connection statistics to the bridge
+// diagnostics topic, if the MQTT client provides them.
+func (b *Bridge) publishStats() {
+	reporter, ok := b.mqtt.(statsReporter)
 	if !ok {
 		return
 	}
+	if err := b.publishJSON("bridge/mqtt", reporter.Stats()); err != nil {
+		slog.Error("Failed to publish MQTT stats", "error", err)
+	}
+}
+
+// valueKeys are the sumstate keys known to hold the value string, tried in
+// this order when the configured one is missing.
+var valueKeys = []string{"value", "state"}
+
+// sumstateValue returns the semicolon-separated value string of a sumstate.
+// The value is read from the category's configured value key (default
+// "value"), or else from the first of valueKeys present. A number or bool is
+// formatted as a single field; an array of states is joined as if it were
+// semicolon-separated.
+func (b *Bridge) sumstateValue(category string, sumstate map[string]any) (string, bool) {
+	key := "value"
+	if k, ok := b.cfg.MyGekko.ValueKeys[category]; ok {
+		key = k
+	}
+	raw, ok := sumstate[key]
+	for _, fallback := range valueKeys {
+		if ok {
+			break
+		}
+		raw, ok = sumstate[fallback]
+	}
+
+	switch v := raw.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case []any:
+		parts := make([]string, len(v))
+		for i, part := range v {
+			parts[i] = fmt.Sprint(part)
+		}
+		return strings.Join(parts, ";"), true
+	default:
+		slog.Debug("No parseable value in sumstate", "category", category, "key", key,
+			"keys", slices.Sorted(maps.Keys(sumstate)), "value", raw)
+		return "", false
+	}
+}
+
+// processItem parses an item's sumstate and publishes its changed fields. It
+// returns a skipError if the item cannot be processed at all.
+func (b *Bridge) processItem(category, item string, sumstate any) error {
+	sumstateMap, ok := sumstate.(map[string]any)
+	if !ok {
+		return skipError("sumstate is not an object")
+	}
+
+	// Get the semicolon-separated value string
+	valueStr, ok := b.sumstateValue(category, sumstateMap)
+	if !ok {
+		return skipError("sumstate has no value")
+	}
 
 	// Get field definitions for this category
-	fields, ok := b.fieldDef[category]
+	fields, ok := b.fieldDefs()[category]
 	if !ok {
 		slog.Warn("Unknown category", "category", category)
-		return
+		return skipError("unknown category")
+	}
+
+	itemTopic := b.itemTopic(category, item)
+
+	// The raw value string is deduplicated like a field, so it is also
+	// cleared when the item disappears
+	if b.cfg.MyGekko.PublishRaw && b.recordValue(category, item, "raw", valueStr) && !b.quietStart {
+		topic := fmt.Sprintf("%s/%s/get/raw", category, itemTopic)
+		if err := b.publish(topic, valueStr); err != nil {
+			slog.Error("Failed to publish", "topic", topic, "error", err)
+			b.forgetValue(category, item, "raw")
+		}
 	}
 
-	// Split value string and map to field names
-	values := strings.Split(valueStr, ";")
+	// Split value string and map to field names. The number of fields is
+	// capped so a pathological value string cannot blow up memory.
+	var values []string
+	if limit := b.cfg.MyGekko.MaxFields; limit > 0 {
+		values = strings.SplitN(valueStr, ";", limit+1)
+		if len(values) > limit {
+			slog.Warn("Value has too many fields, truncating", "category", category, "item", item, "max_fields", limit, "length", len(valueStr))
+			values = values[:limit]
+		}
+	} else {
+		values = strings.Split(valueStr, ";")
+	}
 	itemData := make(map[string]any)
 	hasChanges := false
+	// itemErr is the last parse or publish error, for the item's error topic
+	var itemErr error
 
 	for i, field := range fields {
 		if i >= len(values) {
@@ -212,94 +1146,251 @@ func (b *Bridge) processItem(category, item string, sumstate any) {
 			continue
 		}
 
-		// Convert value to appropriate type
+		// Convert value to appropriate type, unless a transformer decodes it
 		var value any
 		var err error
-		switch field.Type {
-		case "int":
-			value, err = strconv.Atoi(rawValue)
-		case "float":
-			value, err = strconv.ParseFloat(rawValue, 64)
-		case "string":
-			value = rawValue
-		default:
-			continue
+		var unit string
+		if transformed, ok := b.transform(category, item, field.Name, rawValue); ok {
+			value = transformed
+		} else {
+			switch field.Type {
+			case "int":
+				value, err = strconv.ParseInt(rawValue, 10, 64)
+			case "float":
+				if b.cfg.MyGekko.DecimalComma {
+					rawValue = decimalPoint(rawValue)
+				}
+				if b.cfg.MyGekko.StripUnits {
+					rawValue, unit = splitUnit(rawValue)
+				}
+				value, err = strconv.ParseFloat(rawValue, 64)
+			case "string":
+				value = rawValue
+			case "bool":
+				value, err = strconv.ParseBool(rawValue)
+			case "color":
+				value, err = parseColor(rawValue)
+			default:
+				continue
+			}
 		}
 
 		if err != nil {
+			b.failures.Add(1)
 			slog.Error("Failed to parse value", "category", category, "item", item, "field", field.Name, "value", rawValue, "error", err)
-			os.Exit(5)
+			itemErr = fmt.Errorf("parse %s: %w", field.Name, err)
+			continue
 		}
 
-		// Add to item data for JSON publish
-		itemData[field.Name] = value
+		// A scaled value replaces the parsed one, which is kept in the JSON
+		if scaled, ok := b.scaleValue(category, field.Name, value); ok {
+			itemData[field.Name+"_raw"] = value
+			value = scaled
+		}
+
+		// Add to item data for JSON publish; an enum is published as its
+		// label, with the raw value kept in the JSON
+		published := value
+		if label, ok := b.enumLabel(field, value); ok {
+			published = label
+			itemData[field.Name+"_raw"] = value
+		}
+		itemData[field.Name] = published
+		// A color is published as "#rrggbb", and as its components in the
+		// JSON
+		if n, ok := value.(int64); ok && field.Type == "color" {
+			published = colorHex(n)
+			itemData[field.Name] = colorRGB(n)
+		}
+		if unit != "" {
+			itemData[field.Name+"_unit"] = unit
+		}
+		if b.cfg.MyGekko.JSONUnits && field.Unit != "" {
+			itemData[field.Name+"_unit"] = field.Unit
+		}
 
 		// Check history to avoid duplicate publishes
-		histKey := fmt.Sprintf("%s/%s/%s", category, item, field.Name)
-		if oldVal, exists := b.history[histKey]; exists && oldVal == value {
+		if !b.recordValue(category, item, field.Name, value) {
+			continue
+		}
+		// The initial poll with suppress_initial_publish only fills the
+		// history
+		if b.quietStart {
 			continue
 		}
-		b.history[histKey] = value
 		hasChanges = true
 
 		// Publish individual field to MQTT
-		topic := fmt.Sprintf("%s/%s/get/%s", category, item, field.Name)
-		if err := b.mqtt.Publish(topic, value); err != nil {
+		topic := fmt.Sprintf("%s/%s/get/%s", category, itemTopic, field.Name)
+		if err := b.publish(topic, published); err != nil {
 			slog.Error("Failed to publish", "topic", topic, "error", err)
-			os.Exit(6)
+			// Retry on the next poll instead of treating it as published
+			b.forgetValue(category, item, field.Name)
+			itemErr = fmt.Errorf("publish %s: %w", field.Name, err)
 		}
 	}
 
 	// Publish JSON with all fields if any value changed
 	if hasChanges && len(itemData) > 0 {
-		itemData["timestamp"] = time.Now().Unix()
-		jsonTopic := fmt.Sprintf("%s/%s/get/json", category, item)
-		if err := b.mqtt.PublishJSON(jsonTopic, itemData); err != nil {
+		itemData["timestamp"] = b.timestamp(b.clock())
+		jsonTopic := fmt.Sprintf("%s/%s/get/json", category, itemTopic)
+		if err := b.publishJSON(jsonTopic, itemData); err != nil {
 			slog.Error("Failed to publish JSON", "topic", jsonTopic, "error", err)
-			os.Exit(6)
+			itemErr = fmt.Errorf("publish json: %w", err)
 		}
 	}
+
+	if itemErr != nil {
+		b.reportError(b.itemErrorTopic(category, item, "error"), itemErr)
+	} else {
+		b.clearError(b.itemErrorTopic(category, item, "error"))
+	}
+	return nil
 }
 
-func (b *Bridge) RunSetter() {
-	slog.Info("Starting setter...")
+// timestamp formats t for publishing: Unix seconds, or an RFC 3339 string in
+// the configured timezone (UTC by default) with timestamp_format = "rfc3339".
+func (b *Bridge) timestamp(t time.Time) any {
+	if b.cfg.MyGekko.TimestampFormat == "rfc3339" {
+		if loc := b.cfg.MyGekko.location; loc != nil {
+			return t.In(loc).Format(time.RFC3339)
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	return t.Unix()
+}
 
-	// Drain the command queue in a dedicated goroutine so the MQTT receive
-	// loop is never blocked by a slow MyGEKKO request.
-	go b.runCommandWorker()
+// subscribeCategory subscribes to the set commands of a category.
+func (b *Bridge) subscribeCategory(category string) error {
+	if b.cfg.MyGekko.ReadOnly {
+		return nil
+	}
+	topic := fmt.Sprintf("%s/+/set", category)
+	slog.Info("subscribe", "topic", topic)
+	err := b.subscribe(topic, func(t string, payload []byte) {
+		b.handleSetCommand(t, payload)
+	})
+	if err != nil {
+		return fmt.Errorf("subscribe %s: %w", topic, err)
+	}
 
+	topic = fmt.Sprintf("%s/+/cmd/+", category)
+	slog.Info("subscribe", "topic", topic)
+	if err := b.subscribe(topic, b.handleCommand); err != nil {
+		return fmt.Errorf("subscribe %s: %w", topic, err)
+	}
+	return nil
+}
+
+// subscribe subscribes to a topic and remembers it for unsubscribeAll.
+func (b *Bridge) subscribe(topic string, handler func(topic string, payload []byte)) error {
+	if err := b.mqtt.Subscribe(topic, handler); err != nil {
+		return err
+	}
+	b.subsMu.Lock()
+	defer b.subsMu.Unlock()
+	b.subscribed = append(b.subscribed, topic)
+	return nil
+}
+
+// unsubscribeAll removes the subscriptions of the bridge on shutdown, so
+// none is left dangling in a persistent MQTT session.
+func (b *Bridge) unsubscribeAll() {
+	b.subsMu.Lock()
+	topics := b.subscribed
+	b.subscribed = nil
+	b.subsMu.Unlock()
+
+	for _, topic := range topics {
+		if err := b.mqtt.Unsubscribe(topic); err != nil {
+			b.failures.Add(1)
+			slog.Warn("Failed to unsubscribe", "topic", topic, "error", err)
+		}
+	}
+}
+
+// Subscribe subscribes to the set commands of all known categories, unless
+// read_only, and the bridge control topics. Commands are queued until
+// RunSetter runs.
+func (b *Bridge) Subscribe() error {
 	// Subscribe to all set commands for all known categories
-	allCategories := make([]string, 0, len(b.fieldDef))
-	for category := range b.fieldDef {
-		allCategories = append(allCategories, category)
-	}
-	slices.Sort(allCategories)
-	for _, category := range allCategories {
-		topic := fmt.Sprintf("%s/+/set", category)
-		slog.Info("subscribe", "topic", topic)
-		err := b.mqtt.Subscribe(topic, func(t string, payload []byte) {
-			b.handleSetCommand(t, payload)
-		})
-		if err != nil {
-			slog.Error("Failed to subscribe", "topic", topic, "error", err)
-			os.Exit(7)
+	for _, category := range slices.Sorted(maps.Keys(b.fieldDefs())) {
+		if err := b.subscribeCategory(category); err != nil {
+			return err
 		}
 	}
 
+	if err := b.subscribeGlobals(); err != nil {
+		return err
+	}
+
+	// On-demand polls
+	if err := b.subscribe("bridge/poll", b.handlePoll); err != nil {
+		return fmt.Errorf("subscribe bridge/poll: %w", err)
+	}
+
+	// Runtime log level changes; cmd/loglevel is an alias of bridge/log_level
+	for _, topic := range []string{"bridge/log_level", "cmd/loglevel"} {
+		if err := b.subscribe(topic, b.handleLogLevel); err != nil {
+			return fmt.Errorf("subscribe %s: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+// RunSetter processes queued set commands until the bridge is stopped.
+func (b *Bridge) RunSetter() {
+	slog.Info("Starting setter...")
+	b.publishRunning("setter", true)
+
+	// Drain the command queue in a dedicated goroutine so the MQTT receive
+	// loop is never blocked by a slow MyGEKKO request.
+	b.Go(b.runCommandWorker)
+
 	slog.Info("Start MQTT")
 	// Wait for shutdown
 	<-b.ctx.Done()
 	slog.Info("Setter stopped")
 }
 
-// categoryFromTopic extracts the category from a set topic
-// ({root}/{category}/{item}/set), or "" if the topic is malformed.
-func categoryFromTopic(topic string) string {
-	parts := strings.Split(topic, "/")
-	if len(parts) < 4 {
-		return ""
+// parseSetTopic splits a set topic relative to the root
+// ({category}/{item}/set) into category and item. Everything before the item
+// is the category, so a category may contain slashes.
+func parseSetTopic(topic string) (category, item string, err error) {
+	rest, ok := strings.CutSuffix(topic, "/set")
+	if !ok {
+		return "", "", fmt.Errorf("%q is not a set topic", topic)
+	}
+	i := strings.LastIndex(rest, "/")
+	if i <= 0 || i == len(rest)-1 {
+		return "", "", fmt.Errorf("%q lacks a category or item", topic)
+	}
+	return rest[:i], rest[i+1:], nil
+}
+
+// parseCmdTopic splits a command topic relative to the root
+// ({category}/{item}/cmd/{verb}) into category, item and scmd verb. The verb
+// must consist of lower case letters, digits and underscores, and must not be
+// set, which has its own topic.
+func parseCmdTopic(topic string) (category, item, command string, err error) {
+	i := strings.LastIndex(topic, "/cmd/")
+	if i < 0 {
+		return "", "", "", fmt.Errorf("%q is not a command topic", topic)
+	}
+	command = topic[i+len("/cmd/"):]
+	if command == "" || strings.ContainsFunc(command, func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_'
+	}) {
+		return "", "", "", fmt.Errorf("%q has an invalid command %q", topic, command)
+	}
+	if command == "set" {
+		return "", "", "", fmt.Errorf("%q: use the set topic for set commands", topic)
+	}
+	category, item, err = parseSetTopic(topic[:i] + "/set")
+	if err != nil {
+		return "", "", "", err
 	}
-	return parts[len(parts)-3]
+	return category, item, command, nil
 }
 
 // isThrottled reports whether a command must be spaced by cmdInterval (true) or
@@ -319,26 +1410,120 @@ func (b *Bridge) isThrottled(category, value string) bool {
 	return false
 }
 
+// handlePoll requests an immediate poll from a bridge/poll message: the
+// payload names a category, or is empty for all polled categories. The poll
+// itself runs in the getter.
+func (b *Bridge) handlePoll(topic string, payload []byte) {
+	category := strings.TrimSpace(string(payload))
+	if _, ok := b.fieldDefs()[category]; category != "" && !ok {
+		slog.Warn("Ignoring poll request for unknown category", "topic", topic, "category", category)
+		return
+	}
+	select {
+	case b.pollCh <- category:
+	default:
+		slog.Warn("Ignoring poll request, too many pending", "category", category)
+	}
+}
+
+// handleLogLevel changes the log level at runtime from a bridge/log_level or
+// cmd/loglevel message (DEBUG, INFO, WARN or ERROR). Invalid levels are
+// rejected.
+func (b *Bridge) handleLogLevel(topic string, payload []byte) {
+	if err := SetLogLevel(string(payload)); err != nil {
+		slog.Warn("Ignoring log level change", "topic", topic, "error", err)
+		return
+	}
+	slog.Info("Changed log level", "level", logLevel.Level())
+}
+
 // handleSetCommand is the MQTT receive callback. It must not block, so it only
 // copies the message and hands it to the command worker via the matching queue.
 func (b *Bridge) handleSetCommand(topic string, payload []byte) {
 	slog.Info("Incoming message...", "topic", topic)
 
-	// paho may reuse the payload buffer after this callback returns, so copy it.
-	p := make([]byte, len(payload))
-	copy(p, payload)
+	category, segment, err := parseSetTopic(topic)
+	if err != nil {
+		b.failures.Add(1)
+		slog.Error("Invalid set topic", "topic", topic, "error", err)
+		return
+	}
+	item := b.itemKey(category, segment)
+	if !b.writable(category, item) {
+		b.failures.Add(1)
+		slog.Warn("Rejecting set command for a non-writable item", "category", category, "item", item)
+		b.publishSetError(category, item, errors.New("item is not writable"))
+		return
+	}
+
+	if b.setDebounce > 0 {
+		b.debounceSet(category, item, topic, payload)
+		return
+	}
+	b.queueSet(category, item, topic, payload)
+}
 
-	cmd := setCommand{topic: topic, payload: p}
+// queueSet queues the commands of a set message for the command worker.
+func (b *Bridge) queueSet(category, item, topic string, payload []byte) {
+	// A JSON object sets several fields, one command each
+	values, ok, err := b.expandSetJSON(category, payload)
+	if err != nil {
+		b.failures.Add(1)
+		slog.Error("Rejecting set command", "topic", topic, "error", err)
+		b.publishSetError(category, item, err)
+		return
+	}
+	if !ok {
+		values = []string{string(payload)}
+	}
+
+	for _, value := range values {
+		// Copied by the conversion: paho may reuse the payload buffer after
+		// this callback returns.
+		if !b.queueCommand(category, setCommand{topic: topic, payload: []byte(value)}) {
+			return
+		}
+	}
+}
 
+// handleCommand is the MQTT receive callback of {category}/{item}/cmd/{verb}
+// topics, for scmd commands other than set (e.g. stop). The payload is sent
+// as is as the value of the command. Like handleSetCommand, it only queues
+// the command.
+func (b *Bridge) handleCommand(topic string, payload []byte) {
+	slog.Info("Incoming message...", "topic", topic)
+
+	category, segment, command, err := parseCmdTopic(topic)
+	if err != nil {
+		b.failures.Add(1)
+		slog.Error("Invalid command topic", "topic", topic, "error", err)
+		return
+	}
+	item := b.itemKey(category, segment)
+	if !b.writable(category, item) {
+		b.failures.Add(1)
+		slog.Warn("Rejecting command for a non-writable item", "category", category, "item", item, "command", command)
+		b.publishSetError(category, item, errors.New("item is not writable"))
+		return
+	}
+
+	b.queueCommand(category, setCommand{topic: topic, payload: slices.Clone(payload), command: command})
+}
+
+// queueCommand hands a command to the command worker, via the immediate
+// queue unless it is throttled. It reports false if the bridge stopped.
+func (b *Bridge) queueCommand(category string, cmd setCommand) bool {
 	queue := b.cmdQueue
-	if !b.isThrottled(categoryFromTopic(topic), string(p)) {
-		slog.Debug("Queuing immediate command", "topic", topic)
+	if !b.isThrottled(category, string(cmd.payload)) {
+		slog.Debug("Queuing immediate command", "topic", cmd.topic)
 		queue = b.immediateQueue
 	}
 
 	select {
 	case queue <- cmd:
+		return true
 	case <-b.ctx.Done():
+		return false
 	}
 }
 
@@ -351,7 +1536,14 @@ func (b *Bridge) runCommandWorker() {
 	var last time.Time
 
 	send := func(cmd setCommand) {
-		b.processSetCommand(cmd.topic, cmd.payload)
+		switch {
+		case cmd.global != "":
+			b.processGlobalSet(cmd.global, cmd.payload)
+		case cmd.command != "":
+			b.processCommand(cmd.topic, cmd.payload)
+		default:
+			b.processSetCommand(cmd.topic, cmd.payload)
+		}
 		last = time.Now()
 	}
 
@@ -408,27 +1600,133 @@ func (b *Bridge) runCommandWorker() {
 }
 
 func (b *Bridge) processSetCommand(topic string, payload []byte) {
-	// Parse topic: {root}/{category}/{item}/set
-	parts := strings.Split(topic, "/")
-	if len(parts) < 4 {
-		slog.Error("Invalid topic format", "topic", topic)
+	category, segment, err := parseSetTopic(topic)
+	if err != nil {
+		b.failures.Add(1)
+		slog.Error("Invalid set topic", "topic", topic, "error", err)
+		return
+	}
+	item := b.itemKey(category, segment)
+	value, err := b.colorSetValue(category, b.boolSetValue(category, b.enumIndex(category, string(payload))))
+	if err != nil {
+		b.failures.Add(1)
+		slog.Error("Rejecting set command", "category", category, "item", item, "error", err)
+		b.publishSetError(category, item, err)
 		return
 	}
-
-	// Extract category and item (skip root prefix)
-	category := parts[len(parts)-3]
-	item := parts[len(parts)-2]
-	value := string(payload)
 
 	slog.Info("Write command", "value", value, "category", category, "item", item)
 
+	if b.cfg.MyGekko.ValidateSets {
+		if err := b.validateSet(category, value); err != nil {
+			b.failures.Add(1)
+			slog.Error("Rejecting set command", "category", category, "item", item, "value", value, "error", err)
+			b.publishSetError(category, item, err)
+			return
+		}
+	}
+
+	if b.isUnchangedSet(category, item, value) {
+		slog.Info("Skipping set command, value unchanged", "value", value, "category", category, "item", item)
+		return
+	}
+
+	if b.cfg.MyGekko.DryRun {
+		slog.Info("Dry run, not sending set command", "category", category, "item", item, "value", value)
+		b.publishSetResult(category, item, setResult{Value: value, DryRun: true})
+		return
+	}
+
 	// A failed command must not take down the bridge: that would also drop all
 	// other commands still queued behind it. Log it and carry on.
-	if err := b.gekko.SetValue(category, item, value); err != nil {
+	b.setCommands.Add(1)
+	if err := b.gekko.SetValue(b.ctx, category, item, value); err != nil {
+		b.failures.Add(1)
 		slog.Error("MyGEKKO command error", "error", err, "category", category, "item", item, "value", value)
+		b.reportError(b.itemErrorTopic(category, item, "set/error"), err)
 		return
 	}
 	slog.Debug("Command ok", "category", category, "item", item, "value", value)
+	b.clearError(b.itemErrorTopic(category, item, "set/error"))
+
+	if b.cfg.MyGekko.ConfirmSets {
+		b.Go(func() { b.confirmSet(category, item, value) })
+	}
+}
+
+// processCommand sends a queued scmd command other than set to MyGEKKO.
+func (b *Bridge) processCommand(topic string, payload []byte) {
+	category, segment, command, err := parseCmdTopic(topic)
+	if err != nil {
+		b.failures.Add(1)
+		slog.Error("Invalid command topic", "topic", topic, "error", err)
+		return
+	}
+	item := b.itemKey(category, segment)
+	value := string(payload)
+
+	slog.Info("Write command", "command", command, "value", value, "category", category, "item", item)
+
+	if b.cfg.MyGekko.DryRun {
+		slog.Info("Dry run, not sending command", "category", category, "item", item, "command", command, "value", value)
+		b.publishSetResult(category, item, setResult{Command: command, Value: value, DryRun: true})
+		return
+	}
+
+	// Reported on the set error topic of the item, like a failed set command
+	b.setCommands.Add(1)
+	errTopic := b.itemErrorTopic(category, item, "set/error")
+	if err := b.gekko.SendCommand(b.ctx, category, item, command, value); err != nil {
+		b.failures.Add(1)
+		slog.Error("MyGEKKO command error", "error", err, "category", category, "item", item, "command", command, "value", value)
+		b.reportError(errTopic, err)
+		return
+	}
+	slog.Debug("Command ok", "category", category, "item", item, "command", command, "value", value)
+	b.clearError(errTopic)
+}
+
+// isUnchangedSet reports whether a set command can be suppressed because the
+// field it writes (set_fields) already has the requested value. Suppression is
+// opt-in (suppress_unchanged_sets) and skipped for categories and items listed
+// in always_send, e.g. triggers where re-sending the same value is meaningful.
+func (b *Bridge) isUnchangedSet(category, item, value string) bool {
+	if !b.cfg.MyGekko.SuppressUnchangedSets {
+		return false
+	}
+	field, ok := b.cfg.MyGekko.SetFields[category]
+	if !ok {
+		return false
+	}
+	if slices.Contains(b.cfg.MyGekko.AlwaysSend, category) || slices.Contains(b.cfg.MyGekko.AlwaysSend, category+"/"+item) {
+		return false
+	}
+	known, ok := b.lastValue(category, item, field)
+	if !ok {
+		return false
+	}
+	return valueMatches(known, value)
+}
+
+// valueMatches reports whether a set payload equals a known field value,
+// either literally or numerically (so "50" matches 50 and "21.50" matches 21.5).
+func valueMatches(known any, payload string) bool {
+	if fmt.Sprint(known) == payload {
+		return true
+	}
+	want, err := strconv.ParseFloat(payload, 64)
+	if err != nil {
+		return false
+	}
+	switch v := known.(type) {
+	case int64:
+		return float64(v) == want
+	case float64:
+		return v == want
+	case bool:
+		return v && want == 1 || !v && want == 0
+	}
+	return false
 }
 
 // parseFormatField parses a single field from the format string
@@ -462,29 +1760,172 @@ func parseFormatField(raw string) (FieldDef, error) {
 	}
 
 	var fieldType string
+	var enumValues []string
 	switch typeName {
-	case "int", "enum":
+	case "int":
+		fieldType = "int"
+	case "enum":
 		fieldType = "int"
+		enumValues = parseEnumValues(typeData[bracketIdx+1:])
 	case "float":
 		fieldType = "float"
 	case "string":
 		fieldType = "string"
+	case "bool", "boolean":
+		fieldType = "bool"
+	case "color", "rgb":
+		fieldType = "color"
 	case "null":
 		fieldType = ""
 	default:
 		return FieldDef{}, fmt.Errorf("type %s is not supported", typeName)
 	}
 
-	return FieldDef{Name: name, Type: fieldType}, nil
+	field := FieldDef{Name: name, Type: fieldType, EnumValues: enumValues, Unit: parseUnit(typeData[bracketIdx+1:])}
+	if fieldType == "int" || fieldType == "float" {
+		parseValueConstraints(&field, typeData[bracketIdx+1:])
+	}
+	return field, nil
 }
 
-// LoadFieldDefinitions loads and parses field definitions from the MyGEKKO API
-func LoadFieldDefinitions(gekko *MyGekkoClient) (map[string][]FieldDef, error) {
+// parseValueConstraints reads the range ("0.0:100.0") or the list of allowed
+// values ("0,1,2") from the bracket of a numeric field. Brackets that are
+// neither, like enum labels, are ignored.
+func parseValueConstraints(field *FieldDef, bracket string) {
+	content, _, found := strings.Cut(bracket, "]")
+	if !found {
+		return
+	}
+	if lo, hi, ok := strings.Cut(content, ":"); ok {
+		low, errLow := strconv.ParseFloat(strings.TrimSpace(lo), 64)
+		high, errHigh := strconv.ParseFloat(strings.TrimSpace(hi), 64)
+		if errLow == nil && errHigh == nil && low <= high {
+			field.Min, field.Max, field.HasRange = low, high, true
+		}
+		return
+	}
+	var allowed []string
+	for _, v := range strings.Split(content, ",") {
+		v = strings.TrimSpace(v)
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return
+		}
+		allowed = append(allowed, v)
+	}
+	field.Allowed = allowed
+}
+
+// decimalPoint replaces the decimal comma of a float value ("21,5") with a
+// point. Values with more than one comma or with a point are left alone.
+func decimalPoint(value string) string {
+	if strings.Count(value, ",") != 1 || strings.Contains(value, ".") {
+		return value
+	}
+	return strings.Replace(value, ",", ".", 1)
+}
+
+// numberPrefix matches the number at the start of a float value, in decimal
+// or scientific notation ("1.2e3").
+var numberPrefix = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?`)
+
+// splitUnit splits a float value into the number and the unit following it
+// ("45.5W" -> "45.5", "W"). A value that does not start with a number is
+// returned unchanged, to fail parsing.
+func splitUnit(value string) (number, unit string) {
+	n := len(numberPrefix.FindString(value))
+	if n == 0 {
+		return value, ""
+	}
+	return value[:n], strings.TrimSpace(value[n:])
+}
+
+// parseUnit reads the unit from the suffix after the bracket of a field:
+// "(unit:°C)" or a plain "(I.S.)". A "-" placeholder means no unit.
+func parseUnit(bracket string) string {
+	_, suffix, found := strings.Cut(bracket, "]")
+	if !found {
+		return ""
+	}
+	suffix = strings.TrimSpace(suffix)
+	suffix = strings.TrimSuffix(strings.TrimPrefix(suffix, "("), ")")
+	suffix = strings.TrimSpace(strings.TrimPrefix(suffix, "unit:"))
+	if suffix == "-" {
+		return ""
+	}
+	return suffix
+}
+
+// parseEnumValues parses the labels of an enum bracket ("off,on,auto]...").
+// Entries may carry their value ("0=off"); labels are only kept if the values
+// are the positions 0..n-1, otherwise nil is returned.
+func parseEnumValues(bracket string) []string {
+	content, _, found := strings.Cut(bracket, "]")
+	if !found || strings.TrimSpace(content) == "" {
+		return nil
+	}
+	entries := strings.Split(content, ",")
+	labels := make([]string, len(entries))
+	for i, entry := range entries {
+		label := strings.TrimSpace(entry)
+		if key, rest, ok := strings.Cut(label, "="); ok {
+			if n, err := strconv.Atoi(strings.TrimSpace(key)); err != nil || n != i {
+				return nil
+			}
+			label = strings.TrimSpace(rest)
+		}
+		if label == "" {
+			return nil
+		}
+		labels[i] = label
+	}
+	return labels
+}
+
+// enumLabel returns the label of an enum field's value, if enum labels are
+// enabled and the value is in range.
+func (b *Bridge) enumLabel(field FieldDef, value any) (string, bool) {
+	i, ok := value.(int64)
+	if !b.cfg.MyGekko.EnumLabels || !ok || i < 0 || i >= int64(len(field.EnumValues)) {
+		return "", false
+	}
+	return field.EnumValues[i], true
+}
+
+// enumIndex maps a set command label of the category's set field back to its
+// index, if enum labels are enabled. Other payloads are returned unchanged.
+func (b *Bridge) enumIndex(category, value string) string {
+	if !b.cfg.MyGekko.EnumLabels {
+		return value
+	}
+	name, ok := b.cfg.MyGekko.SetFields[category]
+	if !ok {
+		return value
+	}
+	for _, field := range b.fieldDefs()[category] {
+		if field.Name != name {
+			continue
+		}
+		for i, label := range field.EnumValues {
+			if strings.EqualFold(label, value) {
+				return strconv.Itoa(i)
+			}
+		}
+	}
+	return value
+}
+
+// LoadFieldDefinitions loads and parses field definitions from the MyGEKKO API.
+// The full definitions document can be large and slow to produce, so the
+// request is aborted once ctx is done.
+func LoadFieldDefinitions(ctx context.Context, gekko GekkoClient) (map[string][]FieldDef, map[string]map[string]ItemInfo, error) {
 	slog.Info("Loading field definitions from API...")
 
-	definitions, err := gekko.GetDefinitions()
+	definitions, err := gekko.GetDefinitions(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, nil, fmt.Errorf("timed out getting definitions: %w", err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get definitions: %w", err)
+		return nil, nil, fmt.Errorf("failed to get definitions: %w", err)
 	}
 
 	result := make(map[string][]FieldDef)
@@ -532,6 +1973,8 @@ func LoadFieldDefinitions(gekko *MyGekkoClient) (map[string][]FieldDef, error) {
 
 			if len(fields) > 0 {
 				result[category] = fields
+			} else {
+				slog.Warn("Skipping category without parseable fields", "category", category)
 			}
 
 			break // Only need first item per category
@@ -546,5 +1989,107 @@ func LoadFieldDefinitions(gekko *MyGekkoClient) (map[string][]FieldDef, error) {
 		}
 	}
 
-	return result, nil
+	return result, ParseItemInfo(definitions), nil
+}
+
+// ParseItemInfo extracts name and page of every item from the definitions,
+// per category and item. The name is read from "name", or the "en" or "de"
+// translation. The page is read from "page", or "room" on controllers that
+// use that key; items without either have an empty page.
+func ParseItemInfo(definitions map[string]any) map[string]map[string]ItemInfo {
+	result := make(map[string]map[string]ItemInfo)
+	for category, catData := range definitions {
+		catMap, ok := catData.(map[string]any)
+		if !ok {
+			continue
+		}
+		for itemName, itemData := range catMap {
+			itemMap, ok := itemData.(map[string]any)
+			if !strings.HasPrefix(itemName, "item") || !ok {
+				continue
+			}
+			var info ItemInfo
+			for _, key := range []string{"name", "en", "de"} {
+				if info.Name, _ = itemMap[key].(string); info.Name != "" {
+					break
+				}
+			}
+			if page, ok := itemMap["page"].(string); ok {
+				info.Page = page
+			} else {
+				info.Page, _ = itemMap["room"].(string)
+			}
+			if result[category] == nil {
+				result[category] = make(map[string]ItemInfo)
+			}
+			result[category][itemName] = info
+		}
+	}
+	return result
+}
+
+// ApplyBoolEnums types the enum fields with the labels off and on as "bool",
+// for bool_enums, so they are published as false and true.
+func ApplyBoolEnums(definitions map[string][]FieldDef) {
+	for _, defs := range definitions {
+		for i, field := range defs {
+			if field.Type == "int" && len(field.EnumValues) == 2 &&
+				strings.EqualFold(field.EnumValues[0], "off") && strings.EqualFold(field.EnumValues[1], "on") {
+				defs[i].Type = "bool"
+			}
+		}
+	}
+}
+
+// boolBit maps a boolean set command value (true/false, on/off, 1/0) to the
+// 1 or 0 MyGEKKO expects.
+func boolBit(value string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "on", "1":
+		return "1", true
+	case "false", "off", "0":
+		return "0", true
+	}
+	return "", false
+}
+
+// boolSetValue translates the value of a set command that writes a bool
+// field (see setTarget) to 1 or 0; other payloads are returned unchanged.
+func (b *Bridge) boolSetValue(category, value string) string {
+	name, rest, err := b.setTarget(category, value)
+	if err != nil {
+		return value
+	}
+	defs := b.fieldDefs()[category]
+	if i := fieldIndex(defs, name); i == len(defs) || defs[i].Type != "bool" {
+		return value
+	}
+	bit, ok := boolBit(rest)
+	if !ok {
+		return value
+	}
+	return value[:len(value)-len(rest)] + bit
+}
+
+// ApplyFieldTypes overrides the parsed type of individual fields, for when the
+// type inferred from the format string is wrong or unwanted (e.g. an int field
+// that should keep its leading zeros as a string). Overrides for unknown
+// categories or fields are logged and ignored.
+func ApplyFieldTypes(definitions map[string][]FieldDef, overrides map[string]map[string]string) {
+	for category, fields := range overrides {
+		defs, ok := definitions[category]
+		if !ok {
+			slog.Warn("Field type override for unknown category", "category", category)
+			continue
+		}
+		for field, typ := range fields {
+			i := slices.IndexFunc(defs, func(f FieldDef) bool { return f.Name == field })
+			if i == -1 {
+				slog.Warn("Field type override for unknown field", "category", category, "field", field)
+				continue
+			}
+			slog.Debug("Overriding field type", "category", category, "field", field, "from", defs[i].Type, "to", typ)
+			defs[i].Type = typ
+		}
+	}
 }
@@ -1,15 +1,29 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
 // MockMQTT implements MQTTPublisher for testing
 type MockMQTT struct {
-	published     []PublishedMessage
-	jsonPublished []PublishedJSON
-	subscriptions []string
+	published       []PublishedMessage
+	jsonPublished   []PublishedJSON
+	subscriptions   []string
+	unsubscriptions []string
+	publishErr      error
+	handlers        map[string]func(string, []byte)
 }
 
 type PublishedMessage struct {
@@ -20,6 +34,8 @@ type PublishedMessage struct {
 type PublishedJSON struct {
 	Topic string
 	Data  any
+	// Transient is set for PublishTransient, which is never retained
+	Transient bool
 }
 
 func NewMockMQTT() *MockMQTT {
@@ -27,10 +43,14 @@ func NewMockMQTT() *MockMQTT {
 		published:     []PublishedMessage{},
 		jsonPublished: []PublishedJSON{},
 		subscriptions: []string{},
+		handlers:      map[string]func(string, []byte){},
 	}
 }
 
 func (m *MockMQTT) Publish(topic string, value any) error {
+	if m.publishErr != nil {
+		return m.publishErr
+	}
 	m.published = append(m.published, PublishedMessage{Topic: topic, Value: value})
 	return nil
 }
@@ -40,8 +60,27 @@ func (m *MockMQTT) PublishJSON(topic string, data any) error {
 	return nil
 }
 
+func (m *MockMQTT) PublishTransient(topic string, data any) error {
+	m.jsonPublished = append(m.jsonPublished, PublishedJSON{Topic: topic, Data: data, Transient: true})
+	return nil
+}
+
 func (m *MockMQTT) Subscribe(topic string, handler func(string, []byte)) error {
 	m.subscriptions = append(m.subscriptions, topic)
+	m.handlers[topic] = handler
+	return nil
+}
+
+// deliver passes a message to the handler subscribed to topic, as the broker
+// would.
+func (m *MockMQTT) deliver(topic string, payload []byte) {
+	if handler, ok := m.handlers[topic]; ok {
+		handler(topic, payload)
+	}
+}
+
+func (m *MockMQTT) Unsubscribe(topic string) error {
+	m.unsubscriptions = append(m.unsubscriptions, topic)
 	return nil
 }
 
@@ -51,6 +90,12 @@ type MockGekko struct {
 	status      map[string]any
 	definitions map[string]any
 	setValue    func(category, item, value string) error
+	sendCommand func(category, item, command, value string) error
+	statusErr   map[string]error
+	getStatus   func(categories []string) (map[string]any, error)
+	alarms      any
+	alarmsErr   error
+	globals     map[string]map[string]any
 }
 
 func NewMockGekko(name string) *MockGekko {
@@ -65,21 +110,51 @@ func (m *MockGekko) GetGekkoName() (string, error) {
 	return m.name, nil
 }
 
-func (m *MockGekko) GetStatus(categories []string) (map[string]any, error) {
+func (m *MockGekko) GetStatus(ctx context.Context, categories []string) (map[string]any, error) {
+	if m.getStatus != nil {
+		return m.getStatus(categories)
+	}
+	for _, category := range categories {
+		if err := m.statusErr[category]; err != nil {
+			return nil, err
+		}
+	}
 	return m.status, nil
 }
 
-func (m *MockGekko) SetValue(category, item, value string) error {
+func (m *MockGekko) SetValue(ctx context.Context, category, item, value string) error {
 	if m.setValue != nil {
 		return m.setValue(category, item, value)
 	}
 	return nil
 }
 
-func (m *MockGekko) GetDefinitions() (map[string]any, error) {
+func (m *MockGekko) SendCommand(ctx context.Context, category, item, command, value string) error {
+	if m.sendCommand != nil {
+		return m.sendCommand(category, item, command, value)
+	}
+	return nil
+}
+
+func (m *MockGekko) GetDefinitions(ctx context.Context) (map[string]any, error) {
 	return m.definitions, nil
 }
 
+func (m *MockGekko) GetAlarms(ctx context.Context, endpoint string) (any, error) {
+	if m.alarmsErr != nil {
+		return nil, m.alarmsErr
+	}
+	return m.alarms, nil
+}
+
+func (m *MockGekko) GetGlobal(ctx context.Context, path string) (map[string]any, error) {
+	global, ok := m.globals[path]
+	if !ok {
+		return nil, errors.New("global not found")
+	}
+	return global, nil
+}
+
 func TestParseFormatField_Int(t *testing.T) {
 	field, err := parseFormatField("currentState int[0,1,2]")
 	if err != nil {
@@ -132,6 +207,144 @@ func TestParseFormatField_String(t *testing.T) {
 	}
 }
 
+func TestParseFormatField_Bool(t *testing.T) {
+	field, err := parseFormatField("alarm bool[]")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if field.Type != "bool" {
+		t.Errorf("expected type 'bool', got '%s'", field.Type)
+	}
+
+	fieldDefs := map[string][]FieldDef{"lights": {}}
+	for _, format := range []string{"state enum[off,on]", "mode enum[off,on,auto]", "level int[0,1]"} {
+		field, err := parseFormatField(format)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		fieldDefs["lights"] = append(fieldDefs["lights"], field)
+	}
+	ApplyBoolEnums(fieldDefs)
+	if got := []string{fieldDefs["lights"][0].Type, fieldDefs["lights"][1].Type, fieldDefs["lights"][2].Type}; !slices.Equal(got, []string{"bool", "int", "int"}) {
+		t.Errorf("expected only the off/on enum to become bool, got %v", got)
+	}
+}
+
+func TestBoolField_PublishAndSet(t *testing.T) {
+	var sent []string
+	mockGekko := NewMockGekko("TestGekko")
+	mockGekko.setValue = func(category, item, value string) error {
+		sent = append(sent, value)
+		return nil
+	}
+	mockMQTT := NewMockMQTT()
+	cfg := &Config{MyGekko: MyGekkoConfig{
+		SetFields:             map[string]string{"lights": "state"},
+		SuppressUnchangedSets: true,
+		ValidateSets:          true,
+	}}
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, map[string][]FieldDef{
+		"lights": {{Name: "state", Type: "bool"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bridge.processItem("lights", "item0", map[string]any{"value": "1"})
+	if v, _ := lastPublished(mockMQTT, "lights/item0/get/state"); v != true {
+		t.Errorf("expected true to be published, got %v", v)
+	}
+	if data := mockMQTT.jsonPublished[0].Data.(map[string]any); data["state"] != true {
+		t.Errorf("expected true in get/json, got %v", data)
+	}
+
+	for _, payload := range []string{"off", "true", "FALSE", "maybe"} {
+		bridge.processSetCommand("lights/item0/set", []byte(payload))
+	}
+	// "true" matches the known state and is suppressed, "maybe" is rejected
+	if !slices.Equal(sent, []string{"0", "0"}) {
+		t.Errorf("expected off and FALSE to be sent as 0, got %v", sent)
+	}
+}
+
+func TestProcessItem_DecimalComma(t *testing.T) {
+	fieldDefs := map[string][]FieldDef{"roomtemps": {{Name: "temperature", Type: "float"}}}
+
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.processItem("roomtemps", "item0", map[string]any{"value": "21,5"})
+	if _, ok := lastPublished(mockMQTT, "roomtemps/item0/get/temperature"); ok {
+		t.Error("expected a decimal comma to be rejected without decimal_comma")
+	}
+
+	mockMQTT = NewMockMQTT()
+	bridge, err = NewBridge(&Config{MyGekko: MyGekkoConfig{DecimalComma: true}}, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.processItem("roomtemps", "item0", map[string]any{"value": "21,5"})
+	if v, _ := lastPublished(mockMQTT, "roomtemps/item0/get/temperature"); v != 21.5 {
+		t.Errorf("expected 21.5, got %v", v)
+	}
+
+	for value, want := range map[string]string{"21,5": "21.5", "1,000.5": "1,000.5", "1,2,3": "1,2,3", "21.5": "21.5"} {
+		if got := decimalPoint(value); got != want {
+			t.Errorf("decimalPoint(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestProcessItem_StripUnits(t *testing.T) {
+	fieldDefs := map[string][]FieldDef{"energycosts": {{Name: "power", Type: "float"}, {Name: "total", Type: "float"}}}
+
+	// Without strip_units a unit is a parse error, logged and skipped
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.processItem("energycosts", "item0", map[string]any{"value": "45.5W;1.2e3"})
+	if _, ok := lastPublished(mockMQTT, "energycosts/item0/get/power"); ok {
+		t.Error("expected 45.5W to be rejected without strip_units")
+	}
+	if v, _ := lastPublished(mockMQTT, "energycosts/item0/get/total"); v != 1200.0 {
+		t.Errorf("expected 1200, got %v", v)
+	}
+
+	mockMQTT = NewMockMQTT()
+	bridge, err = NewBridge(&Config{MyGekko: MyGekkoConfig{StripUnits: true}}, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.processItem("energycosts", "item0", map[string]any{"value": "45.5W;1.2e3 kWh"})
+	if v, _ := lastPublished(mockMQTT, "energycosts/item0/get/power"); v != 45.5 {
+		t.Errorf("expected 45.5, got %v", v)
+	}
+	if v, _ := lastPublished(mockMQTT, "energycosts/item0/get/total"); v != 1200.0 {
+		t.Errorf("expected 1200, got %v", v)
+	}
+	data := mockMQTT.jsonPublished[0].Data.(map[string]any)
+	if data["power_unit"] != "W" || data["total_unit"] != "kWh" {
+		t.Errorf("expected the units in get/json, got %v", data)
+	}
+
+	for value, want := range map[string][2]string{
+		"45.5W":   {"45.5", "W"},
+		"1.2e3":   {"1.2e3", ""},
+		"-3.5 °C": {"-3.5", "°C"},
+		"12m2":    {"12", "m2"},
+		".5%":     {".5", "%"},
+		"W45":     {"W45", ""},
+	} {
+		if number, unit := splitUnit(value); number != want[0] || unit != want[1] {
+			t.Errorf("splitUnit(%q) = %q, %q, want %q, %q", value, number, unit, want[0], want[1])
+		}
+	}
+}
+
 func TestParseFormatField_Null(t *testing.T) {
 	field, err := parseFormatField("reserved null[]")
 	if err != nil {
@@ -223,6 +436,51 @@ func TestParseFormatField_ComplexBracketContent(t *testing.T) {
 	if field.Type != "float" {
 		t.Errorf("expected type 'float', got '%s'", field.Type)
 	}
+	if field.Unit != "°C" {
+		t.Errorf("expected unit '°C', got '%s'", field.Unit)
+	}
+}
+
+func TestParseFormatField_Unit(t *testing.T) {
+	cases := map[string]string{
+		"power float[0.0:100.0](unit:kW)": "kW",
+		"name string[](I.S.)":             "I.S.",
+		"status enum[off,on](unit:-)":     "",
+		"position int[0:100]":             "",
+	}
+	for format, want := range cases {
+		field, err := parseFormatField(format)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if field.Unit != want {
+			t.Errorf("%s: expected unit %q, got %q", format, want, field.Unit)
+		}
+	}
+
+	mockMQTT := NewMockMQTT()
+	cfg := &Config{MyGekko: MyGekkoConfig{JSONUnits: true}}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{
+		"meteo": {{Name: "temperature", Type: "float", Unit: "°C"}, {Name: "state", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.processItem("meteo", "item0", map[string]any{"value": "21.5;1"})
+
+	if len(mockMQTT.jsonPublished) != 1 {
+		t.Fatalf("expected get/json to be published, got %+v", mockMQTT.jsonPublished)
+	}
+	data := mockMQTT.jsonPublished[0].Data.(map[string]any)
+	if data["temperature_unit"] != "°C" {
+		t.Errorf("expected temperature_unit in get/json, got %v", data)
+	}
+	if _, ok := data["state_unit"]; ok {
+		t.Errorf("expected no unit key for a field without unit, got %v", data)
+	}
+	if meta := fieldsMeta(bridge.fieldDefs()["meteo"]); meta[0].Unit != "°C" {
+		t.Errorf("expected the unit in the field metadata, got %+v", meta)
+	}
 }
 
 // Integration tests using mocks
@@ -299,7 +557,7 @@ func TestProcessItem_PublishesValues(t *testing.T) {
 	for _, msg := range mockMQTT.published {
 		if msg.Topic == expectedTopic1 {
 			found1 = true
-			if msg.Value != 50 {
+			if msg.Value != int64(50) {
 				t.Errorf("expected position value 50, got %v", msg.Value)
 			}
 		}
@@ -367,6 +625,7 @@ func TestProcessItem_JSONContainsTimestamp(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	bridge.clock = func() time.Time { return time.Unix(1700000000, 0) }
 
 	sumstate := map[string]any{
 		"value": "50",
@@ -383,8 +642,8 @@ func TestProcessItem_JSONContainsTimestamp(t *testing.T) {
 		t.Fatalf("expected JSON data to be map[string]any")
 	}
 
-	if _, exists := jsonData["timestamp"]; !exists {
-		t.Error("JSON data should contain timestamp")
+	if ts := jsonData["timestamp"]; ts != int64(1700000000) {
+		t.Errorf("expected timestamp 1700000000, got %v (%T)", ts, ts)
 	}
 
 	if _, exists := jsonData["position"]; !exists {
@@ -392,6 +651,40 @@ func TestProcessItem_JSONContainsTimestamp(t *testing.T) {
 	}
 }
 
+func TestProcessItem_RFC3339Timestamp(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := &Config{MyGekko: MyGekkoConfig{TimestampFormat: "rfc3339", Timezone: "Europe/Rome", location: rome}}
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+	}
+
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Summer and winter time
+	for now, want := range map[time.Time]string{
+		time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC):  "2024-07-01T12:00:00+02:00",
+		time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC): "2024-12-01T11:00:00+01:00",
+	} {
+		mockMQTT.jsonPublished = nil
+		bridge.clock = func() time.Time { return now }
+		bridge.processItem("blinds", "item0", map[string]any{"value": fmt.Sprint(int(now.Month()))})
+
+		if len(mockMQTT.jsonPublished) != 1 {
+			t.Fatalf("expected 1 JSON published, got %d", len(mockMQTT.jsonPublished))
+		}
+		jsonData := mockMQTT.jsonPublished[0].Data.(map[string]any)
+		if ts := jsonData["timestamp"]; ts != want {
+			t.Errorf("expected timestamp %s, got %v", want, ts)
+		}
+	}
+}
+
 func TestProcessItem_SkipsEmptyValues(t *testing.T) {
 	cfg := &Config{}
 	mockGekko := NewMockGekko("TestGekko")
@@ -496,7 +789,7 @@ func TestHandleSetCommand(t *testing.T) {
 	}
 
 	// Process an incoming MQTT set command
-	bridge.processSetCommand("root/blinds/item0/set", []byte("P50"))
+	bridge.processSetCommand("blinds/item0/set", []byte("P50"))
 
 	if capturedCategory != "blinds" {
 		t.Errorf("expected category 'blinds', got '%s'", capturedCategory)
@@ -531,8 +824,8 @@ func TestCommandWorker_ProcessesMultipleCommands(t *testing.T) {
 	defer bridge.Stop()
 
 	// Two commands arriving back-to-back, as in a burst over MQTT.
-	bridge.handleSetCommand("root/blinds/item0/set", []byte("P50"))
-	bridge.handleSetCommand("root/blinds/item1/set", []byte("P75"))
+	bridge.handleSetCommand("blinds/item0/set", []byte("P50"))
+	bridge.handleSetCommand("blinds/item1/set", []byte("P75"))
 
 	var values []string
 	for range 2 {
@@ -575,7 +868,7 @@ func TestCommandWorker_ImmediatePreemptsThrottle(t *testing.T) {
 	defer bridge.Stop()
 
 	// First command goes through immediately and starts the 10s throttle window.
-	bridge.handleSetCommand("root/blinds/item0/set", []byte("P50"))
+	bridge.handleSetCommand("blinds/item0/set", []byte("P50"))
 	select {
 	case v := <-got:
 		if v != "P50" {
@@ -586,9 +879,9 @@ func TestCommandWorker_ImmediatePreemptsThrottle(t *testing.T) {
 	}
 
 	// A throttled command is now stuck behind the ~10s interval...
-	bridge.handleSetCommand("root/blinds/item0/set", []byte("P75"))
+	bridge.handleSetCommand("blinds/item0/set", []byte("P75"))
 	// ...but a STOP must preempt the throttle and arrive quickly.
-	bridge.handleSetCommand("root/blinds/item0/set", []byte("STOP"))
+	bridge.handleSetCommand("blinds/item0/set", []byte("STOP"))
 
 	select {
 	case v := <-got:
@@ -599,3 +892,1457 @@ func TestCommandWorker_ImmediatePreemptsThrottle(t *testing.T) {
 		t.Fatal("timed out: immediate STOP did not preempt the throttle wait")
 	}
 }
+
+func TestApplyFieldTypes_IntToString(t *testing.T) {
+	fieldDefs := map[string][]FieldDef{
+		"blinds": {
+			{Name: "position", Type: "int"},
+			{Name: "angle", Type: "float"},
+		},
+	}
+
+	ApplyFieldTypes(fieldDefs, map[string]map[string]string{
+		"blinds":  {"position": "string", "missing": "int"},
+		"unknown": {"position": "string"},
+	})
+
+	if fieldDefs["blinds"][0].Type != "string" {
+		t.Errorf("expected overridden type 'string', got '%s'", fieldDefs["blinds"][0].Type)
+	}
+	if fieldDefs["blinds"][1].Type != "float" {
+		t.Errorf("expected untouched type 'float', got '%s'", fieldDefs["blinds"][1].Type)
+	}
+
+	// The overridden field keeps its leading zeros
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.processItem("blinds", "item0", map[string]any{"value": "007;1.5"})
+
+	if len(mockMQTT.published) == 0 || mockMQTT.published[0].Value != "007" {
+		t.Errorf("expected position published as string '007', got %v", mockMQTT.published)
+	}
+}
+
+func TestPollCategories_ClearsRemovedItem(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{RemovalPolls: 2}}
+	mockGekko := NewMockGekko("TestGekko")
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+	}
+
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	items := map[string]any{
+		"item0": map[string]any{"sumstate": map[string]any{"value": "50"}},
+		"item1": map[string]any{"sumstate": map[string]any{"value": "75"}},
+	}
+	mockGekko.status = map[string]any{"blinds": items}
+	bridge.pollCategories([]string{"blinds"})
+
+	// item1 disappears from the controller
+	delete(items, "item1")
+
+	cleared := func() map[string]bool {
+		topics := make(map[string]bool)
+		for _, msg := range mockMQTT.published {
+			if msg.Value == "" {
+				topics[msg.Topic] = true
+			}
+		}
+		return topics
+	}
+
+	bridge.pollCategories([]string{"blinds"})
+	if len(cleared()) != 0 {
+		t.Fatalf("expected no clearing after one absence, got %v", cleared())
+	}
+
+	bridge.pollCategories([]string{"blinds"})
+	got := cleared()
+	if !got["blinds/item1/get/position"] || !got["blinds/item1/get/json"] {
+		t.Errorf("expected item1 topics to be cleared, got %v", got)
+	}
+	if got["blinds/item0/get/position"] {
+		t.Error("item0 must not be cleared")
+	}
+	if _, exists := bridge.history["blinds/item1/position"]; exists {
+		t.Error("expected history of removed item to be dropped")
+	}
+}
+
+func TestBridgeCounters(t *testing.T) {
+	cfg := &Config{}
+	mockGekko := NewMockGekko("TestGekko")
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+	}
+
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mockGekko.status = map[string]any{
+		"blinds": map[string]any{
+			"item0": map[string]any{"sumstate": map[string]any{"value": "50"}},
+		},
+	}
+	bridge.pollCategories([]string{"blinds"})
+
+	mockGekko.setValue = func(category, item, value string) error {
+		return fmt.Errorf("controller busy")
+	}
+	bridge.processSetCommand("blinds/item0/set", []byte("P50"))
+
+	if got := bridge.polls.Load(); got != 1 {
+		t.Errorf("expected 1 poll, got %d", got)
+	}
+	// position, JSON, index and category timestamp
+	if got := bridge.publishes.Load(); got != 4 {
+		t.Errorf("expected 4 publishes, got %d", got)
+	}
+	if got := bridge.setCommands.Load(); got != 1 {
+		t.Errorf("expected 1 set command, got %d", got)
+	}
+	if got := bridge.failures.Load(); got != 1 {
+		t.Errorf("expected 1 error, got %d", got)
+	}
+
+	bridge.Stop()
+}
+
+func TestProcessItem_RepublishRounds(t *testing.T) {
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{
+			RepublishRounds: map[string]map[string]int{"roomtemps": {"temperature": 2}},
+		},
+	}
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{
+		"roomtemps": {
+			{Name: "temperature", Type: "float"},
+			{Name: "setpoint", Type: "float"},
+		},
+	}
+
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sumstate := map[string]any{"value": "21.5;22.0"}
+	count := func(topic string) int {
+		n := 0
+		for _, msg := range mockMQTT.published {
+			if msg.Topic == topic {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Initial publish, then two unchanged polls: the second one republishes
+	// temperature; setpoint stays deduplicated.
+	for range 3 {
+		bridge.processItem("roomtemps", "item0", sumstate)
+	}
+	if got := count("roomtemps/item0/get/temperature"); got != 2 {
+		t.Errorf("expected temperature published 2 times, got %d", got)
+	}
+	if got := count("roomtemps/item0/get/setpoint"); got != 1 {
+		t.Errorf("expected setpoint published once, got %d", got)
+	}
+	if len(mockMQTT.jsonPublished) != 2 {
+		t.Errorf("expected JSON refreshed with the republish, got %d", len(mockMQTT.jsonPublished))
+	}
+
+	// The counter restarts after the republish
+	bridge.processItem("roomtemps", "item0", sumstate)
+	if got := count("roomtemps/item0/get/temperature"); got != 2 {
+		t.Errorf("expected no republish right after the forced one, got %d", got)
+	}
+}
+
+func TestProcessItem_AlternateValueKey(t *testing.T) {
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{
+			ValueKeys: map[string]string{"alarms": "state", "meteo": "states"},
+		},
+	}
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{
+		"alarms": {{Name: "active", Type: "int"}},
+		"meteo": {
+			{Name: "temperature", Type: "float"},
+			{Name: "wind", Type: "float"},
+		},
+	}
+
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The default key is ignored for a category with a configured key
+	bridge.processItem("alarms", "item0", map[string]any{"value": "9", "state": "1"})
+	// An array of states is treated like a semicolon-separated string
+	bridge.processItem("meteo", "item0", map[string]any{"states": []any{"12.5", 3.5}})
+
+	want := map[string]any{
+		"alarms/item0/get/active":     int64(1),
+		"meteo/item0/get/temperature": 12.5,
+		"meteo/item0/get/wind":        3.5,
+	}
+	if len(mockMQTT.published) != len(want) {
+		t.Fatalf("expected %d published, got %v", len(want), mockMQTT.published)
+	}
+	for _, msg := range mockMQTT.published {
+		if want[msg.Topic] != msg.Value {
+			t.Errorf("%s: expected %v, got %v", msg.Topic, want[msg.Topic], msg.Value)
+		}
+	}
+}
+
+func TestPollCategories_PublishSkipped(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{PublishSkipped: true}}
+	mockGekko := NewMockGekko("TestGekko")
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+	}
+
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mockGekko.status = map[string]any{
+		"blinds": map[string]any{
+			"item0":  map[string]any{"sumstate": map[string]any{"value": "50"}},
+			"item1":  map[string]any{"name": "no sumstate"},
+			"item2":  map[string]any{"sumstate": map[string]any{"other": "1"}},
+			"item3":  "not an object",
+			"group0": map[string]any{"sumstate": map[string]any{"value": "1"}},
+		},
+	}
+
+	bridge.pollCategories([]string{"blinds"})
+	bridge.pollCategories([]string{"blinds"})
+
+	var counts []any
+	for _, msg := range mockMQTT.published {
+		if msg.Topic == "blinds/get/skipped" {
+			counts = append(counts, msg.Value)
+		}
+	}
+	if len(counts) != 2 || counts[0] != 4 {
+		t.Errorf("expected skipped count 4 on every poll, got %v", counts)
+	}
+
+	var lists []map[string]string
+	for _, msg := range mockMQTT.jsonPublished {
+		if msg.Topic == "blinds/get/skipped_items" {
+			lists = append(lists, msg.Data.(map[string]string))
+		}
+	}
+	if len(lists) != 1 {
+		t.Fatalf("expected skipped items published once, got %d", len(lists))
+	}
+	want := map[string]string{
+		"item1":  "no sumstate",
+		"item2":  "sumstate has no value",
+		"item3":  "item is not an object",
+		"group0": "group",
+	}
+	for item, reason := range want {
+		if lists[0][item] != reason {
+			t.Errorf("%s: expected reason %q, got %q", item, reason, lists[0][item])
+		}
+	}
+}
+
+func TestProcessItem_MaxFields(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{MaxFields: 2}}
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{
+		"blinds": {
+			{Name: "position", Type: "int"},
+			{Name: "angle", Type: "float"},
+			{Name: "state", Type: "int"},
+		},
+	}
+
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// An oversized value string: only the first two fields are processed
+	value := "50;45.5;1" + strings.Repeat(";9", 100000)
+	bridge.processItem("blinds", "item0", map[string]any{"value": value})
+
+	if len(mockMQTT.published) != 2 {
+		t.Errorf("expected 2 published (truncated), got %d", len(mockMQTT.published))
+	}
+	for _, msg := range mockMQTT.published {
+		if msg.Topic == "blinds/item0/get/state" {
+			t.Error("field beyond max_fields must not be published")
+		}
+	}
+}
+
+func TestProcessItem_NumericAndMissingValue(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{
+		"meteo":  {{Name: "temperature", Type: "float"}},
+		"lights": {{Name: "state", Type: "int"}},
+		"alarms": {{Name: "state", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	// JSON numbers decode to float64
+	if err := bridge.processItem("meteo", "item0", map[string]any{"value": 12.5}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := lastPublished(mockMQTT, "meteo/item0/get/temperature"); got != 12.5 {
+		t.Errorf("expected temperature 12.5, got %v", got)
+	}
+	if err := bridge.processItem("lights", "item0", map[string]any{"value": float64(1)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := lastPublished(mockMQTT, "lights/item0/get/state"); got != int64(1) {
+		t.Errorf("expected state 1, got %v", got)
+	}
+
+	// Without "value", the known state key is used
+	if err := bridge.processItem("alarms", "item0", map[string]any{"state": "2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := lastPublished(mockMQTT, "alarms/item0/get/state"); got != int64(2) {
+		t.Errorf("expected state 2 from the fallback key, got %v", got)
+	}
+
+	err = bridge.processItem("lights", "item1", map[string]any{"other": "1"})
+	if err == nil || err.Error() != "sumstate has no value" {
+		t.Errorf("expected a skip for a missing value, got %v", err)
+	}
+	err = bridge.processItem("lights", "item1", map[string]any{"value": map[string]any{}})
+	if err == nil || err.Error() != "sumstate has no value" {
+		t.Errorf("expected a skip for an unparseable value, got %v", err)
+	}
+}
+
+func TestProcessItem_Int64(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{HistoryFile: filepath.Join(t.TempDir(), "history.json")}}
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{
+		"energycosts": {{Name: "counter", Type: "int"}, {Name: "delta", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Above 2^53, where a float64 would lose the last digit
+	bridge.processItem("energycosts", "item0", map[string]any{"value": "9007199254740993;-12"})
+	if got, _ := lastPublished(mockMQTT, "energycosts/item0/get/counter"); got != int64(9007199254740993) || fmt.Sprint(got) != "9007199254740993" {
+		t.Errorf("expected counter 9007199254740993, got %v", got)
+	}
+	if got, _ := lastPublished(mockMQTT, "energycosts/item0/get/delta"); got != int64(-12) {
+		t.Errorf("expected delta -12, got %v", got)
+	}
+	data, err := json.Marshal(mockMQTT.jsonPublished[0].Data)
+	if err != nil || !strings.Contains(string(data), `"counter":9007199254740993`) {
+		t.Errorf("expected the exact counter in get/json, got %s (%v)", data, err)
+	}
+
+	// The value survives the history file
+	bridge.Stop()
+	entry := loadHistory(cfg.MyGekko.HistoryFile)["energycosts/item0/counter"]
+	if entry.value != int64(9007199254740993) {
+		t.Errorf("expected the exact counter from the history file, got %v (%T)", entry.value, entry.value)
+	}
+}
+
+func TestProcessSetCommand_SuppressUnchanged(t *testing.T) {
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{
+			SuppressUnchangedSets: true,
+			SetFields:             map[string]string{"lights": "state", "actions": "state"},
+			AlwaysSend:            []string{"actions"},
+		},
+	}
+	mockMQTT := NewMockMQTT()
+
+	var sent []string
+	mockGekko := NewMockGekko("TestGekko")
+	mockGekko.setValue = func(category, item, value string) error {
+		sent = append(sent, category+"="+value)
+		return nil
+	}
+
+	fieldDefs := map[string][]FieldDef{
+		"lights":  {{Name: "state", Type: "int"}},
+		"actions": {{Name: "state", Type: "int"}},
+	}
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.processItem("lights", "item0", map[string]any{"value": "1"})
+	bridge.processItem("actions", "item0", map[string]any{"value": "1"})
+
+	bridge.processSetCommand("lights/item0/set", []byte("1"))  // unchanged: suppressed
+	bridge.processSetCommand("lights/item0/set", []byte("0"))  // changed: sent
+	bridge.processSetCommand("lights/item1/set", []byte("1"))  // unknown item: sent
+	bridge.processSetCommand("actions/item0/set", []byte("1")) // trigger: always sent
+
+	want := []string{"lights=0", "lights=1", "actions=1"}
+	if !slices.Equal(sent, want) {
+		t.Errorf("expected sent commands %v, got %v", want, sent)
+	}
+}
+
+func TestValueMatches(t *testing.T) {
+	cases := []struct {
+		known   any
+		payload string
+		want    bool
+	}{
+		{int64(50), "50", true},
+		{int64(50), "50.0", true},
+		{21.5, "21.50", true},
+		{21.5, "21.6", false},
+		{"auto", "auto", true},
+		{"auto", "off", false},
+		{int64(50), "P50", false},
+	}
+	for _, tc := range cases {
+		if got := valueMatches(tc.known, tc.payload); got != tc.want {
+			t.Errorf("valueMatches(%v, %q): expected %v, got %v", tc.known, tc.payload, tc.want, got)
+		}
+	}
+}
+
+func TestHandleLogLevel(t *testing.T) {
+	SetupLogger("INFO", "text")
+	t.Cleanup(func() { SetupLogger("INFO", "text") })
+
+	b := &Bridge{}
+	b.handleLogLevel("bridge/log_level", []byte("debug"))
+	if got := logLevel.Level(); got != slog.LevelDebug {
+		t.Fatalf("expected DEBUG after change, got %v", got)
+	}
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("expected default logger to emit debug records")
+	}
+
+	b.handleLogLevel("bridge/log_level", []byte("LOUD"))
+	if got := logLevel.Level(); got != slog.LevelDebug {
+		t.Errorf("expected invalid level to be ignored, got %v", got)
+	}
+
+	b.handleLogLevel("bridge/log_level", []byte("WARN"))
+	if slog.Default().Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("expected info records to be dropped at WARN")
+	}
+}
+
+func TestSubscribe_LogLevelAlias(t *testing.T) {
+	SetupLogger("INFO", "text")
+	t.Cleanup(func() { SetupLogger("INFO", "text") })
+
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := bridge.Subscribe(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mockMQTT.deliver("cmd/loglevel", []byte("DEBUG"))
+	if got := logLevel.Level(); got != slog.LevelDebug {
+		t.Errorf("expected DEBUG after a cmd/loglevel message, got %v", got)
+	}
+}
+
+func TestNewLogHandler_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(newLogHandler(&buf, "json"))
+	logger.Error("Failed to publish", "topic", "blinds/item0/get/json", "error", fmt.Errorf("not connected"))
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a JSON record, got %q: %v", buf.String(), err)
+	}
+	for key, want := range map[string]string{
+		"level": "ERROR",
+		"msg":   "Failed to publish",
+		"topic": "blinds/item0/get/json",
+		"error": "not connected",
+	} {
+		if record[key] != want {
+			t.Errorf("expected %s %q, got %v", key, want, record[key])
+		}
+	}
+}
+
+func TestHandlePoll(t *testing.T) {
+	mockGekko := NewMockGekko("TestGekko")
+	polled := make(chan string, 16)
+	mockGekko.getStatus = func(categories []string) (map[string]any, error) {
+		polled <- categories[0]
+		return map[string]any{}, nil
+	}
+	cfg := &Config{MyGekko: MyGekkoConfig{Interval: 3600, IntervalItems: []string{"blinds"}, MainItems: []string{"lights"}, IntervalRounds: 4}}
+	fieldDefs := map[string][]FieldDef{"blinds": {}, "lights": {}}
+	bridge, err := NewBridge(cfg, mockGekko, NewMockMQTT(), fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	go bridge.RunGetter()
+	defer bridge.Stop()
+
+	next := func() string {
+		select {
+		case category := <-polled:
+			return category
+		case <-time.After(2 * time.Second):
+			return "timeout"
+		}
+	}
+	// Initial poll
+	next()
+	next()
+
+	bridge.handlePoll("bridge/poll", []byte("unknown"))
+	bridge.handlePoll("bridge/poll", []byte("lights"))
+	if got := next(); got != "lights" {
+		t.Errorf("expected lights to be polled, got %s", got)
+	}
+
+	bridge.handlePoll("bridge/poll", nil)
+	if got := []string{next(), next()}; !slices.Equal(got, []string{"blinds", "lights"}) {
+		t.Errorf("expected all categories to be polled, got %v", got)
+	}
+}
+
+func TestRunGetter_CategoryIntervals(t *testing.T) {
+	mockGekko := NewMockGekko("TestGekko")
+	polled := make(chan string, 64)
+	mockGekko.getStatus = func(categories []string) (map[string]any, error) {
+		polled <- categories[0]
+		return map[string]any{}, nil
+	}
+	cfg := &Config{MyGekko: MyGekkoConfig{
+		Interval:          3600,
+		IntervalItems:     []string{"blinds"},
+		MainItems:         []string{"lights", "meteo"},
+		IntervalRounds:    4,
+		CategoryIntervals: map[string]float64{"meteo": 0.02},
+	}}
+	fieldDefs := map[string][]FieldDef{"blinds": {}, "lights": {}, "meteo": {}}
+	bridge, err := NewBridge(cfg, mockGekko, NewMockMQTT(), fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	go bridge.RunGetter()
+
+	counts := map[string]int{}
+	timeout := time.After(2 * time.Second)
+	for counts["meteo"] < 4 {
+		select {
+		case category := <-polled:
+			counts[category]++
+		case <-timeout:
+			t.Fatalf("expected meteo to be polled on its own interval, got %v", counts)
+		}
+	}
+	bridge.Stop()
+	if counts["blinds"] != 1 || counts["lights"] != 1 {
+		t.Errorf("expected blinds and lights polled once, got %v", counts)
+	}
+
+	// The tickers stop with the bridge
+	time.Sleep(50 * time.Millisecond)
+	for len(polled) > 0 {
+		<-polled
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := len(polled); n != 0 {
+		t.Errorf("expected no polls after stop, got %d", n)
+	}
+}
+
+func TestParseItemInfo(t *testing.T) {
+	definitions := map[string]any{
+		"lights": map[string]any{
+			"item0": map[string]any{
+				"name":     "Ceiling",
+				"page":     "Living room",
+				"sumstate": map[string]any{"format": "state[0=Off|1=On]"},
+			},
+			"item1": map[string]any{"name": "Hallway"},
+			"item2": map[string]any{"name": "Garage", "room": "Garage"},
+			"group": map[string]any{"name": "not an item"},
+		},
+		"globals": "ignored",
+	}
+
+	info := ParseItemInfo(definitions)
+
+	if got := info["lights"]["item0"]; got != (ItemInfo{Name: "Ceiling", Page: "Living room"}) {
+		t.Errorf("unexpected item0 info: %+v", got)
+	}
+	if got := info["lights"]["item1"]; got != (ItemInfo{Name: "Hallway"}) {
+		t.Errorf("expected item1 without page, got %+v", got)
+	}
+	if got := info["lights"]["item2"].Page; got != "Garage" {
+		t.Errorf("expected room key to be used as page, got %q", got)
+	}
+	if _, ok := info["lights"]["group"]; ok {
+		t.Error("expected non-item entries to be ignored")
+	}
+	if len(info) != 1 {
+		t.Errorf("expected only the lights category, got %v", info)
+	}
+
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT,
+		map[string][]FieldDef{"lights": {{Name: "state", Type: "int"}}}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.SetItemInfo(info)
+	bridge.publishItemInfo()
+
+	found := false
+	for _, msg := range mockMQTT.jsonPublished {
+		if msg.Topic == "lights/item0/meta" {
+			meta, ok := msg.Data.(itemMeta)
+			found = ok && meta.ItemInfo == ItemInfo{Name: "Ceiling", Page: "Living room"} &&
+				len(meta.Fields) == 1 && meta.Fields[0].Name == "state" && meta.Fields[0].Type == "int"
+		}
+	}
+	if !found {
+		t.Errorf("expected lights/item0/meta to be published, got %+v", mockMQTT.jsonPublished)
+	}
+}
+
+func TestLoadFieldDefinitions(t *testing.T) {
+	gekko := NewMockGekko("TestGekko")
+	gekko.definitions = map[string]any{
+		"blinds": map[string]any{
+			"item0": map[string]any{
+				"name":     "Kitchen",
+				"page":     "Ground floor",
+				"sumstate": map[string]any{"format": "state enum[down,stop,up];position float[0.0:100.0];reserved null[]"},
+			},
+		},
+		"vents": map[string]any{
+			"item0": map[string]any{"sumstate": map[string]any{"format": ""}},
+		},
+		"globals": "ignored",
+	}
+
+	fieldDefs, itemInfo, err := LoadFieldDefinitions(context.Background(), gekko)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	blinds := fieldDefs["blinds"]
+	// The reserved field is kept untyped to preserve the field positions
+	if len(blinds) != 3 || blinds[0].Name != "state" || !slices.Equal(blinds[0].EnumValues, []string{"down", "stop", "up"}) ||
+		blinds[1].Name != "position" || blinds[1].Type != "float" || blinds[2].Type != "" {
+		t.Errorf("unexpected blinds definitions: %+v", blinds)
+	}
+	if _, ok := fieldDefs["vents"]; ok {
+		t.Error("expected a category without parseable fields to be skipped")
+	}
+	if got := itemInfo["blinds"]["item0"]; got != (ItemInfo{Name: "Kitchen", Page: "Ground floor"}) {
+		t.Errorf("unexpected item info: %+v", got)
+	}
+}
+
+func TestProcessItem_BadFieldDoesNotStopItem(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{
+		"roomtemps": {{Name: "temperature", Type: "float"}, {Name: "mode", Type: "int"}},
+	}
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := bridge.processItem("roomtemps", "item0", map[string]any{"value": "warm;2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := lastPublished(mockMQTT, "roomtemps/item0/get/temperature"); ok {
+		t.Error("expected unparsable field not to be published")
+	}
+	if value, ok := lastPublished(mockMQTT, "roomtemps/item0/get/mode"); !ok || value != int64(2) {
+		t.Errorf("expected mode to be published despite bad temperature, got %v", value)
+	}
+	if got := bridge.failures.Load(); got != 1 {
+		t.Errorf("expected 1 failure, got %d", got)
+	}
+}
+
+func TestProcessItem_RetriesFailedPublish(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{"lights": {{Name: "state", Type: "int"}}}
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mockMQTT.publishErr = fmt.Errorf("not connected")
+	bridge.processItem("lights", "item0", map[string]any{"value": "1"})
+
+	mockMQTT.publishErr = nil
+	bridge.processItem("lights", "item0", map[string]any{"value": "1"})
+	if _, ok := lastPublished(mockMQTT, "lights/item0/get/state"); !ok {
+		t.Error("expected unchanged value to be republished after a failed publish")
+	}
+}
+
+func TestPollCategories_Index(t *testing.T) {
+	cfg := &Config{}
+	mockGekko := NewMockGekko("TestGekko")
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+	}
+
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+	bridge.SetItemInfo(map[string]map[string]ItemInfo{
+		"blinds": {"item10": {Name: "Kitchen", Page: "Ground floor"}},
+	})
+
+	items := map[string]any{
+		"item10": map[string]any{"sumstate": map[string]any{"value": "50"}},
+		"item2":  map[string]any{"sumstate": map[string]any{"value": "20"}},
+	}
+	mockGekko.status = map[string]any{"blinds": items}
+	bridge.pollCategories([]string{"blinds"})
+	bridge.pollCategories([]string{"blinds"})
+	delete(items, "item2")
+	bridge.pollCategories([]string{"blinds"})
+
+	var indexes [][]indexEntry
+	for _, msg := range mockMQTT.jsonPublished {
+		if msg.Topic == "blinds/index" {
+			indexes = append(indexes, msg.Data.([]indexEntry))
+		}
+	}
+	if len(indexes) != 2 {
+		t.Fatalf("expected index published on change only, got %d", len(indexes))
+	}
+	want := []indexEntry{
+		{Item: "item2", Topic: "item2"},
+		{Item: "item10", Topic: "item10", Name: "Kitchen", Page: "Ground floor"},
+	}
+	if !slices.Equal(indexes[0], want) {
+		t.Errorf("expected %+v, got %+v", want, indexes[0])
+	}
+	if len(indexes[1]) != 1 || indexes[1][0].Item != "item10" {
+		t.Errorf("expected index with item10 only, got %+v", indexes[1])
+	}
+}
+
+func TestPollCategories_FailedCategoryDoesNotStopOthers(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	mockGekko := NewMockGekko("TestGekko")
+	mockGekko.status = map[string]any{
+		"lights": map[string]any{"item0": map[string]any{"sumstate": map[string]any{"value": "1"}}},
+	}
+	mockGekko.statusErr = map[string]error{"blinds": fmt.Errorf("connection refused")}
+	fieldDefs := map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+		"lights": {{Name: "state", Type: "int"}},
+	}
+	bridge, err := NewBridge(&Config{}, mockGekko, mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = bridge.pollCategories([]string{"blinds", "lights"})
+	if err == nil || !strings.Contains(err.Error(), "blinds") {
+		t.Errorf("expected error for blinds, got %v", err)
+	}
+	if _, ok := lastPublished(mockMQTT, "lights/item0/get/state"); !ok {
+		t.Error("expected lights to be polled after blinds failed")
+	}
+
+	_ = bridge.pollCategories([]string{"blinds", "lights"})
+	if h := bridge.health["blinds"]; h.failures != 2 || !h.lastSuccess.IsZero() {
+		t.Errorf("expected two failures of blinds, got %+v", h)
+	}
+	if h := bridge.health["lights"]; h.failures != 0 || h.lastSuccess.IsZero() {
+		t.Errorf("expected lights to be healthy, got %+v", h)
+	}
+
+	mockGekko.statusErr = nil
+	_ = bridge.pollCategories([]string{"blinds"})
+	if h := bridge.health["blinds"]; h.failures != 0 || h.lastSuccess.IsZero() {
+		t.Errorf("expected blinds to recover, got %+v", h)
+	}
+}
+
+func TestPollCategories_BulkStatus(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	mockGekko := NewMockGekko("TestGekko")
+	var requests [][]string
+	mockGekko.getStatus = func(categories []string) (map[string]any, error) {
+		requests = append(requests, categories)
+		return map[string]any{
+			"blinds":  map[string]any{"item0": map[string]any{"sumstate": map[string]any{"value": "50"}}},
+			"lights":  map[string]any{"item0": map[string]any{"sumstate": map[string]any{"value": "1"}}},
+			"globals": map[string]any{},
+		}, nil
+	}
+	cfg := &Config{MyGekko: MyGekkoConfig{BulkStatus: true}}
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+		"lights": {{Name: "state", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := bridge.pollCategories([]string{"blinds", "lights"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 1 || requests[0] != nil {
+		t.Errorf("expected a single request for all categories, got %v", requests)
+	}
+	for _, topic := range []string{"blinds/item0/get/position", "lights/item0/get/state"} {
+		if _, ok := lastPublished(mockMQTT, topic); !ok {
+			t.Errorf("expected %s to be published", topic)
+		}
+	}
+
+	mockGekko.getStatus = func(categories []string) (map[string]any, error) {
+		return nil, fmt.Errorf("connection refused")
+	}
+	if err := bridge.pollCategories([]string{"blinds", "lights"}); err == nil {
+		t.Error("expected error for a failed bulk request")
+	}
+	if bridge.health["blinds"].failures != 1 || bridge.health["lights"].failures != 1 {
+		t.Errorf("expected both categories to be marked failed, got %+v %+v", bridge.health["blinds"], bridge.health["lights"])
+	}
+}
+
+func TestPollCategories_RetriesTransientErrors(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	mockGekko := NewMockGekko("TestGekko")
+	status := map[string]any{
+		"lights": map[string]any{"item0": map[string]any{"sumstate": map[string]any{"value": "1"}}},
+	}
+	calls, failing := 0, 2
+	mockGekko.getStatus = func(categories []string) (map[string]any, error) {
+		calls++
+		if calls <= failing {
+			return nil, fmt.Errorf("connection reset by peer")
+		}
+		return status, nil
+	}
+	cfg := &Config{MyGekko: MyGekkoConfig{RetryAttempts: 3, RetryDelay: 0.001}}
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, map[string][]FieldDef{"lights": {{Name: "state", Type: "int"}}}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := bridge.pollCategories([]string{"lights"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+	if _, ok := lastPublished(mockMQTT, "lights/item0/get/state"); !ok {
+		t.Error("expected lights to be published after a retry")
+	}
+
+	calls, failing = 0, 5
+	if err := bridge.pollCategories([]string{"lights"}); err == nil {
+		t.Error("expected error after exhausting the retries")
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestPollCategories_NoRetryOnPermanentError(t *testing.T) {
+	mockGekko := NewMockGekko("TestGekko")
+	calls := 0
+	mockGekko.getStatus = func(categories []string) (map[string]any, error) {
+		calls++
+		return nil, fmt.Errorf("failed to get lights: %w", &httpStatusError{code: 401})
+	}
+	cfg := &Config{MyGekko: MyGekkoConfig{RetryAttempts: 5, RetryDelay: 0.001}}
+	bridge, err := NewBridge(cfg, mockGekko, NewMockMQTT(), map[string][]FieldDef{}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := bridge.pollCategories([]string{"lights"}); err == nil {
+		t.Error("expected error for 401")
+	}
+	if calls != 1 {
+		t.Errorf("expected a single attempt for a permanent error, got %d", calls)
+	}
+}
+
+func TestParseFormatField_EnumValues(t *testing.T) {
+	cases := map[string][]string{
+		"status enum[off,on,auto]":         {"off", "on", "auto"},
+		"status enum[0=off,1=on](unit:-)":  {"off", "on"},
+		"status enum[-1=error,0=off,1=on]": nil,
+		"status enum[]":                    nil,
+	}
+	for format, want := range cases {
+		field, err := parseFormatField(format)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if !slices.Equal(field.EnumValues, want) {
+			t.Errorf("%s: expected %v, got %v", format, want, field.EnumValues)
+		}
+	}
+}
+
+func TestEnumLabels_RoundTrip(t *testing.T) {
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{
+			EnumLabels: true,
+			SetFields:  map[string]string{"vents": "mode"},
+		},
+	}
+	mockMQTT := NewMockMQTT()
+	mockGekko := NewMockGekko("TestGekko")
+	var sent string
+	mockGekko.setValue = func(category, item, value string) error {
+		sent = value
+		return nil
+	}
+	fieldDefs := map[string][]FieldDef{
+		"vents": {{Name: "mode", Type: "int", EnumValues: []string{"off", "on", "auto"}}, {Name: "level", Type: "int"}},
+	}
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bridge.processItem("vents", "item0", map[string]any{"value": "2;3"})
+
+	if value, _ := lastPublished(mockMQTT, "vents/item0/get/mode"); value != "auto" {
+		t.Errorf("expected label 'auto', got %v", value)
+	}
+	if value, _ := lastPublished(mockMQTT, "vents/item0/get/level"); value != int64(3) {
+		t.Errorf("expected plain int field to stay numeric, got %v", value)
+	}
+	data := mockMQTT.jsonPublished[len(mockMQTT.jsonPublished)-1].Data.(map[string]any)
+	if data["mode"] != "auto" || data["mode_raw"] != int64(2) {
+		t.Errorf("expected label and raw value in JSON, got %v", data)
+	}
+
+	bridge.processSetCommand("vents/item0/set", []byte("On"))
+	if sent != "1" {
+		t.Errorf("expected label to be mapped back to index 1, got %q", sent)
+	}
+	bridge.processSetCommand("vents/item0/set", []byte("2"))
+	if sent != "2" {
+		t.Errorf("expected raw index to pass through, got %q", sent)
+	}
+}
+
+// Run with -race: the getter writes the history while the setter reads it.
+func TestHistory_ConcurrentAccess(t *testing.T) {
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{
+			SetFields:             map[string]string{"lights": "state"},
+			SuppressUnchangedSets: true,
+		},
+	}
+	fieldDefs := map[string][]FieldDef{"lights": {{Name: "state", Type: "int"}}}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), NewMockMQTT(), fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range 1000 {
+			bridge.processItem("lights", "item0", map[string]any{"value": strconv.Itoa(i % 2)})
+			if i%100 == 0 {
+				bridge.dropHistory("lights", "item0")
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 1000 {
+			bridge.lastValue("lights", "item0", "state")
+			bridge.isUnchangedSet("lights", "item0", "1")
+		}
+	}()
+	wg.Wait()
+}
+
+func TestProcessItem_RepublishInterval(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{RepublishInterval: 60}}
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{"lights": {{Name: "state", Type: "int"}}}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sumstate := map[string]any{"value": "1"}
+	bridge.processItem("lights", "item0", sumstate)
+	bridge.processItem("lights", "item0", sumstate)
+	if len(mockMQTT.published) != 1 || len(mockMQTT.jsonPublished) != 1 {
+		t.Fatalf("expected unchanged value to be deduplicated within the interval, got %v", mockMQTT.published)
+	}
+
+	// Pretend the last publish was longer ago than the interval
+	bridge.historyMu.Lock()
+	entry := bridge.history["lights/item0/state"]
+	entry.published = entry.published.Add(-61 * time.Second)
+	bridge.history["lights/item0/state"] = entry
+	bridge.historyMu.Unlock()
+
+	bridge.processItem("lights", "item0", sumstate)
+	if len(mockMQTT.published) != 2 || len(mockMQTT.jsonPublished) != 2 {
+		t.Errorf("expected value and JSON to be republished after the interval, got %v", mockMQTT.published)
+	}
+}
+
+func TestEvictHistory(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{HistoryTTL: 60}}
+	fieldDefs := map[string][]FieldDef{"lights": {{Name: "state", Type: "int"}}}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), NewMockMQTT(), fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bridge.processItem("lights", "item0", map[string]any{"value": "1"})
+	bridge.processItem("lights", "item1", map[string]any{"value": "0"})
+
+	bridge.evictHistory(time.Now().Add(30 * time.Second))
+	if _, ok := bridge.lastValue("lights", "item0", "state"); !ok {
+		t.Fatal("expected entry to be kept within the TTL")
+	}
+
+	// item1 is polled again later, item0 vanished
+	later := time.Now().Add(90 * time.Second)
+	bridge.historyMu.Lock()
+	entry := bridge.history["lights/item1/state"]
+	entry.seen = later
+	bridge.history["lights/item1/state"] = entry
+	bridge.historyMu.Unlock()
+
+	bridge.evictHistory(later)
+	if _, ok := bridge.lastValue("lights", "item0", "state"); ok {
+		t.Error("expected entry not polled within the TTL to be evicted")
+	}
+	if _, ok := bridge.lastValue("lights", "item1", "state"); !ok {
+		t.Error("expected recently polled entry to be kept")
+	}
+}
+
+func TestProcessItem_ScaleAndOffset(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{
+		Scale:  map[string]map[string]float64{"energycosts": {"energy": 0.001}},
+		Offset: map[string]map[string]float64{"energycosts": {"temperature": -0.5, "name": 1}},
+	}}
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{"energycosts": {
+		{Name: "energy", Type: "int"},
+		{Name: "temperature", Type: "float"},
+		{Name: "name", Type: "string"},
+	}}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.processItem("energycosts", "item0", map[string]any{"value": "12500;21.5;PV"})
+
+	if v, _ := lastPublished(mockMQTT, "energycosts/item0/get/energy"); v != 12.5 {
+		t.Errorf("expected scaled energy 12.5, got %v", v)
+	}
+	if v, _ := lastPublished(mockMQTT, "energycosts/item0/get/temperature"); v != 21.0 {
+		t.Errorf("expected offset temperature 21.0, got %v", v)
+	}
+	if v, _ := lastPublished(mockMQTT, "energycosts/item0/get/name"); v != "PV" {
+		t.Errorf("expected a string field to stay untouched, got %v", v)
+	}
+
+	data := mockMQTT.jsonPublished[0].Data.(map[string]any)
+	if data["energy"] != 12.5 || data["energy_raw"] != int64(12500) || data["temperature_raw"] != 21.5 {
+		t.Errorf("expected scaled values with the raw ones in get/json, got %v", data)
+	}
+	if _, ok := data["name_raw"]; ok {
+		t.Errorf("expected no raw value of an unscaled field, got %v", data)
+	}
+}
+
+func TestProcessItem_Deadband(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{
+		Deadband: map[string]map[string]float64{"roomtemps": {"temperature": 0.2, "mode": 5}},
+	}}
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{"roomtemps": {
+		{Name: "temperature", Type: "float"},
+		{Name: "mode", Type: "int"},
+	}}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	count := func(topic string) int {
+		n := 0
+		for _, p := range mockMQTT.published {
+			if p.Topic == topic {
+				n++
+			}
+		}
+		return n
+	}
+
+	for _, value := range []string{"21.0;1", "21.1;2", "21.2;2", "21.25;2"} {
+		bridge.processItem("roomtemps", "item0", map[string]any{"value": value})
+	}
+
+	// 21.1 and 21.2 are within 0.2 of the published 21.0, 21.25 is not
+	if got := count("roomtemps/item0/get/temperature"); got != 2 {
+		t.Errorf("expected 2 temperature publishes, got %d", got)
+	}
+	if v, _ := lastPublished(mockMQTT, "roomtemps/item0/get/temperature"); v != 21.25 {
+		t.Errorf("expected 21.25 to be published, got %v", v)
+	}
+	// The deadband does not apply to ints
+	if got := count("roomtemps/item0/get/mode"); got != 2 {
+		t.Errorf("expected 2 mode publishes, got %d", got)
+	}
+}
+
+func TestProcessItem_PublishRaw(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{PublishRaw: true}}
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{"blinds": {{Name: "position", Type: "int"}}}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bridge.processItem("blinds", "item0", map[string]any{"value": "50;45.5;x"})
+	bridge.processItem("blinds", "item0", map[string]any{"value": "50;45.5;x"})
+
+	raw := 0
+	for _, p := range mockMQTT.published {
+		if p.Topic == "blinds/item0/get/raw" {
+			raw++
+			if p.Value != "50;45.5;x" {
+				t.Errorf("expected raw value string, got %v", p.Value)
+			}
+		}
+	}
+	if raw != 1 {
+		t.Errorf("expected the raw value to be published once, got %d", raw)
+	}
+}
+
+func TestFieldsMeta(t *testing.T) {
+	var fields []FieldDef
+	for _, format := range []string{"state enum[off,on]", "position float[0.0:100.0]", "mode int[0,1,2]", "reserved null[]"} {
+		field, err := parseFormatField(format)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", format, err)
+		}
+		fields = append(fields, field)
+	}
+
+	data, err := json.Marshal(fieldsMeta(fields))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `[{"name":"state","type":"int","enum":["off","on"]},` +
+		`{"name":"position","type":"float","min":0,"max":100},` +
+		`{"name":"mode","type":"int","allowed":["0","1","2"]}]`
+	if string(data) != want {
+		t.Errorf("expected %s, got %s", want, data)
+	}
+}
+
+func TestProcessSetCommand_DryRun(t *testing.T) {
+	called := false
+	mockGekko := NewMockGekko("TestGekko")
+	mockGekko.setValue = func(category, item, value string) error {
+		called = true
+		return nil
+	}
+	mockMQTT := NewMockMQTT()
+	cfg := &Config{MyGekko: MyGekkoConfig{DryRun: true, ConfirmSets: true}}
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, map[string][]FieldDef{"blinds": {{Name: "position", Type: "int"}}}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bridge.processSetCommand("blinds/item0/set", []byte("P50"))
+
+	if called {
+		t.Error("expected no set command to be sent in a dry run")
+	}
+	if len(mockMQTT.jsonPublished) != 1 || mockMQTT.jsonPublished[0].Topic != "blinds/item0/set/result" ||
+		mockMQTT.jsonPublished[0].Data != (setResult{Value: "P50", DryRun: true}) || !mockMQTT.jsonPublished[0].Transient {
+		t.Errorf("expected a dry run result, got %+v", mockMQTT.jsonPublished)
+	}
+}
+
+func TestSubscribe_ReadOnly(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	cfg := &Config{MyGekko: MyGekkoConfig{ReadOnly: true}}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+		"lights": {{Name: "state", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := bridge.Subscribe(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(mockMQTT.subscriptions, []string{"bridge/poll", "bridge/log_level", "cmd/loglevel"}) {
+		t.Errorf("expected only the control topics to be subscribed, got %v", mockMQTT.subscriptions)
+	}
+}
+
+func TestParseSetTopic(t *testing.T) {
+	valid := map[string][2]string{
+		"blinds/item0/set":        {"blinds", "item0"},
+		"heating/zones/item3/set": {"heating/zones", "item3"},
+	}
+	for topic, want := range valid {
+		category, item, err := parseSetTopic(topic)
+		if err != nil || category != want[0] || item != want[1] {
+			t.Errorf("parseSetTopic(%q) = %q, %q, %v; want %q, %q", topic, category, item, err, want[0], want[1])
+		}
+	}
+	for _, topic := range []string{"blinds/item0/get", "item0/set", "/item0/set", "blinds//set", "set"} {
+		if _, _, err := parseSetTopic(topic); err == nil {
+			t.Errorf("expected error for %q", topic)
+		}
+	}
+}
+
+func TestParseCmdTopic(t *testing.T) {
+	valid := map[string][3]string{
+		"blinds/item0/cmd/stop":            {"blinds", "item0", "stop"},
+		"heating/zones/item3/cmd/boost_on": {"heating/zones", "item3", "boost_on"},
+	}
+	for topic, want := range valid {
+		category, item, command, err := parseCmdTopic(topic)
+		if err != nil || category != want[0] || item != want[1] || command != want[2] {
+			t.Errorf("parseCmdTopic(%q) = %q, %q, %q, %v; want %v", topic, category, item, command, err, want)
+		}
+	}
+	for _, topic := range []string{"blinds/item0/set", "blinds/item0/cmd/", "blinds/item0/cmd/set", "blinds/item0/cmd/Stop", "item0/cmd/stop"} {
+		if _, _, _, err := parseCmdTopic(topic); err == nil {
+			t.Errorf("expected error for %q", topic)
+		}
+	}
+}
+
+func TestCommand_SendsScmdVerb(t *testing.T) {
+	mockGekko := NewMockGekko("TestGekko")
+	var sent []string
+	mockGekko.sendCommand = func(category, item, command, value string) error {
+		sent = append(sent, fmt.Sprintf("%s/%s/%s=%s", category, item, command, value))
+		return nil
+	}
+	cfg := &Config{MyGekko: MyGekkoConfig{ThrottlePrefixes: map[string][]string{"blinds": {"P"}}}}
+	bridge, err := NewBridge(cfg, mockGekko, NewMockMQTT(), map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	bridge.handleCommand("blinds/item0/cmd/stop", nil)
+	bridge.handleCommand("blinds/item0/cmd/set", []byte("P50"))
+	if got := len(bridge.immediateQueue); got != 1 {
+		t.Fatalf("expected 1 queued command, got %d", got)
+	}
+	cmd := <-bridge.immediateQueue
+	if cmd.command != "stop" {
+		t.Errorf("expected stop command, got %q", cmd.command)
+	}
+
+	bridge.processCommand(cmd.topic, cmd.payload)
+	if !slices.Equal(sent, []string{"blinds/item0/stop="}) {
+		t.Errorf("expected stop sent to MyGEKKO, got %v", sent)
+	}
+}
+
+func TestProcessCommand_ErrorAndDryRun(t *testing.T) {
+	mockGekko := NewMockGekko("TestGekko")
+	mockGekko.sendCommand = func(category, item, command, value string) error {
+		return errors.New("controller busy")
+	}
+	mockMQTT := NewMockMQTT()
+	cfg := &Config{MyGekko: MyGekkoConfig{PublishErrors: true}}
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A failed command is reported on the set error topic and cleared by the
+	// next successful one
+	bridge.processCommand("blinds/item0/cmd/stop", nil)
+	if len(mockMQTT.jsonPublished) != 1 || mockMQTT.jsonPublished[0].Topic != "blinds/item0/set/error" {
+		t.Fatalf("expected the error on blinds/item0/set/error, got %+v", mockMQTT.jsonPublished)
+	}
+	mockGekko.sendCommand = nil
+	bridge.processCommand("blinds/item0/cmd/stop", nil)
+	if v, ok := lastPublished(mockMQTT, "blinds/item0/set/error"); !ok || v != "" {
+		t.Errorf("expected the set error to be cleared, got %v", v)
+	}
+
+	// A dry run publishes a result instead of sending the command
+	mockMQTT.jsonPublished = nil
+	bridge.cfg.MyGekko.DryRun = true
+	mockGekko.sendCommand = func(category, item, command, value string) error {
+		t.Error("expected no command to be sent in a dry run")
+		return nil
+	}
+	bridge.processCommand("blinds/item0/cmd/up", []byte("1"))
+	want := setResult{Command: "up", Value: "1", DryRun: true}
+	if len(mockMQTT.jsonPublished) != 1 || mockMQTT.jsonPublished[0].Topic != "blinds/item0/set/result" ||
+		mockMQTT.jsonPublished[0].Data != want {
+		t.Errorf("expected a dry run result, got %+v", mockMQTT.jsonPublished)
+	}
+}
+
+func TestHandleSetCommand_Writable(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	cfg := &Config{MyGekko: MyGekkoConfig{
+		WritableCategories: []string{"blinds"},
+		WritableItems:      []string{"lights/item1"},
+		PublishSetErrors:   true,
+	}}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{
+		"alarms": {{Name: "state", Type: "int"}},
+		"blinds": {{Name: "position", Type: "int"}},
+		"lights": {{Name: "state", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bridge.handleSetCommand("alarms/item0/set", []byte("0"))
+	bridge.handleSetCommand("lights/item0/set", []byte("1"))
+	bridge.handleSetCommand("lights/item1/set", []byte("1"))
+	bridge.handleSetCommand("blinds/item0/set", []byte("P50"))
+
+	if got := len(bridge.cmdQueue); got != 2 {
+		t.Errorf("expected 2 queued commands, got %d", got)
+	}
+	if v, ok := lastPublished(mockMQTT, "alarms/item0/set_error"); !ok || v != "item is not writable" {
+		t.Errorf("expected a set error for the blocked category, got %v", v)
+	}
+	if _, ok := lastPublished(mockMQTT, "lights/item0/set_error"); !ok {
+		t.Error("expected a set error for the blocked item")
+	}
+}
+
+func TestPublishVersion(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	info := buildInfo{Version: "v1.2.0", Commit: "abc123", BuildDate: "2026-01-01T00:00:00Z", GoVersion: "go1.24.0"}
+	bridge.PublishVersion(info)
+	if len(mockMQTT.jsonPublished) != 1 || mockMQTT.jsonPublished[0].Topic != "bridge/version" {
+		t.Fatalf("expected one publish to bridge/version, got %+v", mockMQTT.jsonPublished)
+	}
+	if got := mockMQTT.jsonPublished[0].Data; got != info {
+		t.Errorf("expected %+v, got %+v", info, got)
+	}
+	if want := "mygekko-mqtt v1.2.0 (commit abc123, built 2026-01-01T00:00:00Z, go1.24.0)"; info.String() != want {
+		t.Errorf("expected %q, got %q", want, info.String())
+	}
+}
+
+func TestBridgeStop_Unsubscribes(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{
+		"lights": {{Name: "state", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := bridge.Subscribe(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.Stop()
+
+	if !slices.Equal(mockMQTT.unsubscriptions, mockMQTT.subscriptions) {
+		t.Errorf("expected every subscription %v removed, got %v", mockMQTT.subscriptions, mockMQTT.unsubscriptions)
+	}
+}
+
+func TestPublishTelemetry(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{
+		"lights": {{Name: "state", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	bridge.publishTelemetry()
+	if _, ok := lastPublished(mockMQTT, "bridge/last_poll"); ok {
+		t.Error("expected no last_poll before the first poll")
+	}
+
+	bridge.started = time.Now().Add(-90 * time.Second)
+	bridge.pollCategories([]string{"lights", "lights"})
+	bridge.publishTelemetry()
+	if got, _ := lastPublished(mockMQTT, "bridge/uptime"); got != int64(90) {
+		t.Errorf("expected uptime 90, got %v", got)
+	}
+	if got, _ := lastPublished(mockMQTT, "bridge/poll_count"); got != uint64(2) {
+		t.Errorf("expected poll_count 2, got %v", got)
+	}
+	if got, _ := lastPublished(mockMQTT, "bridge/last_poll"); got != bridge.lastPoll.Unix() {
+		t.Errorf("expected last_poll %d, got %v", bridge.lastPoll.Unix(), got)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxColor is the largest packed 0xRRGGBB value of a color field.
+const maxColor = 0xFFFFFF
+
+// parseColor parses the value of a color field, an RGB color packed into an
+// integer as 0xRRGGBB.
+func parseColor(raw string) (int64, error) {
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > maxColor {
+		return 0, fmt.Errorf("%d is not a packed RGB color", n)
+	}
+	return n, nil
+}
+
+// colorHex formats a packed color as "#rrggbb".
+func colorHex(n int64) string {
+	return fmt.Sprintf("#%06x", n)
+}
+
+// colorRGB splits a packed color into its red, green and blue components, as
+// published in the JSON payload.
+func colorRGB(n int64) map[string]int64 {
+	return map[string]int64{"r": n >> 16 & 0xFF, "g": n >> 8 & 0xFF, "b": n & 0xFF}
+}
+
+// packColor packs red, green and blue components of 0 to 255 into 0xRRGGBB.
+func packColor(r, g, b int64) (int64, error) {
+	for _, c := range []int64{r, g, b} {
+		if c < 0 || c > 255 {
+			return 0, fmt.Errorf("color component %d is out of range [0, 255]", c)
+		}
+	}
+	return r<<16 | g<<8 | b, nil
+}
+
+// colorValue translates a color set command value, "#rrggbb" or "r,g,b"
+// as sent by Home Assistant, to the packed integer MyGEKKO expects. A plain
+// integer is taken as already packed.
+func colorValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	var n int64
+	switch {
+	case strings.HasPrefix(value, "#"):
+		hex := value[1:]
+		if len(hex) != 6 {
+			return "", fmt.Errorf("%q is not a #rrggbb color", value)
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a #rrggbb color", value)
+		}
+		n = int64(v)
+	case strings.Contains(value, ","):
+		parts := strings.Split(value, ",")
+		if len(parts) != 3 {
+			return "", fmt.Errorf("%q is not an r,g,b color", value)
+		}
+		var rgb [3]int64
+		for i, part := range parts {
+			c, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("%q is not an r,g,b color", value)
+			}
+			rgb[i] = c
+		}
+		v, err := packColor(rgb[0], rgb[1], rgb[2])
+		if err != nil {
+			return "", err
+		}
+		n = v
+	default:
+		v, err := parseColor(value)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a color", value)
+		}
+		n = v
+	}
+	return strconv.FormatInt(n, 10), nil
+}
+
+// colorJSONValue translates the value of a color field in a JSON set
+// command: an {"r": .., "g": .., "b": ..} object or any value colorValue
+// accepts.
+func colorJSONValue(v any) (string, error) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		s, err := setValueString(v)
+		if err != nil {
+			return "", err
+		}
+		return colorValue(s)
+	}
+	var rgb [3]int64
+	for i, key := range []string{"r", "g", "b"} {
+		c, ok := obj[key].(float64)
+		if !ok || c != float64(int64(c)) {
+			return "", fmt.Errorf("color lacks an integer %q component", key)
+		}
+		rgb[i] = int64(c)
+	}
+	n, err := packColor(rgb[0], rgb[1], rgb[2])
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(n, 10), nil
+}
+
+// colorSetValue translates the value of a set command that writes a color
+// field (see setTarget), like boolSetValue does for bool fields. Other
+// payloads are returned unchanged.
+func (b *Bridge) colorSetValue(category, value string) (string, error) {
+	name, rest, err := b.setTarget(category, value)
+	if err != nil {
+		return value, nil
+	}
+	defs := b.fieldDefs()[category]
+	if i := fieldIndex(defs, name); i == len(defs) || defs[i].Type != "color" {
+		return value, nil
+	}
+	packed, err := colorValue(rest)
+	if err != nil {
+		return "", err
+	}
+	return value[:len(value)-len(rest)] + packed, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestColorValue(t *testing.T) {
+	valid := map[string]string{
+		"#ff8000":     "16744448",
+		"#FF8000":     "16744448",
+		"255,128,0":   "16744448",
+		" 255, 128,0": "16744448",
+		"16744448":    "16744448",
+		"#000000":     "0",
+	}
+	for value, want := range valid {
+		if got, err := colorValue(value); err != nil || got != want {
+			t.Errorf("%q: expected %s, got %s (%v)", value, want, got, err)
+		}
+	}
+	for _, value := range []string{"#ff80", "#gg0000", "256,0,0", "1,2", "red", "16777216", "-1"} {
+		if got, err := colorValue(value); err == nil {
+			t.Errorf("%q: expected an error, got %s", value, got)
+		}
+	}
+}
+
+func TestColorJSONValue(t *testing.T) {
+	got, err := colorJSONValue(map[string]any{"r": 255.0, "g": 128.0, "b": 0.0})
+	if err != nil || got != "16744448" {
+		t.Errorf("expected 16744448, got %s (%v)", got, err)
+	}
+	if got, err := colorJSONValue("#0000ff"); err != nil || got != "255" {
+		t.Errorf("expected 255, got %s (%v)", got, err)
+	}
+	for _, v := range []any{map[string]any{"r": 1.0, "g": 2.0}, map[string]any{"r": 1.5, "g": 2.0, "b": 3.0}, []any{1.0}} {
+		if got, err := colorJSONValue(v); err == nil {
+			t.Errorf("%v: expected an error, got %s", v, got)
+		}
+	}
+}
+
+func TestParseFormatField_Color(t *testing.T) {
+	field, err := parseFormatField("rgbColor color[0:16777215]")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if field.Name != "rgbColor" || field.Type != "color" {
+		t.Errorf("expected a color field rgbColor, got %+v", field)
+	}
+}
+
+func TestProcessItem_Color(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{
+		"lights": {{Name: "state", Type: "int"}, {Name: "rgbColor", Type: "color"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	bridge.processItem("lights", "item0", map[string]any{"value": "1;16744448"})
+	if got, _ := lastPublished(mockMQTT, "lights/item0/get/rgbColor"); got != "#ff8000" {
+		t.Errorf("expected #ff8000, got %v", got)
+	}
+	rgb, ok := mockMQTT.jsonPublished[0].Data.(map[string]any)["rgbColor"].(map[string]int64)
+	if !ok || rgb["r"] != 255 || rgb["g"] != 128 || rgb["b"] != 0 {
+		t.Errorf("expected the components in get/json, got %v", mockMQTT.jsonPublished[0].Data)
+	}
+
+	// A value that is not a packed color is a parse error
+	mockMQTT.published = nil
+	bridge.processItem("lights", "item1", map[string]any{"value": "1;16777216"})
+	if _, ok := lastPublished(mockMQTT, "lights/item1/get/rgbColor"); ok {
+		t.Error("expected an out of range color not to be published")
+	}
+}
+
+func TestProcessSetCommand_Color(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{
+		SetPrefixes:  map[string]map[string]string{"lights": {"C": "rgbColor"}},
+		ValidateSets: true,
+	}}
+	mockGekko := NewMockGekko("TestGekko")
+	var sent []string
+	mockGekko.setValue = func(category, item, value string) error {
+		sent = append(sent, value)
+		return nil
+	}
+	bridge, err := NewBridge(cfg, mockGekko, NewMockMQTT(), map[string][]FieldDef{
+		"lights": {{Name: "state", Type: "int"}, {Name: "rgbColor", Type: "color"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	bridge.processSetCommand("lights/item0/set", []byte("C#ff8000"))
+	bridge.processSetCommand("lights/item1/set", []byte("C0,0,255"))
+	bridge.processSetCommand("lights/item2/set", []byte("Cred"))
+	if want := []string{"C16744448", "C255"}; !slices.Equal(sent, want) {
+		t.Errorf("expected %v, got %v", want, sent)
+	}
+
+	values, ok, err := bridge.expandSetJSON("lights", []byte(`{"rgbColor": {"r": 0, "g": 255, "b": 0}}`))
+	if err != nil || !ok || !slices.Equal(values, []string{"C65280"}) {
+		t.Errorf("expected [C65280], got %v (ok=%v, err=%v)", values, ok, err)
+	}
+}
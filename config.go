@@ -2,18 +2,36 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"net"
+	"net/url"
 	"os"
 	"os/user"
 	"strconv"
+	"strings"
+	"time"
+	// Zone database for mygekko.timezone, also inside a chroot
+	_ "time/tzdata"
 
 	"github.com/BurntSushi/toml"
 )
 
 type Config struct {
-	LogLevel string        `toml:"log_level"`
-	MyGekko  MyGekkoConfig `toml:"mygekko"`
-	MQTT     MQTTConfig    `toml:"mqtt"`
-	Sandbox  SandboxConfig `toml:"sandbox"`
+	LogLevel string `toml:"log_level"`
+	// LogFormat is the log output format: text or json
+	LogFormat string `toml:"log_format"`
+	// APIAddr is the listen address of the read-only state API (empty:
+	// disabled)
+	APIAddr string        `toml:"api_addr"`
+	MyGekko MyGekkoConfig `toml:"mygekko"`
+	MQTT    MQTTConfig    `toml:"mqtt"`
+	Sandbox SandboxConfig `toml:"sandbox"`
+	// Signals maps signal names to actions, on top of the defaults
+	Signals map[string]string `toml:"signals"`
+	// Aggregates are values computed across items each poll round
+	Aggregates []AggregateConfig `toml:"aggregates"`
+	// HomeAssistant configures MQTT discovery
+	HomeAssistant HomeAssistantConfig `toml:"homeassistant"`
 }
 
 type SandboxConfig struct {
@@ -31,20 +49,277 @@ type MyGekkoConfig struct {
 	MainItems       []string `toml:"main_items"`
 	IntervalRounds  int      `toml:"interval_rounds"`
 	CommandInterval float64  `toml:"command_interval"`
+	// CategoryIntervals polls the listed categories every this many seconds
+	// on their own schedule instead of as interval or main items.
+	CategoryIntervals map[string]float64 `toml:"category_intervals"`
+	// SetDebounce collapses the set commands of an item arriving within this
+	// many seconds into the last one (0 disables).
+	SetDebounce float64 `toml:"set_debounce"`
+	// Mode selects the API: "local" (default) talks to the controller at
+	// Host, "cloud" to the MyGEKKO Plus query API at CloudURL with APIKey and
+	// GekkoID, spacing requests by CloudRequestInterval seconds.
+	Mode                 string  `toml:"mode"`
+	APIKey               string  `toml:"api_key"`
+	GekkoID              string  `toml:"gekko_id"`
+	CloudURL             string  `toml:"cloud_url"`
+	CloudRequestInterval float64 `toml:"cloud_request_interval"`
+	// UsernameFile and PasswordFile read the credentials from files (e.g.
+	// mounted secrets) instead of the config.
+	UsernameFile string `toml:"username_file"`
+	PasswordFile string `toml:"password_file"`
+	// HTTPTimeout bounds every request to the MyGEKKO API, in seconds.
+	HTTPTimeout float64 `toml:"http_timeout"`
+	// UseTLS talks to the API over HTTPS instead of HTTP. TLSCAFile
+	// optionally replaces the system roots for verifying the controller's
+	// (often self-signed) certificate.
+	UseTLS                bool   `toml:"use_tls"`
+	TLSCAFile             string `toml:"tls_ca_file"`
+	TLSInsecureSkipVerify bool   `toml:"tls_insecure_skip_verify"`
+	// ProxyURL sends the requests through this HTTP(S) or SOCKS5 proxy
+	// instead of the one from HTTP_PROXY/HTTPS_PROXY/NO_PROXY.
+	ProxyURL string `toml:"proxy_url"`
+	// BulkStatus fetches the status of all categories in one request
+	// (var/status) per poll round instead of one request per category.
+	BulkStatus bool `toml:"bulk_status"`
+	// RetryAttempts is the number of tries for fetching the status of a
+	// category; RetryDelay is the delay before the first retry, in seconds,
+	// doubled for every further one.
+	RetryAttempts int     `toml:"retry_attempts"`
+	RetryDelay    float64 `toml:"retry_delay"`
+	// MaxBackoff caps the retry delay and the Retry-After of a rate-limited
+	// (429) response, in seconds.
+	MaxBackoff float64 `toml:"max_backoff"`
+	// ErrorLogInterval logs an identical poll error at most once per this
+	// many seconds while it repeats.
+	ErrorLogInterval float64 `toml:"error_log_interval"`
+	// BreakerThreshold is the number of consecutive failed status requests
+	// that open the circuit breaker (0 disables it); while open, the
+	// controller is only probed every BreakerProbeInterval seconds.
+	BreakerThreshold     int     `toml:"breaker_threshold"`
+	BreakerProbeInterval float64 `toml:"breaker_probe_interval"`
+	// DefinitionsTimeout bounds loading the field definitions at startup, in
+	// seconds.
+	DefinitionsTimeout float64 `toml:"definitions_timeout"`
+	// StartupAttempts is the number of tries for the gekko name and the
+	// definitions at startup, StartupRetryInterval the seconds between them.
+	StartupAttempts      int     `toml:"startup_attempts"`
+	StartupRetryInterval float64 `toml:"startup_retry_interval"`
+	// ShutdownTimeout bounds how long Stop waits for the getter and setter
+	// to finish, in seconds.
+	ShutdownTimeout float64 `toml:"shutdown_timeout"`
+	// DefinitionsRefreshInterval reloads the field definitions every this
+	// many seconds, to pick up items added on the controller (0 disables).
+	DefinitionsRefreshInterval float64 `toml:"definitions_refresh_interval"`
 	// ThrottlePrefixes partitions commands per category into throttled and
 	// immediate. For a category listed here, a command is throttled only if its
 	// payload starts with one of the given prefixes (e.g. blinds "P50"); every
 	// other command (e.g. a STOP) is sent immediately. Categories not listed
 	// here are throttled entirely.
 	ThrottlePrefixes map[string][]string `toml:"throttle_prefixes"`
+	// DefinitionsFile is an optional local TOML/JSON file with field
+	// definitions that override or supplement the ones parsed from the API.
+	DefinitionsFile string `toml:"definitions_file"`
+	// Definitions lists field definitions per category like the definitions
+	// file; they take precedence over the file and the API.
+	Definitions map[string][]fileFieldDef `toml:"definitions"`
+	// RemovalPolls is the number of consecutive polls an item must be missing
+	// from its category before its retained topics are cleared (0 disables).
+	RemovalPolls int `toml:"removal_polls"`
+	// RepublishInterval publishes every field again, changed or not, once
+	// this many seconds passed since its last publish (0 disables).
+	RepublishInterval float64 `toml:"republish_interval"`
+	// HistoryTTL drops the remembered value of a field that was not polled
+	// for this many seconds (0 keeps it forever).
+	HistoryTTL float64 `toml:"history_ttl"`
+	// StaleAfter flags an item as stale when none of its fields changed for
+	// this many seconds (0 disables).
+	StaleAfter float64 `toml:"stale_after"`
+	// SuppressInitialPublish makes the first poll after the start only
+	// record the values, so only later changes are published.
+	SuppressInitialPublish bool `toml:"suppress_initial_publish"`
+	// HistoryFile keeps the last published values across restarts: it is
+	// written on shutdown and read at startup.
+	HistoryFile string `toml:"history_file"`
+	// RepublishRounds forces a republish of a field that has not changed for
+	// the given number of polls, per category and field.
+	RepublishRounds map[string]map[string]int `toml:"republish_rounds"`
+	// Deadband suppresses publishing a float field until it differs from the
+	// last published value by more than the given delta, per category and
+	// field.
+	Deadband map[string]map[string]float64 `toml:"deadband"`
+	// Scale and Offset transform a numeric field before it is published
+	// (value * scale + offset), per category and field.
+	Scale  map[string]map[string]float64 `toml:"scale"`
+	Offset map[string]map[string]float64 `toml:"offset"`
+	// ValueKeys names the sumstate key holding the value string, per category
+	// (default "value").
+	ValueKeys map[string]string `toml:"value_keys"`
+	// AlarmsEndpoint is the API path of the alarm list, polled with the
+	// main items and published to alarms (empty disables).
+	AlarmsEndpoint string `toml:"alarms_endpoint"`
+	// Globals lists paths below var/globals (e.g. network/gekkoname), polled
+	// with the main items and published to globals/{path}.
+	Globals []string `toml:"globals"`
+	// WritableGlobals lists paths below var/globals that can be set through
+	// globals/{path}/set.
+	WritableGlobals []string `toml:"writable_globals"`
+	// PublishSkipped publishes per category how many items the getter skipped
+	// and, once, which ones and why.
+	PublishSkipped bool `toml:"publish_skipped"`
+	// AutoDiscover polls every category found in the definitions as a main
+	// item if main_items is empty; discovered is set once main_items was
+	// filled that way.
+	AutoDiscover bool `toml:"auto_discover"`
+	discovered   bool
+	// StrictCategories fails the start if interval_items or main_items name
+	// a category without field definitions, instead of warning.
+	StrictCategories bool `toml:"strict_categories"`
+	// PublishRaw publishes the unparsed value string of every item to
+	// {category}/{item}/get/raw, for debugging format mismatches.
+	PublishRaw bool `toml:"publish_raw"`
+	// DecimalComma accepts a comma as decimal separator in float values
+	// ("21,5"), as sent by controllers with some locales.
+	DecimalComma bool `toml:"decimal_comma"`
+	// StripUnits strips a trailing unit from float values ("45.5W") before
+	// parsing; the unit is added to get/json as {field}_unit.
+	StripUnits bool `toml:"strip_units"`
+	// ReadOnly disables the setter: no set topics are subscribed.
+	ReadOnly bool `toml:"read_only"`
+	// WritableCategories and WritableItems ("category/item") restrict set
+	// commands to the listed categories and items; if both are empty, every
+	// category is writable.
+	WritableCategories []string `toml:"writable_categories"`
+	WritableItems      []string `toml:"writable_items"`
+	// DryRun logs set commands instead of sending them to MyGEKKO.
+	DryRun bool `toml:"dry_run"`
+	// ItemNames uses the slugified item names from the definitions in the
+	// topics instead of the item keys ("living_room_blind" for "item0").
+	ItemNames bool `toml:"item_names"`
+	// JSONUnits adds the unit of every field that has one to get/json as
+	// {field}_unit.
+	JSONUnits bool `toml:"json_units"`
+	// MaxFields caps the number of semicolon-separated fields processed per
+	// item; anything beyond is dropped.
+	MaxFields int `toml:"max_fields"`
+	// SetFields names the status field a set command of a category writes
+	// (e.g. lights = "state"), for comparing commands with the known value.
+	SetFields map[string]string `toml:"set_fields"`
+	// SetPrefixes maps a set command prefix to the field it writes, per
+	// category (e.g. blinds "P" = "position" for "P50"), for validate_sets.
+	SetPrefixes map[string]map[string]string `toml:"set_prefixes"`
+	// ValidateSets rejects set commands whose value does not fit the type,
+	// range or allowed values of the field they write.
+	ValidateSets bool `toml:"validate_sets"`
+	// PublishSetErrors publishes the reason of a rejected set command to
+	// {category}/{item}/set_error.
+	PublishSetErrors bool `toml:"publish_set_errors"`
+	// PublishErrors publishes the last fetch error of a category to
+	// {category}/error, the last parse or publish error of an item to
+	// {category}/{item}/error and a failed set command to
+	// {category}/{item}/set/error; each is cleared on the next success.
+	PublishErrors bool `toml:"publish_errors"`
+	// ConfirmSets reads the written field back after a set command and
+	// publishes the outcome to {category}/{item}/set/result. The field is
+	// read ConfirmRetries times within ConfirmTimeout seconds.
+	ConfirmSets    bool    `toml:"confirm_sets"`
+	ConfirmTimeout float64 `toml:"confirm_timeout"`
+	ConfirmRetries int     `toml:"confirm_retries"`
+	// SuppressUnchangedSets skips set commands whose value equals the last
+	// known value of the category's set field.
+	SuppressUnchangedSets bool `toml:"suppress_unchanged_sets"`
+	// AlwaysSend lists categories or "category/item" entries whose set
+	// commands are never suppressed (e.g. triggers).
+	AlwaysSend []string `toml:"always_send"`
+	// PublishMeta publishes name and page (room) of every item once at start.
+	PublishMeta bool `toml:"publish_meta"`
+	// EnumLabels publishes enum fields as their labels instead of indexes
+	// (the index stays in the JSON as {field}_raw); set commands of a
+	// category's set field accept the labels.
+	EnumLabels bool `toml:"enum_labels"`
+	// BoolEnums publishes enum fields with the labels off and on as false
+	// and true; set commands accept true/false and on/off.
+	BoolEnums bool `toml:"bool_enums"`
+	// TimestampFormat is the format of published timestamps: "unix"
+	// (seconds, default) or "rfc3339".
+	TimestampFormat string `toml:"timestamp_format"`
+	// Timezone is the IANA name of the zone of formatted timestamps
+	// (default "UTC"); location is the loaded zone.
+	Timezone string `toml:"timezone"`
+	location *time.Location
+	// FieldTypes overrides the value type parsed from the format string,
+	// per category and field (e.g. blinds.position = "string").
+	FieldTypes map[string]map[string]string `toml:"field_types"`
 }
 
 type MQTTConfig struct {
-	Root     string `toml:"root"`
-	URL      string `toml:"url"`
-	Username string `toml:"username"`
-	Password string `toml:"password"`
-	ClientID string `toml:"client_id"`
+	Root string `toml:"root"`
+	URL  string `toml:"url"`
+	// URLs lists further brokers paho fails over to, after URL if that is
+	// set; a unix socket URL must be the only broker.
+	URLs     []string `toml:"urls"`
+	Username string   `toml:"username"`
+	Password string   `toml:"password"`
+	ClientID string   `toml:"client_id"`
+	// UsernameFile and PasswordFile read the credentials from files instead
+	// of the config.
+	UsernameFile string `toml:"username_file"`
+	PasswordFile string `toml:"password_file"`
+	// QoS and Retain apply to the published state values (default: QoS 0,
+	// retained).
+	QoS    byte  `toml:"qos"`
+	Retain *bool `toml:"retain"`
+	// SubscribeQoS is the QoS of the command subscriptions (default: 0);
+	// 1 keeps set commands from being dropped on a lossy link.
+	SubscribeQoS byte `toml:"subscribe_qos"`
+	// WillTopic is the availability topic below the root, used as LWT with
+	// WillOffline and set to WillOnline on every connect.
+	WillTopic   string `toml:"will_topic"`
+	WillOnline  string `toml:"will_online"`
+	WillOffline string `toml:"will_offline"`
+	// ConnectionLostGrace is how long, in seconds, an unexpected connection
+	// loss may last before the bridge treats the broker as gone (0: at once).
+	ConnectionLostGrace float64 `toml:"connection_lost_grace"`
+	// MaxReconnectAttempts makes the bridge exit after this many failed
+	// reconnects to a lost broker (0: retry forever).
+	MaxReconnectAttempts int `toml:"max_reconnect_attempts"`
+	// StartWithoutBroker lets the bridge start while the broker is still
+	// unreachable after ConnectTimeout seconds; paho keeps retrying.
+	StartWithoutBroker bool    `toml:"start_without_broker"`
+	ConnectTimeout     float64 `toml:"connect_timeout"`
+	// OfflineBuffer is the number of retained topics whose latest value is
+	// held back while the broker is unreachable and published on the next
+	// connect (0: no buffering).
+	OfflineBuffer int `toml:"offline_buffer"`
+	// TLSCAFile replaces the system roots for verifying the broker of a TLS
+	// URL; TLSCertFile and TLSKeyFile are the client certificate for brokers
+	// that require one.
+	TLSCAFile             string `toml:"tls_ca_file"`
+	TLSCertFile           string `toml:"tls_cert_file"`
+	TLSKeyFile            string `toml:"tls_key_file"`
+	TLSInsecureSkipVerify bool   `toml:"tls_insecure_skip_verify"`
+	// ProtocolVersion selects MQTT 3.1.1 (4, the default) or MQTT 5 (5).
+	ProtocolVersion int `toml:"protocol_version"`
+	// MessageExpiry is the message expiry interval in seconds of the values
+	// published below the root, so the broker drops retained values that
+	// were not refreshed in time (0: never). It requires MQTT 5.
+	MessageExpiry float64 `toml:"message_expiry"`
+}
+
+// readSecret sets value to the content of the file at path, without trailing
+// line breaks. Giving both the value and the file is an error.
+func readSecret(value *string, path, name string) error {
+	if path == "" {
+		return nil
+	}
+	if *value != "" {
+		return fmt.Errorf("%s and %s_file are mutually exclusive", name, name)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read %s_file: %w", name, err)
+	}
+	*value = strings.TrimRight(string(data), "\r\n")
+	return nil
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -58,34 +333,172 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("cannot parse config file: %w", err)
 	}
 
+	// Credentials from files
+	for _, s := range []struct {
+		value *string
+		path  string
+		name  string
+	}{
+		{&cfg.MyGekko.Username, cfg.MyGekko.UsernameFile, "mygekko.username"},
+		{&cfg.MyGekko.Password, cfg.MyGekko.PasswordFile, "mygekko.password"},
+		{&cfg.MQTT.Username, cfg.MQTT.UsernameFile, "mqtt.username"},
+		{&cfg.MQTT.Password, cfg.MQTT.PasswordFile, "mqtt.password"},
+	} {
+		if err := readSecret(s.value, s.path, s.name); err != nil {
+			return nil, err
+		}
+	}
+
 	// Set defaults
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = "text"
+	}
 	if cfg.MyGekko.Interval == 0 {
 		cfg.MyGekko.Interval = 5.0
 	}
+	if cfg.MyGekko.Mode == "" {
+		cfg.MyGekko.Mode = "local"
+	}
+	if cfg.MyGekko.CloudURL == "" {
+		cfg.MyGekko.CloudURL = "https://live.my-gekko.com/api/v1/"
+	}
+	if cfg.MyGekko.CloudRequestInterval == 0 {
+		cfg.MyGekko.CloudRequestInterval = 1.0
+	}
 	if cfg.MyGekko.IntervalRounds == 0 {
 		cfg.MyGekko.IntervalRounds = 4
 	}
 	if cfg.MyGekko.CommandInterval == 0 {
 		cfg.MyGekko.CommandInterval = 20.0
 	}
+	if cfg.MyGekko.HTTPTimeout == 0 {
+		cfg.MyGekko.HTTPTimeout = 10.0
+	}
+	if cfg.MyGekko.RetryAttempts == 0 {
+		cfg.MyGekko.RetryAttempts = 3
+	}
+	if cfg.MyGekko.RetryDelay == 0 {
+		cfg.MyGekko.RetryDelay = 1.0
+	}
+	if cfg.MyGekko.MaxBackoff == 0 {
+		cfg.MyGekko.MaxBackoff = 60.0
+	}
+	if cfg.MyGekko.ErrorLogInterval == 0 {
+		cfg.MyGekko.ErrorLogInterval = 300.0
+	}
+	if cfg.MyGekko.BreakerProbeInterval == 0 {
+		cfg.MyGekko.BreakerProbeInterval = 60.0
+	}
+	if cfg.MyGekko.TimestampFormat == "" {
+		cfg.MyGekko.TimestampFormat = "unix"
+	}
+	if cfg.MyGekko.Timezone == "" {
+		cfg.MyGekko.Timezone = "UTC"
+	}
+	if cfg.MyGekko.ConfirmTimeout == 0 {
+		cfg.MyGekko.ConfirmTimeout = 5.0
+	}
+	if cfg.MyGekko.ConfirmRetries == 0 {
+		cfg.MyGekko.ConfirmRetries = 3
+	}
+	if cfg.MyGekko.MaxFields == 0 {
+		cfg.MyGekko.MaxFields = 256
+	}
+	if cfg.MyGekko.DefinitionsTimeout == 0 {
+		cfg.MyGekko.DefinitionsTimeout = 30.0
+	}
+	if cfg.MyGekko.StartupAttempts == 0 {
+		cfg.MyGekko.StartupAttempts = 1
+	}
+	if cfg.MyGekko.StartupRetryInterval == 0 {
+		cfg.MyGekko.StartupRetryInterval = 10.0
+	}
+	if cfg.MyGekko.ShutdownTimeout == 0 {
+		cfg.MyGekko.ShutdownTimeout = 10.0
+	}
+	if cfg.MQTT.ConnectTimeout == 0 {
+		cfg.MQTT.ConnectTimeout = 30.0
+	}
+	if cfg.HomeAssistant.Prefix == "" {
+		cfg.HomeAssistant.Prefix = "homeassistant"
+	}
+	if cfg.MQTT.WillTopic == "" {
+		cfg.MQTT.WillTopic = "online"
+	}
+	if cfg.MQTT.WillOnline == "" {
+		cfg.MQTT.WillOnline = "true"
+	}
+	if cfg.MQTT.WillOffline == "" {
+		cfg.MQTT.WillOffline = "false"
+	}
 
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
+	cfg.MyGekko.location, _ = time.LoadLocation(cfg.MyGekko.Timezone)
 
 	return &cfg, nil
 }
 
 func (c *Config) Validate() error {
+	switch c.LogFormat {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("log_format: unsupported format %q (use text or json)", c.LogFormat)
+	}
+	if c.APIAddr != "" {
+		if _, _, err := net.SplitHostPort(c.APIAddr); err != nil {
+			return fmt.Errorf("api_addr: %w", err)
+		}
+	}
+
 	// MyGekko validation
-	if c.MyGekko.Host == "" {
-		return fmt.Errorf("mygekko.host is required")
+	switch c.MyGekko.Mode {
+	case "", "local":
+		if c.MyGekko.Host == "" {
+			return fmt.Errorf("mygekko.host is required")
+		}
+		if c.MyGekko.Username == "" {
+			return fmt.Errorf("mygekko.username is required")
+		}
+		if c.MyGekko.Password == "" {
+			return fmt.Errorf("mygekko.password is required")
+		}
+	case "cloud":
+		if c.MyGekko.Username == "" {
+			return fmt.Errorf("mygekko.username is required")
+		}
+		if c.MyGekko.APIKey == "" {
+			return fmt.Errorf("mygekko.api_key is required in cloud mode")
+		}
+		if c.MyGekko.GekkoID == "" {
+			return fmt.Errorf("mygekko.gekko_id is required in cloud mode")
+		}
+		if _, err := url.Parse(c.MyGekko.CloudURL); err != nil {
+			return fmt.Errorf("mygekko.cloud_url: %w", err)
+		}
+		if c.MyGekko.CloudRequestInterval < 0 {
+			return fmt.Errorf("mygekko.cloud_request_interval must not be negative")
+		}
+	default:
+		return fmt.Errorf("mygekko.mode: unsupported mode %q (use local or cloud)", c.MyGekko.Mode)
+	}
+	if !c.MyGekko.UseTLS && (c.MyGekko.TLSCAFile != "" || c.MyGekko.TLSInsecureSkipVerify) {
+		return fmt.Errorf("mygekko.tls_ca_file and mygekko.tls_insecure_skip_verify require mygekko.use_tls")
 	}
-	if c.MyGekko.Username == "" {
-		return fmt.Errorf("mygekko.username is required")
+	if c.MyGekko.TLSCAFile != "" && c.MyGekko.TLSInsecureSkipVerify {
+		return fmt.Errorf("mygekko.tls_ca_file and mygekko.tls_insecure_skip_verify are mutually exclusive")
 	}
-	if c.MyGekko.Password == "" {
-		return fmt.Errorf("mygekko.password is required")
+	if c.MyGekko.ProxyURL != "" {
+		u, err := url.Parse(c.MyGekko.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("mygekko.proxy_url: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("mygekko.proxy_url: unsupported scheme %q (use http, https or socks5)", u.Scheme)
+		}
 	}
 	if c.MyGekko.Interval <= 0 {
 		return fmt.Errorf("mygekko.interval must be positive")
@@ -96,17 +509,213 @@ func (c *Config) Validate() error {
 	if c.MyGekko.CommandInterval < 0 {
 		return fmt.Errorf("mygekko.command_interval must not be negative")
 	}
-	if len(c.MyGekko.IntervalItems) == 0 && len(c.MyGekko.MainItems) == 0 {
-		return fmt.Errorf("at least one of mygekko.interval_items or mygekko.main_items is required")
+	if c.MyGekko.SetDebounce < 0 {
+		return fmt.Errorf("mygekko.set_debounce must not be negative")
+	}
+	for category, seconds := range c.MyGekko.CategoryIntervals {
+		if seconds <= 0 {
+			return fmt.Errorf("mygekko.category_intervals.%s must be positive", category)
+		}
+	}
+	if c.MyGekko.HTTPTimeout < 0 {
+		return fmt.Errorf("mygekko.http_timeout must not be negative")
+	}
+	if c.MyGekko.DefinitionsRefreshInterval < 0 {
+		return fmt.Errorf("mygekko.definitions_refresh_interval must not be negative")
+	}
+	if c.MyGekko.RetryAttempts < 0 {
+		return fmt.Errorf("mygekko.retry_attempts must not be negative")
+	}
+	if c.MyGekko.RetryDelay < 0 {
+		return fmt.Errorf("mygekko.retry_delay must not be negative")
+	}
+	if c.MyGekko.MaxBackoff < 0 {
+		return fmt.Errorf("mygekko.max_backoff must not be negative")
+	}
+	if c.MyGekko.ErrorLogInterval < 0 {
+		return fmt.Errorf("mygekko.error_log_interval must not be negative")
+	}
+	if c.MyGekko.BreakerThreshold < 0 {
+		return fmt.Errorf("mygekko.breaker_threshold must not be negative")
+	}
+	if c.MyGekko.BreakerThreshold > 0 && c.MyGekko.BreakerProbeInterval <= 0 {
+		return fmt.Errorf("mygekko.breaker_probe_interval must be positive")
+	}
+	if c.MyGekko.DefinitionsTimeout < 0 {
+		return fmt.Errorf("mygekko.definitions_timeout must not be negative")
+	}
+	if c.MyGekko.StartupAttempts < 0 {
+		return fmt.Errorf("mygekko.startup_attempts must not be negative")
+	}
+	if c.MyGekko.StartupRetryInterval < 0 {
+		return fmt.Errorf("mygekko.startup_retry_interval must not be negative")
+	}
+	if c.MyGekko.ShutdownTimeout < 0 {
+		return fmt.Errorf("mygekko.shutdown_timeout must not be negative")
+	}
+	if c.MyGekko.MaxFields < 0 {
+		return fmt.Errorf("mygekko.max_fields must not be negative")
+	}
+	if c.MyGekko.ConfirmTimeout < 0 {
+		return fmt.Errorf("mygekko.confirm_timeout must not be negative")
+	}
+	if c.MyGekko.ConfirmRetries < 0 {
+		return fmt.Errorf("mygekko.confirm_retries must not be negative")
+	}
+	if c.MyGekko.StaleAfter < 0 {
+		return fmt.Errorf("mygekko.stale_after must not be negative")
+	}
+	if c.MyGekko.HistoryTTL < 0 {
+		return fmt.Errorf("mygekko.history_ttl must not be negative")
+	}
+	if c.MyGekko.RepublishInterval < 0 {
+		return fmt.Errorf("mygekko.republish_interval must not be negative")
+	}
+	if c.MyGekko.RemovalPolls < 0 {
+		return fmt.Errorf("mygekko.removal_polls must not be negative")
+	}
+	if len(c.MyGekko.IntervalItems) == 0 && len(c.MyGekko.MainItems) == 0 && len(c.MyGekko.CategoryIntervals) == 0 && !c.MyGekko.AutoDiscover {
+		return fmt.Errorf("at least one of mygekko.interval_items, mygekko.main_items or mygekko.category_intervals is required, or mygekko.auto_discover")
+	}
+	for _, path := range c.MyGekko.Globals {
+		if err := validGlobalPath(path); err != nil {
+			return fmt.Errorf("mygekko.globals: %w", err)
+		}
+	}
+	for _, path := range c.MyGekko.WritableGlobals {
+		if err := validGlobalPath(path); err != nil {
+			return fmt.Errorf("mygekko.writable_globals: %w", err)
+		}
+	}
+	for category, fields := range c.MyGekko.RepublishRounds {
+		for field, rounds := range fields {
+			if rounds < 0 {
+				return fmt.Errorf("mygekko.republish_rounds.%s.%s must not be negative", category, field)
+			}
+		}
+	}
+	switch c.MyGekko.TimestampFormat {
+	case "", "unix", "rfc3339":
+	default:
+		return fmt.Errorf("mygekko.timestamp_format: unsupported format %q", c.MyGekko.TimestampFormat)
+	}
+	if _, err := time.LoadLocation(c.MyGekko.Timezone); err != nil {
+		return fmt.Errorf("mygekko.timezone: %w", err)
+	}
+	for category, fields := range c.MyGekko.Deadband {
+		for field, delta := range fields {
+			if delta < 0 {
+				return fmt.Errorf("mygekko.deadband.%s.%s must not be negative", category, field)
+			}
+		}
+	}
+	for category, fields := range c.MyGekko.Scale {
+		for field, scale := range fields {
+			if scale == 0 {
+				return fmt.Errorf("mygekko.scale.%s.%s must not be zero", category, field)
+			}
+		}
+	}
+	if _, err := convertDefinitions(c.MyGekko.Definitions); err != nil {
+		return fmt.Errorf("mygekko.definitions: %w", err)
+	}
+	for category, fields := range c.MyGekko.FieldTypes {
+		for field, typ := range fields {
+			switch typ {
+			case "int", "float", "string", "bool", "color":
+			default:
+				return fmt.Errorf("mygekko.field_types.%s.%s: unsupported type %q", category, field, typ)
+			}
+		}
+	}
+
+	if _, err := signalActions(c.Signals); err != nil {
+		return err
+	}
+
+	if strings.ContainsAny(c.HomeAssistant.Prefix, "+#") {
+		return fmt.Errorf("homeassistant.prefix must not contain MQTT wildcards")
+	}
+
+	names := make(map[string]bool, len(c.Aggregates))
+	for _, a := range c.Aggregates {
+		if err := a.validate(); err != nil {
+			return err
+		}
+		if names[a.Name] {
+			return fmt.Errorf("aggregates: duplicate name %q", a.Name)
+		}
+		names[a.Name] = true
 	}
 
 	// MQTT validation
-	if c.MQTT.URL == "" {
+	brokers := c.MQTT.brokerURLs()
+	if len(brokers) == 0 {
 		return fmt.Errorf("mqtt.url is required")
 	}
+	anyTLS := false
+	for _, raw := range brokers {
+		brokerURL, err := parseBrokerURL(raw)
+		if err != nil {
+			return fmt.Errorf("mqtt.url: %w", err)
+		}
+		if brokerURL.Scheme == "unix" && len(brokers) > 1 {
+			return fmt.Errorf("mqtt.url: a unix socket cannot be combined with other brokers")
+		}
+		anyTLS = anyTLS || tlsSchemes[brokerURL.Scheme]
+	}
+	tlsOptions := c.MQTT.TLSCAFile != "" || c.MQTT.TLSCertFile != "" || c.MQTT.TLSKeyFile != "" || c.MQTT.TLSInsecureSkipVerify
+	if tlsOptions && !anyTLS {
+		return fmt.Errorf("mqtt.tls_* options require a TLS URL (ssl, tls, mqtts, tcps or wss)")
+	}
+	if (c.MQTT.TLSCertFile == "") != (c.MQTT.TLSKeyFile == "") {
+		return fmt.Errorf("mqtt.tls_cert_file and mqtt.tls_key_file must be set together")
+	}
+	if c.MQTT.TLSCAFile != "" && c.MQTT.TLSInsecureSkipVerify {
+		return fmt.Errorf("mqtt.tls_ca_file and mqtt.tls_insecure_skip_verify are mutually exclusive")
+	}
 	if c.MQTT.Root == "" {
 		return fmt.Errorf("mqtt.root is required")
 	}
+	if c.MQTT.ConnectionLostGrace < 0 {
+		return fmt.Errorf("mqtt.connection_lost_grace must not be negative")
+	}
+	if c.MQTT.OfflineBuffer < 0 {
+		return fmt.Errorf("mqtt.offline_buffer must not be negative")
+	}
+	if strings.ContainsAny(c.MQTT.WillTopic, "+#") || strings.HasPrefix(c.MQTT.WillTopic, "/") {
+		return fmt.Errorf("mqtt.will_topic must be a topic below the root without wildcards")
+	}
+	if c.MQTT.WillOnline != "" && c.MQTT.WillOnline == c.MQTT.WillOffline {
+		return fmt.Errorf("mqtt.will_online and mqtt.will_offline must differ")
+	}
+	if c.MQTT.QoS > 2 {
+		return fmt.Errorf("mqtt.qos must be 0, 1 or 2")
+	}
+	if c.MQTT.SubscribeQoS > 2 {
+		return fmt.Errorf("mqtt.subscribe_qos must be 0, 1 or 2")
+	}
+	if c.MQTT.MaxReconnectAttempts < 0 {
+		return fmt.Errorf("mqtt.max_reconnect_attempts must not be negative")
+	}
+	if c.MQTT.ConnectTimeout < 0 {
+		return fmt.Errorf("mqtt.connect_timeout must not be negative")
+	}
+	switch c.MQTT.ProtocolVersion {
+	case 0, 4:
+		if c.MQTT.MessageExpiry != 0 {
+			return fmt.Errorf("mqtt.message_expiry requires mqtt.protocol_version 5")
+		}
+	case 5:
+		if c.MQTT.OfflineBuffer > 0 {
+			return fmt.Errorf("mqtt.offline_buffer is not supported with mqtt.protocol_version 5")
+		}
+	default:
+		return fmt.Errorf("mqtt.protocol_version must be 4 or 5")
+	}
+	if c.MQTT.MessageExpiry < 0 || c.MQTT.MessageExpiry > math.MaxUint32 {
+		return fmt.Errorf("mqtt.message_expiry must be between 0 and %d seconds", uint32(math.MaxUint32))
+	}
 
 	return nil
 }
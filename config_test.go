@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig_ValidFile(t *testing.T) {
@@ -73,6 +74,15 @@ root = "test"
 	if cfg.MyGekko.IntervalRounds != 4 {
 		t.Errorf("expected default IntervalRounds 4, got %d", cfg.MyGekko.IntervalRounds)
 	}
+	if cfg.MyGekko.MaxFields != 256 {
+		t.Errorf("expected default MaxFields 256, got %d", cfg.MyGekko.MaxFields)
+	}
+	if cfg.MyGekko.HTTPTimeout != 10.0 {
+		t.Errorf("expected default HTTPTimeout 10.0, got %f", cfg.MyGekko.HTTPTimeout)
+	}
+	if cfg.MyGekko.location != time.UTC {
+		t.Errorf("expected default timezone UTC, got %v", cfg.MyGekko.location)
+	}
 }
 
 func TestLoadConfig_FileNotFound(t *testing.T) {
@@ -181,6 +191,60 @@ func TestValidate_InvalidInterval(t *testing.T) {
 	}
 }
 
+func TestValidate_InvalidLogFormat(t *testing.T) {
+	cfg := &Config{
+		LogFormat: "xml",
+		MyGekko: MyGekkoConfig{
+			Host:           "mygekko.example.com",
+			Username:       "user",
+			Password:       "pass",
+			Interval:       5.0,
+			IntervalRounds: 4,
+			IntervalItems:  []string{"blinds"},
+		},
+		MQTT: MQTTConfig{
+			URL:  "tcp://mqtt.example.com:1883",
+			Root: "test",
+		},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Error("expected error for unsupported log format")
+	}
+}
+
+func TestValidate_ProxyURL(t *testing.T) {
+	for _, tc := range []struct {
+		proxyURL string
+		valid    bool
+	}{
+		{"http://proxy.example.com:3128", true},
+		{"socks5://jump.example.com:1080", true},
+		{"ftp://proxy.example.com", false},
+		{"proxy.example.com:3128", false},
+	} {
+		cfg := &Config{
+			MyGekko: MyGekkoConfig{
+				Host:           "mygekko.example.com",
+				Username:       "user",
+				Password:       "pass",
+				Interval:       5.0,
+				IntervalRounds: 4,
+				IntervalItems:  []string{"blinds"},
+				ProxyURL:       tc.proxyURL,
+			},
+			MQTT: MQTTConfig{
+				URL:  "tcp://mqtt.example.com:1883",
+				Root: "test",
+			},
+		}
+		if err := cfg.Validate(); (err == nil) != tc.valid {
+			t.Errorf("proxy_url %q: expected valid %v, got %v", tc.proxyURL, tc.valid, err)
+		}
+	}
+}
+
 func TestValidate_InvalidIntervalRounds(t *testing.T) {
 	cfg := &Config{
 		MyGekko: MyGekkoConfig{
@@ -267,6 +331,35 @@ func TestValidate_MQTTUnixSocket(t *testing.T) {
 	}
 }
 
+func TestValidate_MQTTURLs(t *testing.T) {
+	for _, tc := range []struct {
+		url   string
+		urls  []string
+		valid bool
+	}{
+		{"", []string{"tcp://mqtt1.example.com:1883", "tcp://mqtt2.example.com:1883"}, true},
+		{"ssl://mqtt1.example.com:8883", []string{"ssl://mqtt2.example.com:8883"}, true},
+		{"tcp://mqtt1.example.com:1883", []string{"ftp://mqtt2.example.com"}, false},
+		{"unix:///run/mosquitto/mosquitto.sock", []string{"tcp://mqtt2.example.com:1883"}, false},
+		{"", nil, false},
+	} {
+		cfg := &Config{
+			MyGekko: MyGekkoConfig{
+				Host:           "mygekko.example.com",
+				Username:       "user",
+				Password:       "pass",
+				Interval:       5.0,
+				IntervalRounds: 4,
+				IntervalItems:  []string{"blinds"},
+			},
+			MQTT: MQTTConfig{URL: tc.url, URLs: tc.urls, Root: "test"},
+		}
+		if err := cfg.Validate(); (err == nil) != tc.valid {
+			t.Errorf("url %q, urls %v: expected valid %v, got %v", tc.url, tc.urls, tc.valid, err)
+		}
+	}
+}
+
 func TestValidate_MissingMQTTRoot(t *testing.T) {
 	cfg := &Config{
 		MyGekko: MyGekkoConfig{
@@ -319,3 +412,290 @@ func writeTempConfig(t *testing.T, content string) string {
 	}
 	return path
 }
+
+func TestValidate_InvalidFieldType(t *testing.T) {
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{
+			Host:           "mygekko.example.com",
+			Username:       "user",
+			Password:       "pass",
+			Interval:       5.0,
+			IntervalRounds: 4,
+			IntervalItems:  []string{"blinds"},
+			FieldTypes:     map[string]map[string]string{"blinds": {"position": "blob"}},
+		},
+		MQTT: MQTTConfig{
+			URL:  "tcp://mqtt.example.com:1883",
+			Root: "test",
+		},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Error("expected error for unsupported field type")
+	}
+}
+
+func TestValidate_TLSOptionsRequireTLS(t *testing.T) {
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{
+			Host:           "mygekko.example.com",
+			Username:       "user",
+			Password:       "pass",
+			Interval:       5.0,
+			IntervalRounds: 4,
+			IntervalItems:  []string{"blinds"},
+			TLSCAFile:      "/etc/mygekko-mqtt/ca.pem",
+		},
+		MQTT: MQTTConfig{
+			URL:  "tcp://mqtt.example.com:1883",
+			Root: "test",
+		},
+	}
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for tls_ca_file without use_tls")
+	}
+
+	cfg.MyGekko.UseTLS = true
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	cfg.MyGekko.TLSInsecureSkipVerify = true
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for tls_ca_file combined with tls_insecure_skip_verify")
+	}
+}
+
+func TestValidate_NegativeHTTPTimeout(t *testing.T) {
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{
+			Host:           "mygekko.example.com",
+			Username:       "user",
+			Password:       "pass",
+			Interval:       5.0,
+			IntervalRounds: 4,
+			IntervalItems:  []string{"blinds"},
+			HTTPTimeout:    -1.0,
+		},
+		MQTT: MQTTConfig{
+			URL:  "tcp://mqtt.example.com:1883",
+			Root: "test",
+		},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Error("expected error for negative http_timeout")
+	}
+}
+
+func TestValidate_InvalidMQTTURL(t *testing.T) {
+	for _, u := range []string{
+		"mqtt.example.com:1883",
+		"http://mqtt.example.com",
+		"tcp://",
+		"unix://",
+	} {
+		cfg := &Config{
+			MyGekko: MyGekkoConfig{
+				Host:           "mygekko.example.com",
+				Username:       "user",
+				Password:       "pass",
+				Interval:       5.0,
+				IntervalRounds: 4,
+				IntervalItems:  []string{"blinds"},
+			},
+			MQTT: MQTTConfig{
+				URL:  u,
+				Root: "test",
+			},
+		}
+
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected error for MQTT URL %q", u)
+		}
+	}
+}
+
+func TestValidate_InvalidTimezone(t *testing.T) {
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{
+			Host:           "mygekko.example.com",
+			Username:       "user",
+			Password:       "pass",
+			Interval:       5.0,
+			IntervalRounds: 4,
+			IntervalItems:  []string{"blinds"},
+			Timezone:       "Europe/Atlantis",
+		},
+		MQTT: MQTTConfig{
+			URL:  "tcp://mqtt.example.com:1883",
+			Root: "test",
+		},
+	}
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for unknown timezone")
+	}
+
+	cfg.MyGekko.Timezone = "Europe/Rome"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestValidate_MQTTTLSOptions(t *testing.T) {
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{
+			Host:           "mygekko.example.com",
+			Username:       "user",
+			Password:       "pass",
+			Interval:       5.0,
+			IntervalRounds: 4,
+			IntervalItems:  []string{"blinds"},
+		},
+		MQTT: MQTTConfig{
+			URL:         "tcp://mqtt.example.com:1883",
+			Root:        "test",
+			TLSCertFile: "/etc/mygekko-mqtt/client.pem",
+			TLSKeyFile:  "/etc/mygekko-mqtt/client.key",
+		},
+	}
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for TLS options with a tcp URL")
+	}
+
+	cfg.MQTT.URL = "mqtts://mqtt.example.com:8883"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	cfg.MQTT.TLSKeyFile = ""
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for a client certificate without key")
+	}
+}
+
+func TestValidate_MQTTProtocolVersion(t *testing.T) {
+	for _, tc := range []struct {
+		version       int
+		expiry        float64
+		offlineBuffer int
+		valid         bool
+	}{
+		{0, 0, 100, true},
+		{4, 0, 0, true},
+		{5, 3600, 0, true},
+		{4, 3600, 0, false}, // message expiry needs MQTT 5
+		{5, 0, 100, false},  // no offline buffer with MQTT 5
+		{5, -1, 0, false},
+		{3, 0, 0, false},
+	} {
+		cfg := &Config{
+			MyGekko: MyGekkoConfig{
+				Host:           "mygekko.example.com",
+				Username:       "user",
+				Password:       "pass",
+				Interval:       5.0,
+				IntervalRounds: 4,
+				IntervalItems:  []string{"blinds"},
+			},
+			MQTT: MQTTConfig{
+				URL:             "tcp://mqtt.example.com:1883",
+				Root:            "test",
+				ProtocolVersion: tc.version,
+				MessageExpiry:   tc.expiry,
+				OfflineBuffer:   tc.offlineBuffer,
+			},
+		}
+		if err := cfg.Validate(); (err == nil) != tc.valid {
+			t.Errorf("version %d, expiry %v, offline buffer %d: expected valid %v, got %v",
+				tc.version, tc.expiry, tc.offlineBuffer, tc.valid, err)
+		}
+	}
+}
+
+func TestLoadConfig_CredentialFiles(t *testing.T) {
+	dir := t.TempDir()
+	gekkoPassword := filepath.Join(dir, "gekko_password")
+	mqttPassword := filepath.Join(dir, "mqtt_password")
+	if err := os.WriteFile(gekkoPassword, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+	if err := os.WriteFile(mqttPassword, []byte("mqttpass"), 0600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+
+	content := `
+[mygekko]
+host = "mygekko.example.com"
+username = "user"
+password_file = "` + gekkoPassword + `"
+interval_items = ["blinds"]
+
+[mqtt]
+url = "tcp://mqtt.example.com:1883"
+root = "test"
+password_file = "` + mqttPassword + `"
+`
+	cfg, err := LoadConfig(writeTempConfig(t, content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MyGekko.Password != "s3cret" {
+		t.Errorf("expected password from file without newline, got %q", cfg.MyGekko.Password)
+	}
+	if cfg.MQTT.Password != "mqttpass" {
+		t.Errorf("expected MQTT password from file, got %q", cfg.MQTT.Password)
+	}
+
+	content = `
+[mygekko]
+host = "mygekko.example.com"
+username = "user"
+password = "inline"
+password_file = "` + gekkoPassword + `"
+interval_items = ["blinds"]
+
+[mqtt]
+url = "tcp://mqtt.example.com:1883"
+root = "test"
+`
+	if _, err := LoadConfig(writeTempConfig(t, content)); err == nil {
+		t.Error("expected error for password and password_file together")
+	}
+}
+
+func TestValidate_CloudMode(t *testing.T) {
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{
+			Mode:           "cloud",
+			Username:       "user@example.com",
+			Interval:       5.0,
+			IntervalRounds: 4,
+			IntervalItems:  []string{"blinds"},
+		},
+		MQTT: MQTTConfig{
+			URL:  "tcp://mqtt.example.com:1883",
+			Root: "test",
+		},
+	}
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for cloud mode without api_key and gekko_id")
+	}
+
+	cfg.MyGekko.APIKey = "apikey"
+	cfg.MyGekko.GekkoID = "K999-7UOZ-8ZYZ-6TH3"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unexpected error without host and password in cloud mode: %v", err)
+	}
+
+	cfg.MyGekko.Mode = "remote"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// fileFieldDef is a field definition as written in a definitions file
+type fileFieldDef struct {
+	Name string `toml:"name" json:"name"`
+	Type string `toml:"type" json:"type"`
+	Unit string `toml:"unit" json:"unit"`
+}
+
+// LoadDefinitionsFile reads field definitions from a local TOML or JSON file
+// (chosen by extension), keyed by category. Each category lists its fields in
+// the order of the semicolon-separated sumstate value; a field with an empty
+// type is skipped like a null field of the API format.
+func LoadDefinitionsFile(path string) (map[string][]FieldDef, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read definitions file: %w", err)
+	}
+
+	var raw map[string][]fileFieldDef
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("definitions file %s: unsupported extension (use .toml or .json)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse definitions file: %w", err)
+	}
+
+	result, err := convertDefinitions(raw)
+	if err != nil {
+		return nil, fmt.Errorf("definitions file: %w", err)
+	}
+	return result, nil
+}
+
+// convertDefinitions validates field definitions as written in a definitions
+// file or the [mygekko.definitions] table and converts them to FieldDefs.
+func convertDefinitions(raw map[string][]fileFieldDef) (map[string][]FieldDef, error) {
+	result := make(map[string][]FieldDef, len(raw))
+	for category, fields := range raw {
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("category %s has no fields", category)
+		}
+		defs := make([]FieldDef, 0, len(fields))
+		for i, f := range fields {
+			if f.Name == "" {
+				return nil, fmt.Errorf("%s field %d has no name", category, i)
+			}
+			switch f.Type {
+			case "int", "float", "string", "bool", "color", "":
+			default:
+				return nil, fmt.Errorf("%s.%s has unsupported type %q", category, f.Name, f.Type)
+			}
+			defs = append(defs, FieldDef{Name: f.Name, Type: f.Type, Unit: f.Unit})
+		}
+		result[category] = defs
+	}
+
+	return result, nil
+}
+
+// MergeFieldDefinitions merges override definitions into base. A category in
+// overrides replaces the API-derived definition of that category entirely;
+// categories unknown to the API are added.
+func MergeFieldDefinitions(base, overrides map[string][]FieldDef) {
+	for category, fields := range overrides {
+		if _, ok := base[category]; ok {
+			slog.Info("Overriding field definitions", "category", category, "fields", len(fields))
+		} else {
+			slog.Info("Adding field definitions", "category", category, "fields", len(fields))
+		}
+		base[category] = fields
+	}
+}
+
+// DiscoverItems fills an empty main_items with every category that has field
+// definitions and is not already in interval_items, if auto_discover is set.
+func DiscoverItems(cfg *MyGekkoConfig, fieldDefinitions map[string][]FieldDef) {
+	if !cfg.AutoDiscover || len(cfg.MainItems) > 0 {
+		return
+	}
+	for _, category := range slices.Sorted(maps.Keys(fieldDefinitions)) {
+		if !slices.Contains(cfg.IntervalItems, category) {
+			cfg.MainItems = append(cfg.MainItems, category)
+		}
+	}
+	cfg.discovered = true
+	slog.Info("Discovered categories", "main_items", cfg.MainItems)
+}
+
+// CheckCategories reports the interval_items, main_items and
+// category_intervals categories that have no field definitions, e.g. a typo
+// like "blind" for "blinds", which would poll nothing. They are logged as a
+// warning, or returned as an error with strict_categories.
+func CheckCategories(cfg *MyGekkoConfig, fieldDefinitions map[string][]FieldDef) error {
+	var unknown []string
+	for _, category := range slices.Concat(cfg.IntervalItems, cfg.MainItems, slices.Sorted(maps.Keys(cfg.CategoryIntervals))) {
+		if _, ok := fieldDefinitions[category]; !ok && !slices.Contains(unknown, category) {
+			unknown = append(unknown, category)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	if cfg.StrictCategories {
+		return fmt.Errorf("unknown categories in interval_items or main_items: %s", strings.Join(unknown, ", "))
+	}
+	slog.Warn("Configured categories not offered by the controller, they will not be polled",
+		"unknown", unknown, "known", slices.Sorted(maps.Keys(fieldDefinitions)))
+	return nil
+}
+
+// DumpDefinitions writes the field definitions in a readable form, one
+// category after the other with an aligned line per field: name, type and,
+// if any, range, allowed values, enum labels and unit.
+func DumpDefinitions(w io.Writer, fieldDefinitions map[string][]FieldDef) error {
+	var buf strings.Builder
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	for _, category := range slices.Sorted(maps.Keys(fieldDefinitions)) {
+		fmt.Fprintf(tw, "%s:\n", category)
+		for _, def := range fieldDefinitions[category] {
+			typ := def.Type
+			if typ == "" {
+				typ = "(skipped)"
+			}
+			var details []string
+			if def.HasRange {
+				details = append(details, fmt.Sprintf("range %g:%g", def.Min, def.Max))
+			}
+			if len(def.Allowed) > 0 {
+				details = append(details, "allowed "+strings.Join(def.Allowed, ","))
+			}
+			if len(def.EnumValues) > 0 {
+				labels := make([]string, len(def.EnumValues))
+				for i, label := range def.EnumValues {
+					labels[i] = fmt.Sprintf("%d=%s", i, label)
+				}
+				details = append(details, "enum "+strings.Join(labels, " "))
+			}
+			if def.Unit != "" {
+				details = append(details, "unit "+def.Unit)
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", def.Name, typ, strings.Join(details, ", "))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	// Fields without details leave the padding of the last column behind
+	for line := range strings.Lines(buf.String()) {
+		if _, err := io.WriteString(w, strings.TrimRight(line, " \n")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// definitionsLoader fetches and parses the field definitions and item
+// metadata, with local overrides applied.
+type definitionsLoader func(ctx context.Context) (map[string][]FieldDef, map[string]map[string]ItemInfo, error)
+
+// SetDefinitionsLoader sets how the getter refreshes the definitions every
+// definitions_refresh_interval.
+func (b *Bridge) SetDefinitionsLoader(load definitionsLoader) {
+	b.loadDefinitions = load
+}
+
+// refreshDefinitions reloads the definitions, so items and categories added on
+// the controller are picked up without a restart: new items of a polled
+// category are published from the next poll on, and the set commands of new
+// categories are subscribed. If main_items was discovered (auto_discover),
+// it is discovered again and new categories are handed to the getter with
+// the current poll settings, like a reload. A failed refresh keeps the
+// current definitions.
+func (b *Bridge) refreshDefinitions(settings pollSettings) {
+	ctx, cancel := context.WithTimeout(b.ctx, time.Duration(b.cfg.MyGekko.DefinitionsTimeout*float64(time.Second)))
+	defer cancel()
+	fieldDefs, itemInfo, err := b.loadDefinitions(ctx)
+	if err != nil {
+		b.failures.Add(1)
+		slog.Error("Failed to refresh definitions, keeping the current ones", "error", err)
+		return
+	}
+
+	oldDefs, oldInfo := b.fieldDefs(), b.items()
+	if reflect.DeepEqual(fieldDefs, oldDefs) && reflect.DeepEqual(itemInfo, oldInfo) {
+		slog.Debug("Definitions unchanged")
+		return
+	}
+
+	slugs := itemSlugs(itemInfo)
+	b.defsMu.Lock()
+	b.fieldDef, b.itemInfo, b.slugs = fieldDefs, itemInfo, slugs
+	b.defsMu.Unlock()
+	slog.Info("Refreshed definitions", "categories", len(fieldDefs))
+	// Names may have changed: republish the indexes on the next poll
+	clear(b.indexed)
+
+	for _, category := range slices.Sorted(maps.Keys(fieldDefs)) {
+		if _, ok := oldDefs[category]; ok {
+			continue
+		}
+		if err := b.subscribeCategory(category); err != nil {
+			b.failures.Add(1)
+			slog.Error("Failed to subscribe new category", "category", category, "error", err)
+		}
+	}
+	if b.cfg.MyGekko.PublishMeta {
+		b.publishItemInfo()
+	}
+	b.PublishDiscovery()
+
+	if settings.cfg == nil || !settings.cfg.MyGekko.discovered {
+		return
+	}
+	cfg := *settings.cfg
+	cfg.MyGekko.MainItems = nil
+	DiscoverItems(&cfg.MyGekko, fieldDefs)
+	if slices.Equal(cfg.MyGekko.MainItems, settings.cfg.MyGekko.MainItems) {
+		return
+	}
+	// A reload still waiting for the getter takes precedence
+	select {
+	case b.reloadCh <- newPollSettings(&cfg):
+	default:
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeTempDefinitions(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write temp definitions: %v", err)
+	}
+	return path
+}
+
+func TestLoadDefinitionsFile_FileOverridesAPI(t *testing.T) {
+	path := writeTempDefinitions(t, "definitions.toml", `
+[[blinds]]
+name = "state"
+type = "int"
+
+[[blinds]]
+name = "position"
+type = "float"
+
+[[meteo]]
+name = "temperature"
+type = "float"
+`)
+
+	fileDefs, err := LoadDefinitionsFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	apiDefs := map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+		"lights": {{Name: "state", Type: "int"}},
+	}
+	MergeFieldDefinitions(apiDefs, fileDefs)
+
+	blinds := apiDefs["blinds"]
+	if len(blinds) != 2 || blinds[0].Name != "state" || blinds[1].Type != "float" {
+		t.Errorf("expected file definition to replace API blinds, got %+v", blinds)
+	}
+	if len(apiDefs["lights"]) != 1 {
+		t.Errorf("expected API-only category lights to be kept, got %+v", apiDefs["lights"])
+	}
+	if len(apiDefs["meteo"]) != 1 || apiDefs["meteo"][0].Name != "temperature" {
+		t.Errorf("expected file-only category meteo to be added, got %+v", apiDefs["meteo"])
+	}
+}
+
+func TestLoadDefinitionsFile_JSON(t *testing.T) {
+	path := writeTempDefinitions(t, "definitions.json",
+		`{"blinds": [{"name": "position", "type": "int"}, {"name": "reserved", "type": ""}], "lights": [{"name": "rgbColor", "type": "color"}]}`)
+
+	defs, err := LoadDefinitionsFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(defs["blinds"]) != 2 || defs["blinds"][1].Type != "" || defs["lights"][0].Type != "color" {
+		t.Errorf("unexpected definitions: %+v", defs)
+	}
+}
+
+func TestLoadDefinitionsFile_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"bad type":  `{"blinds": [{"name": "position", "type": "blob"}]}`,
+		"no name":   `{"blinds": [{"type": "int"}]}`,
+		"no fields": `{"blinds": []}`,
+		"bad json":  `{"blinds": [`,
+	}
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := writeTempDefinitions(t, "definitions.json", content)
+			if _, err := LoadDefinitionsFile(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	path := writeTempDefinitions(t, "definitions.yaml", "blinds: []")
+	if _, err := LoadDefinitionsFile(path); err == nil {
+		t.Error("expected error for unsupported extension")
+	}
+}
+
+func TestDiscoverItems(t *testing.T) {
+	fieldDefs := map[string][]FieldDef{
+		"blinds":    {{Name: "position", Type: "int"}},
+		"lights":    {{Name: "state", Type: "int"}},
+		"roomtemps": {{Name: "temperature", Type: "float"}},
+	}
+
+	cfg := MyGekkoConfig{AutoDiscover: true, IntervalItems: []string{"blinds"}}
+	DiscoverItems(&cfg, fieldDefs)
+	if want := []string{"lights", "roomtemps"}; !slices.Equal(cfg.MainItems, want) {
+		t.Errorf("expected main items %v, got %v", want, cfg.MainItems)
+	}
+
+	// Explicit main_items are kept
+	cfg = MyGekkoConfig{AutoDiscover: true, MainItems: []string{"vents"}}
+	DiscoverItems(&cfg, fieldDefs)
+	if want := []string{"vents"}; !slices.Equal(cfg.MainItems, want) {
+		t.Errorf("expected main items %v, got %v", want, cfg.MainItems)
+	}
+
+	cfg = MyGekkoConfig{}
+	DiscoverItems(&cfg, fieldDefs)
+	if len(cfg.MainItems) != 0 {
+		t.Errorf("expected no discovery without auto_discover, got %v", cfg.MainItems)
+	}
+}
+
+func TestCheckCategories(t *testing.T) {
+	fieldDefs := map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+		"lights": {{Name: "state", Type: "int"}},
+	}
+
+	cfg := MyGekkoConfig{IntervalItems: []string{"blinds"}, MainItems: []string{"lights"}}
+	if err := CheckCategories(&cfg, fieldDefs); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Unknown categories only warn, unless strict
+	cfg = MyGekkoConfig{IntervalItems: []string{"blind"}, MainItems: []string{"lights", "vent"}}
+	if err := CheckCategories(&cfg, fieldDefs); err != nil {
+		t.Errorf("expected a warning only, got %v", err)
+	}
+	cfg.StrictCategories = true
+	err := CheckCategories(&cfg, fieldDefs)
+	if err == nil || !strings.Contains(err.Error(), "blind, vent") {
+		t.Errorf("expected error naming blind and vent, got %v", err)
+	}
+}
+
+func TestConfigDefinitions_OverrideAPI(t *testing.T) {
+	path := writeTempConfig(t, `
+[mygekko]
+host = "mygekko.example.com"
+username = "user"
+password = "pass"
+interval_items = ["blinds"]
+
+[[mygekko.definitions.blinds]]
+name = "state"
+type = "int"
+
+[[mygekko.definitions.blinds]]
+name = "position"
+type = "float"
+
+[mqtt]
+url = "tcp://mqtt.example.com:1883"
+root = "test"
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	configDefs, err := convertDefinitions(cfg.MyGekko.Definitions)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The firmware claims position comes first
+	field, err := parseFormatField("position int[0:100]")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	apiDefs := map[string][]FieldDef{"blinds": {field}}
+	MergeFieldDefinitions(apiDefs, configDefs)
+
+	blinds := apiDefs["blinds"]
+	if len(blinds) != 2 || blinds[0].Name != "state" || blinds[1].Name != "position" || blinds[1].Type != "float" {
+		t.Errorf("expected config definition to replace API blinds, got %+v", blinds)
+	}
+}
+
+func TestValidate_InvalidConfigDefinitions(t *testing.T) {
+	path := writeTempConfig(t, `
+[mygekko]
+host = "mygekko.example.com"
+username = "user"
+password = "pass"
+interval_items = ["blinds"]
+
+[[mygekko.definitions.blinds]]
+name = "position"
+type = "blob"
+
+[mqtt]
+url = "tcp://mqtt.example.com:1883"
+root = "test"
+`)
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("expected error for unsupported type in mygekko.definitions")
+	}
+}
+
+func TestRefreshDefinitions(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{DefinitionsTimeout: 5}}
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bridge.SetDefinitionsLoader(func(ctx context.Context) (map[string][]FieldDef, map[string]map[string]ItemInfo, error) {
+		return nil, nil, errors.New("controller busy")
+	})
+	bridge.refreshDefinitions(newPollSettings(cfg))
+	if _, ok := bridge.fieldDefs()["blinds"]; !ok {
+		t.Fatal("expected a failed refresh to keep the definitions")
+	}
+
+	bridge.SetDefinitionsLoader(func(ctx context.Context) (map[string][]FieldDef, map[string]map[string]ItemInfo, error) {
+		return map[string][]FieldDef{
+			"blinds": {{Name: "position", Type: "int"}},
+			"lights": {{Name: "state", Type: "int"}},
+		}, nil, nil
+	})
+	bridge.refreshDefinitions(newPollSettings(cfg))
+
+	if !slices.Equal(mockMQTT.subscriptions, []string{"lights/+/set", "lights/+/cmd/+"}) {
+		t.Errorf("expected only the new category to be subscribed, got %v", mockMQTT.subscriptions)
+	}
+	bridge.processItem("lights", "item7", map[string]any{"value": "1"})
+	if _, ok := lastPublished(mockMQTT, "lights/item7/get/state"); !ok {
+		t.Error("expected an item of the new category to be published")
+	}
+}
+
+func TestRefreshDefinitions_DiscoversNewCategories(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{DefinitionsTimeout: 5, AutoDiscover: true, IntervalItems: []string{"blinds"}}}
+	fieldDefs := map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+		"lights": {{Name: "state", Type: "int"}},
+	}
+	DiscoverItems(&cfg.MyGekko, fieldDefs)
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), NewMockMQTT(), fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bridge.SetDefinitionsLoader(func(ctx context.Context) (map[string][]FieldDef, map[string]map[string]ItemInfo, error) {
+		return map[string][]FieldDef{
+			"blinds": {{Name: "position", Type: "int"}},
+			"lights": {{Name: "state", Type: "int"}},
+			"vents":  {{Name: "level", Type: "int"}},
+		}, nil, nil
+	})
+	bridge.refreshDefinitions(newPollSettings(cfg))
+
+	select {
+	case settings := <-bridge.reloadCh:
+		if want := []string{"lights", "vents"}; !slices.Equal(settings.mainItems, want) {
+			t.Errorf("expected main items %v, got %v", want, settings.mainItems)
+		}
+		if !slices.Equal(settings.intervalItems, []string{"blinds"}) {
+			t.Errorf("expected the interval items to be kept, got %v", settings.intervalItems)
+		}
+	default:
+		t.Fatal("expected the discovered categories to be handed to the getter")
+	}
+
+	// Explicit main_items are not rediscovered
+	explicit := &Config{MyGekko: MyGekkoConfig{DefinitionsTimeout: 5, AutoDiscover: true, MainItems: []string{"blinds"}}}
+	bridge, err = NewBridge(explicit, NewMockGekko("TestGekko"), NewMockMQTT(), fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.SetDefinitionsLoader(func(ctx context.Context) (map[string][]FieldDef, map[string]map[string]ItemInfo, error) {
+		return map[string][]FieldDef{"vents": {{Name: "level", Type: "int"}}}, nil, nil
+	})
+	bridge.refreshDefinitions(newPollSettings(explicit))
+	select {
+	case settings := <-bridge.reloadCh:
+		t.Errorf("expected explicit main items to be kept, got %v", settings.mainItems)
+	default:
+	}
+}
+
+func TestDumpDefinitions(t *testing.T) {
+	var sb strings.Builder
+	err := DumpDefinitions(&sb, map[string][]FieldDef{
+		"lights": {{Name: "state", Type: "int", EnumValues: []string{"off", "on"}}},
+		"blinds": {
+			{Name: "position", Type: "float", Min: 0, Max: 100, HasRange: true, Unit: "%"},
+			{Name: "reserved"},
+			{Name: "mode", Type: "int", Allowed: []string{"0", "1", "2"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `blinds:
+  position  float      range 0:100, unit %
+  reserved  (skipped)
+  mode      int        allowed 0,1,2
+lights:
+  state  int  enum 0=off 1=on
+`
+	if got := sb.String(); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
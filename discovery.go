@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// HomeAssistantConfig enables MQTT discovery for Home Assistant.
+type HomeAssistantConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Prefix is the discovery prefix Home Assistant listens on
+	Prefix string `toml:"prefix"`
+}
+
+// rawPublisher is implemented by MQTT clients that can publish outside the
+// bridge root, as needed for discovery configs.
+type rawPublisher interface {
+	Topic(topic string) string
+	PublishRaw(topic string, payload []byte) error
+}
+
+// discoveryDevice groups the entities of one item in Home Assistant
+type discoveryDevice struct {
+	Identifiers   []string `json:"identifiers"`
+	Name          string   `json:"name"`
+	Manufacturer  string   `json:"manufacturer"`
+	SuggestedArea string   `json:"suggested_area,omitempty"`
+}
+
+// discoveryConfig is the payload of a Home Assistant discovery topic. Only
+// the keys of the components we emit (cover, sensor) are included.
+type discoveryConfig struct {
+	Name                string          `json:"name"`
+	UniqueID            string          `json:"unique_id"`
+	Device              discoveryDevice `json:"device"`
+	AvailabilityTopic   string          `json:"availability_topic"`
+	PayloadAvailable    string          `json:"payload_available"`
+	PayloadNotAvailable string          `json:"payload_not_available"`
+
+	// sensor
+	StateTopic        string `json:"state_topic,omitempty"`
+	UnitOfMeasurement string `json:"unit_of_measurement,omitempty"`
+
+	// cover
+	CommandTopic        string `json:"command_topic,omitempty"`
+	PayloadOpen         string `json:"payload_open,omitempty"`
+	PayloadClose        string `json:"payload_close,omitempty"`
+	PayloadStop         string `json:"payload_stop,omitempty"`
+	PositionTopic       string `json:"position_topic,omitempty"`
+	SetPositionTopic    string `json:"set_position_topic,omitempty"`
+	SetPositionTemplate string `json:"set_position_template,omitempty"`
+}
+
+var discoveryIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// discoveryID turns topic segments into a node/unique id
+func discoveryID(parts ...string) string {
+	return discoveryIDChars.ReplaceAllString(strings.Join(parts, "_"), "_")
+}
+
+// discoveryConfigs builds the discovery topics and payloads for all items
+// with known metadata: blinds become covers, the numeric fields of every
+// other category become sensors.
+func (b *Bridge) discoveryConfigs(pub rawPublisher) map[string]discoveryConfig {
+	prefix := b.cfg.HomeAssistant.Prefix
+	result := make(map[string]discoveryConfig)
+
+	fieldDefs, itemInfo := b.fieldDefs(), b.items()
+	for _, category := range slices.Sorted(maps.Keys(itemInfo)) {
+		fields, ok := fieldDefs[category]
+		if !ok {
+			continue
+		}
+		for item, info := range itemInfo[category] {
+			name := info.Name
+			if name == "" {
+				name = category + " " + item
+			}
+			node := discoveryID(b.gekkoName, category, item)
+			itemTopic := b.itemTopic(category, item)
+			base := discoveryConfig{
+				Device: discoveryDevice{
+					Identifiers:   []string{node},
+					Name:          name,
+					Manufacturer:  "MyGEKKO",
+					SuggestedArea: info.Page,
+				},
+				AvailabilityTopic:   pub.Topic(b.cfg.MQTT.WillTopic),
+				PayloadAvailable:    b.cfg.MQTT.WillOnline,
+				PayloadNotAvailable: b.cfg.MQTT.WillOffline,
+			}
+
+			if category == "blinds" {
+				cover := base
+				cover.Name = name
+				cover.UniqueID = node
+				// A read-only cover only reports its position
+				if !b.cfg.MyGekko.ReadOnly {
+					cover.CommandTopic = pub.Topic(fmt.Sprintf("%s/%s/set", category, itemTopic))
+					cover.PayloadOpen = "1"
+					cover.PayloadClose = "-1"
+					cover.PayloadStop = "0"
+				}
+				if slices.ContainsFunc(fields, func(f FieldDef) bool { return f.Name == "position" && f.Type != "" }) {
+					cover.PositionTopic = pub.Topic(fmt.Sprintf("%s/%s/get/position", category, itemTopic))
+					if !b.cfg.MyGekko.ReadOnly {
+						cover.SetPositionTopic = cover.CommandTopic
+						cover.SetPositionTemplate = "P{{ position }}"
+					}
+				}
+				result[fmt.Sprintf("%s/cover/%s/config", prefix, node)] = cover
+				continue
+			}
+
+			for _, field := range fields {
+				if field.Type != "int" && field.Type != "float" {
+					continue
+				}
+				sensor := base
+				sensor.Name = field.Name
+				sensor.UniqueID = discoveryID(node, field.Name)
+				sensor.StateTopic = pub.Topic(fmt.Sprintf("%s/%s/get/%s", category, itemTopic, field.Name))
+				sensor.UnitOfMeasurement = field.Unit
+				result[fmt.Sprintf("%s/sensor/%s/config", prefix, sensor.UniqueID)] = sensor
+			}
+		}
+	}
+	return result
+}
+
+// PublishDiscovery publishes the Home Assistant discovery configs (retained),
+// if enabled. It runs at startup and after every reconnect.
+func (b *Bridge) PublishDiscovery() {
+	if !b.cfg.HomeAssistant.Enabled {
+		return
+	}
+	pub, ok := b.mqtt.(rawPublisher)
+	if !ok {
+		return
+	}
+
+	configs := b.discoveryConfigs(pub)
+	for topic, cfg := range configs {
+		payload, err := json.Marshal(cfg)
+		if err != nil {
+			slog.Error("Failed to marshal discovery config", "topic", topic, "error", err)
+			continue
+		}
+		if err := pub.PublishRaw(topic, payload); err != nil {
+			b.failures.Add(1)
+			slog.Error("Failed to publish discovery config", "topic", topic, "error", err)
+			continue
+		}
+		b.publishes.Add(1)
+	}
+	slog.Info("Published Home Assistant discovery", "entities", len(configs))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPublishDiscovery(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	m := newTestMQTTClient(paho)
+	cfg := &Config{
+		MQTT:          MQTTConfig{WillTopic: "online", WillOnline: "true", WillOffline: "false"},
+		HomeAssistant: HomeAssistantConfig{Enabled: true, Prefix: "homeassistant"},
+	}
+	fieldDefs := map[string][]FieldDef{
+		"blinds":    {{Name: "state", Type: "int"}, {Name: "position", Type: "float"}},
+		"roomtemps": {{Name: "temperature", Type: "float", Unit: "°C"}, {Name: "mode", Type: "string"}},
+	}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), m, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.SetItemInfo(map[string]map[string]ItemInfo{
+		"blinds":    {"item0": {Name: "Kitchen", Page: "Ground floor"}},
+		"roomtemps": {"item0": {Name: "Living"}},
+		"unknown":   {"item0": {Name: "Ignored"}},
+	})
+
+	bridge.PublishDiscovery()
+	m.onConnect(paho)
+	bridge.processItem("roomtemps", "item0", map[string]any{"value": "21.5;auto"})
+
+	configs := make(map[string]discoveryConfig)
+	published := make(map[string]bool)
+	for _, msg := range paho.published {
+		published[msg.Topic] = true
+		if payload, ok := msg.Value.([]byte); ok && strings.HasPrefix(msg.Topic, "homeassistant/") {
+			var c discoveryConfig
+			if err := json.Unmarshal(payload, &c); err != nil {
+				t.Fatalf("invalid discovery payload on %s: %v", msg.Topic, err)
+			}
+			configs[msg.Topic] = c
+		}
+	}
+	if len(configs) != 2 {
+		t.Fatalf("expected a cover and one sensor, got %v", configs)
+	}
+
+	cover, ok := configs["homeassistant/cover/TestGekko_blinds_item0/config"]
+	if !ok {
+		t.Fatalf("expected cover config, got %v", configs)
+	}
+	if cover.CommandTopic != "test/TestGekko/blinds/item0/set" || cover.PositionTopic != "test/TestGekko/blinds/item0/get/position" {
+		t.Errorf("unexpected cover topics: %+v", cover)
+	}
+	if cover.Device.SuggestedArea != "Ground floor" {
+		t.Errorf("expected page as suggested area, got %q", cover.Device.SuggestedArea)
+	}
+
+	sensor, ok := configs["homeassistant/sensor/TestGekko_roomtemps_item0_temperature/config"]
+	if !ok {
+		t.Fatalf("expected temperature sensor config, got %v", configs)
+	}
+	if sensor.UnitOfMeasurement != "°C" {
+		t.Errorf("expected the field unit as unit_of_measurement, got %q", sensor.UnitOfMeasurement)
+	}
+	// The referenced topics must be exactly the ones the bridge publishes to
+	if !published[sensor.StateTopic] {
+		t.Errorf("state_topic %s is not published by processItem", sensor.StateTopic)
+	}
+	if !published[sensor.AvailabilityTopic] || sensor.PayloadAvailable != "true" {
+		t.Errorf("availability %s/%s does not match the online handling", sensor.AvailabilityTopic, sensor.PayloadAvailable)
+	}
+}
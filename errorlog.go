@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// pollFailure is the state of a failing poll group, for throttling its
+// error log
+type pollFailure struct {
+	message    string
+	logged     time.Time
+	failures   int // failed polls since the last success
+	suppressed int // identical errors not logged since the last log
+}
+
+// logPollError logs the error of a failed poll of categories. An error
+// identical to the last one of the same categories is logged at most once
+// per error_log_interval, with the number of repeats held back, so an
+// outage does not flood the log.
+func (b *Bridge) logPollError(categories []string, err error) {
+	key := strings.Join(categories, ",")
+	now := b.clock()
+	f := b.pollFailures[key]
+	if f == nil {
+		f = &pollFailure{}
+		b.pollFailures[key] = f
+	}
+	f.failures++
+
+	message := err.Error()
+	if message == f.message && now.Sub(f.logged) < b.errorLogInterval {
+		f.suppressed++
+		return
+	}
+	if f.suppressed > 0 {
+		slog.Error("Can't connect MyGekko, will retry", "error", err, "repeated", f.suppressed)
+	} else {
+		slog.Error("Can't connect MyGekko, will retry", "error", err)
+	}
+	f.message, f.logged, f.suppressed = message, now, 0
+}
+
+// logPollRecovered logs once the polls of categories succeed again after
+// logPollError, with the number of failed polls.
+func (b *Bridge) logPollRecovered(categories []string) {
+	key := strings.Join(categories, ",")
+	if f, ok := b.pollFailures[key]; ok {
+		slog.Info("MyGekko polls succeeding again", "items", categories, "failures", f.failures)
+		delete(b.pollFailures, key)
+	}
+}
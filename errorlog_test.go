@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestPollRound_ThrottlesErrorLog(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(newLogHandler(&buf, "text")))
+
+	cfg := &Config{MyGekko: MyGekkoConfig{ErrorLogInterval: 3600}}
+	mockGekko := NewMockGekko("TestGekko")
+	mockGekko.statusErr = map[string]error{"blinds": errors.New("connection refused")}
+	bridge, err := NewBridge(cfg, mockGekko, NewMockMQTT(), map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+	logged := func(msg string) []string {
+		var lines []string
+		for line := range strings.Lines(buf.String()) {
+			if strings.Contains(line, msg) {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+
+	for range 3 {
+		bridge.pollRound([]string{"blinds"})
+	}
+	if lines := logged("Can't connect MyGekko"); len(lines) != 1 {
+		t.Fatalf("expected the repeated error logged once, got %q", lines)
+	}
+
+	// Once the window passed, the error is logged again with its repeats
+	bridge.errorLogInterval = 0
+	bridge.pollRound([]string{"blinds"})
+	if lines := logged("Can't connect MyGekko"); len(lines) != 2 || !strings.Contains(lines[1], "repeated=2") {
+		t.Fatalf("expected the error logged again with repeated=2, got %q", lines)
+	}
+
+	mockGekko.statusErr = nil
+	bridge.pollRound([]string{"blinds"})
+	bridge.pollRound([]string{"blinds"})
+	if lines := logged("polls succeeding again"); len(lines) != 1 || !strings.Contains(lines[0], "failures=4") {
+		t.Errorf("expected one recovery summary with failures=4, got %q", lines)
+	}
+}
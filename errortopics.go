@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// errorReport is the payload of an error topic (publish_errors)
+type errorReport struct {
+	Error     string `json:"error"`
+	Timestamp any    `json:"timestamp"`
+}
+
+// reportError publishes the last error of a category or item to an error
+// topic, retained, if publish_errors is enabled. It stays until clearError
+// is called after the next success.
+func (b *Bridge) reportError(topic string, reason error) {
+	if !b.cfg.MyGekko.PublishErrors {
+		return
+	}
+	report := errorReport{Error: reason.Error(), Timestamp: b.timestamp(b.clock())}
+	if err := b.publishJSON(topic, report); err != nil {
+		slog.Error("Failed to publish", "topic", topic, "error", err)
+		return
+	}
+	b.errorsMu.Lock()
+	b.errorTopics[topic] = true
+	b.errorsMu.Unlock()
+}
+
+// clearError clears an error topic set by reportError with an empty payload.
+func (b *Bridge) clearError(topic string) {
+	b.errorsMu.Lock()
+	reported := b.errorTopics[topic]
+	delete(b.errorTopics, topic)
+	b.errorsMu.Unlock()
+	if !reported {
+		return
+	}
+	if err := b.publish(topic, ""); err != nil {
+		slog.Error("Failed to clear topic", "topic", topic, "error", err)
+	}
+}
+
+// itemErrorTopic is the error topic of an item's polls ("error") or set
+// commands ("set/error").
+func (b *Bridge) itemErrorTopic(category, item, suffix string) string {
+	return fmt.Sprintf("%s/%s/%s", category, b.itemTopic(category, item), suffix)
+}
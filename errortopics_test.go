@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPublishErrors(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{PublishErrors: true}}
+	mockGekko := NewMockGekko("TestGekko")
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, map[string][]FieldDef{
+		"roomtemps": {{Name: "temperature", Type: "float"}},
+		"lights":    {{Name: "state", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+	lastError := func(topic string) any {
+		t.Helper()
+		var report any
+		for _, msg := range mockMQTT.jsonPublished {
+			if msg.Topic == topic {
+				report = msg.Data
+			}
+		}
+		if got, ok := lastPublished(mockMQTT, topic); ok && got == "" {
+			return "" // cleared after the report
+		}
+		return report
+	}
+
+	// Category fetch errors
+	mockGekko.statusErr = map[string]error{"lights": errors.New("connection reset")}
+	bridge.pollCategories([]string{"lights"})
+	if report, ok := lastError("lights/error").(errorReport); !ok || report.Error != "connection reset" {
+		t.Fatalf("expected the fetch error on lights/error, got %v", lastError("lights/error"))
+	}
+	mockGekko.statusErr = nil
+	bridge.pollCategories([]string{"lights"})
+	if got := lastError("lights/error"); got != "" {
+		t.Errorf("expected lights/error cleared after a successful poll, got %v", got)
+	}
+
+	// Item parse errors
+	bridge.processItem("roomtemps", "item0", map[string]any{"value": "warm"})
+	if report, ok := lastError("roomtemps/item0/error").(errorReport); !ok || report.Timestamp == nil {
+		t.Fatalf("expected a parse error with a timestamp, got %v", lastError("roomtemps/item0/error"))
+	}
+	bridge.processItem("roomtemps", "item0", map[string]any{"value": "21.5"})
+	if got := lastError("roomtemps/item0/error"); got != "" {
+		t.Errorf("expected the item error cleared, got %v", got)
+	}
+
+	// Failed set commands
+	mockGekko.setValue = func(category, item, value string) error { return errors.New("controller busy") }
+	bridge.processSetCommand("lights/item1/set", []byte("1"))
+	if report, ok := lastError("lights/item1/set/error").(errorReport); !ok || report.Error != "controller busy" {
+		t.Fatalf("expected the set error on set/error, got %v", lastError("lights/item1/set/error"))
+	}
+	mockGekko.setValue = nil
+	bridge.processSetCommand("lights/item1/set", []byte("1"))
+	if got := lastError("lights/item1/set/error"); got != "" {
+		t.Errorf("expected set/error cleared after a successful command, got %v", got)
+	}
+
+	// Nothing is cleared that was never reported
+	if _, ok := lastPublished(mockMQTT, "lights/item0/error"); ok {
+		t.Error("expected no clear of an item without errors")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// globalsCategory is the topic prefix of the globals tree (network, meteo,
+// date/time, ...). Unlike a category of items, a global is addressed by a
+// path of several segments, e.g. globals/network/gekkoname.
+const globalsCategory = "globals"
+
+// validGlobalPath checks a subpath of the globals tree as configured in
+// globals and writable_globals: non-empty segments separated by slashes,
+// without MQTT wildcards.
+func validGlobalPath(path string) error {
+	if strings.ContainsAny(path, "+#") {
+		return fmt.Errorf("%q must not contain MQTT wildcards", path)
+	}
+	for segment := range strings.SplitSeq(path, "/") {
+		if segment == "" {
+			return fmt.Errorf("%q has an empty path segment", path)
+		}
+	}
+	return nil
+}
+
+// publishGlobals fetches the configured globals and publishes the value of
+// each that changed to globals/{path}.
+func (b *Bridge) publishGlobals() {
+	for _, path := range b.cfg.MyGekko.Globals {
+		result, err := b.gekko.GetGlobal(b.ctx, path)
+		if err != nil {
+			if b.ctx.Err() != nil {
+				return
+			}
+			b.failures.Add(1)
+			slog.Error("Failed to fetch global", "path", path, "error", err)
+			continue
+		}
+		value, ok := result["value"]
+		if !ok {
+			slog.Debug("Global has no value", "path", path)
+			continue
+		}
+		if !b.recordValue(globalsCategory, path, "value", value) || b.quietStart {
+			continue
+		}
+		topic := fmt.Sprintf("%s/%s", globalsCategory, path)
+		if err := b.publish(topic, value); err != nil {
+			slog.Error("Failed to publish", "topic", topic, "error", err)
+		}
+	}
+}
+
+// subscribeGlobals subscribes to globals/{path}/set of the writable globals.
+func (b *Bridge) subscribeGlobals() error {
+	if b.cfg.MyGekko.ReadOnly {
+		return nil
+	}
+	for _, path := range b.cfg.MyGekko.WritableGlobals {
+		topic := fmt.Sprintf("%s/%s/set", globalsCategory, path)
+		slog.Info("subscribe", "topic", topic)
+		err := b.subscribe(topic, func(t string, payload []byte) {
+			slog.Info("Incoming message...", "topic", t)
+			b.queueCommand(globalsCategory, setCommand{topic: t, payload: slices.Clone(payload), global: path})
+		})
+		if err != nil {
+			return fmt.Errorf("subscribe %s: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+// processGlobalSet sends a queued set command of a writable global to
+// MyGEKKO. The payload is sent as is.
+func (b *Bridge) processGlobalSet(path string, payload []byte) {
+	value := string(payload)
+	slog.Info("Write global", "path", path, "value", value)
+
+	if b.cfg.MyGekko.DryRun {
+		slog.Info("Dry run, not sending global", "path", path, "value", value)
+		b.publishSetResult(globalsCategory, path, setResult{Value: value, DryRun: true})
+		return
+	}
+
+	b.setCommands.Add(1)
+	errTopic := b.itemErrorTopic(globalsCategory, path, "set/error")
+	if err := b.gekko.SetValue(b.ctx, globalsCategory, path, value); err != nil {
+		b.failures.Add(1)
+		slog.Error("MyGEKKO command error", "error", err, "path", path, "value", value)
+		b.reportError(errTopic, err)
+		return
+	}
+	slog.Debug("Command ok", "path", path, "value", value)
+	b.clearError(errTopic)
+}
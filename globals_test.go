@@ -0,0 +1,98 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPublishGlobals(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{Globals: []string{"network/gekkoname", "meteo/temperature", "date/missing"}}}
+	mockGekko := NewMockGekko("TestGekko")
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, map[string][]FieldDef{}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	mockGekko.globals = map[string]map[string]any{
+		"network/gekkoname": {"value": "Home"},
+		"meteo/temperature": {"value": "12.5"},
+	}
+	bridge.publishGlobals()
+	if got, _ := lastPublished(mockMQTT, "globals/network/gekkoname"); got != "Home" {
+		t.Errorf("expected the gekko name published, got %v", got)
+	}
+	if got, _ := lastPublished(mockMQTT, "globals/meteo/temperature"); got != "12.5" {
+		t.Errorf("expected the temperature published, got %v", got)
+	}
+	if len(mockMQTT.published) != 2 {
+		t.Fatalf("expected 2 publishes, got %v", mockMQTT.published)
+	}
+
+	// Only changed values are published again
+	mockGekko.globals["meteo/temperature"] = map[string]any{"value": "13.0"}
+	bridge.publishGlobals()
+	if len(mockMQTT.published) != 3 || mockMQTT.published[2].Topic != "globals/meteo/temperature" {
+		t.Errorf("expected only the temperature published again, got %v", mockMQTT.published)
+	}
+}
+
+func TestSubscribeGlobals(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{WritableGlobals: []string{"date/time"}}}
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	if err := bridge.Subscribe(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Contains(mockMQTT.subscriptions, "globals/date/time/set") {
+		t.Errorf("expected globals/date/time/set subscribed, got %v", mockMQTT.subscriptions)
+	}
+
+	mockMQTT.subscriptions = nil
+	cfg.MyGekko.ReadOnly = true
+	if err := bridge.subscribeGlobals(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mockMQTT.subscriptions) != 0 {
+		t.Errorf("expected no subscription when read only, got %v", mockMQTT.subscriptions)
+	}
+}
+
+func TestProcessGlobalSet(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{WritableGlobals: []string{"date/time"}}}
+	mockGekko := NewMockGekko("TestGekko")
+	var gotCategory, gotItem, gotValue string
+	mockGekko.setValue = func(category, item, value string) error {
+		gotCategory, gotItem, gotValue = category, item, value
+		return nil
+	}
+	bridge, err := NewBridge(cfg, mockGekko, NewMockMQTT(), map[string][]FieldDef{}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	bridge.processGlobalSet("date/time", []byte("12:30:00"))
+	if gotCategory != "globals" || gotItem != "date/time" || gotValue != "12:30:00" {
+		t.Errorf("expected globals date/time set to 12:30:00, got %s %s %s", gotCategory, gotItem, gotValue)
+	}
+}
+
+func TestValidGlobalPath(t *testing.T) {
+	for _, path := range []string{"network/gekkoname", "date/time", "meteo"} {
+		if err := validGlobalPath(path); err != nil {
+			t.Errorf("%q: unexpected error: %v", path, err)
+		}
+	}
+	for _, path := range []string{"", "/date", "date/", "date//time", "date/+", "#"} {
+		if err := validGlobalPath(path); err == nil {
+			t.Errorf("%q: expected an error", path)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// storedEntry is a history entry as written to history_file. The type keeps
+// an int apart from a float, which JSON does not; numbers are read as
+// json.Number so a large int64 keeps all its digits.
+type storedEntry struct {
+	Type      string    `json:"type"`
+	Value     any       `json:"value"`
+	Unchanged int       `json:"unchanged,omitempty"`
+	Published time.Time `json:"published"`
+	Seen      time.Time `json:"seen"`
+	Changed   time.Time `json:"changed"`
+}
+
+// loadHistory reads the history saved by SaveHistory. A missing or corrupt
+// file is logged and yields an empty history, so every value is published
+// again like on a start without history_file.
+func loadHistory(path string) map[string]historyEntry {
+	history := make(map[string]historyEntry)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("No history file yet, starting fresh", "path", path)
+		return history
+	}
+	if err != nil {
+		slog.Warn("Cannot read history file, starting fresh", "path", path, "error", err)
+		return history
+	}
+	var stored map[string]storedEntry
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&stored); err != nil {
+		slog.Warn("Cannot parse history file, starting fresh", "path", path, "error", err)
+		return history
+	}
+
+	for histKey, s := range stored {
+		var value any
+		switch v := s.Value.(type) {
+		case json.Number:
+			switch s.Type {
+			case "int":
+				if n, err := v.Int64(); err == nil {
+					value = n
+				}
+			case "float":
+				if f, err := v.Float64(); err == nil {
+					value = f
+				}
+			}
+		case string:
+			if s.Type == "string" {
+				value = v
+			}
+		case bool:
+			if s.Type == "bool" {
+				value = v
+			}
+		}
+		if value == nil {
+			slog.Debug("Skipping history entry", "key", histKey, "type", s.Type)
+			continue
+		}
+		changed := s.Changed
+		if changed.IsZero() {
+			// Saved before the change time was tracked
+			changed = s.Seen
+		}
+		history[histKey] = historyEntry{value: value, unchanged: s.Unchanged, published: s.Published, seen: s.Seen, changed: changed}
+	}
+	slog.Info("Loaded history", "path", path, "entries", len(history))
+	return history
+}
+
+// SaveHistory writes the history to history_file, so after a restart only
+// values that changed in the meantime are published. The file is replaced
+// atomically.
+func (b *Bridge) SaveHistory() error {
+	path := b.cfg.MyGekko.HistoryFile
+	if path == "" {
+		return nil
+	}
+
+	b.historyMu.RLock()
+	stored := make(map[string]storedEntry, len(b.history))
+	for histKey, entry := range b.history {
+		s := storedEntry{Value: entry.value, Unchanged: entry.unchanged, Published: entry.published, Seen: entry.seen, Changed: entry.changed}
+		switch entry.value.(type) {
+		case int64:
+			s.Type = "int"
+		case float64:
+			s.Type = "float"
+		case string:
+			s.Type = "string"
+		case bool:
+			s.Type = "bool"
+		default:
+			continue
+		}
+		stored[histKey] = s
+	}
+	b.historyMu.RUnlock()
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("cannot encode history: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".history-*")
+	if err != nil {
+		return fmt.Errorf("cannot write history file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot write history file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write history file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("cannot write history file: %w", err)
+	}
+	slog.Info("Saved history", "path", path, "entries", len(stored))
+	return nil
+}
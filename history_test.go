@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistoryFile_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	cfg := &Config{MyGekko: MyGekkoConfig{HistoryFile: path}}
+	fieldDefs := map[string][]FieldDef{
+		"roomtemps": {
+			{Name: "temperature", Type: "float"},
+			{Name: "mode", Type: "int"},
+			{Name: "name", Type: "string"},
+		},
+	}
+	status := map[string]any{
+		"roomtemps": map[string]any{
+			"item0": map[string]any{"sumstate": map[string]any{"value": "21.5;2;Kitchen"}},
+		},
+	}
+
+	mockGekko := NewMockGekko("TestGekko")
+	mockGekko.status = status
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.pollCategories([]string{"roomtemps"})
+	if got, _ := lastPublished(mockMQTT, "roomtemps/item0/get/mode"); got != int64(2) {
+		t.Fatalf("expected mode published before the restart, got %v", got)
+	}
+	bridge.Stop()
+
+	// After the restart, unchanged values are not published again
+	mockMQTT = NewMockMQTT()
+	bridge, err = NewBridge(cfg, mockGekko, mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+	bridge.pollCategories([]string{"roomtemps"})
+	for _, msg := range mockMQTT.published {
+		if msg.Topic != "roomtemps/get/time" && msg.Topic != "roomtemps/index" {
+			t.Errorf("expected no value republished, got %s = %v", msg.Topic, msg.Value)
+		}
+	}
+}
+
+func TestLoadHistory_MissingOrCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	if got := loadHistory(filepath.Join(dir, "missing.json")); len(got) != 0 {
+		t.Errorf("expected empty history for a missing file, got %v", got)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(corrupt, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if got := loadHistory(corrupt); len(got) != 0 {
+		t.Errorf("expected empty history for a corrupt file, got %v", got)
+	}
+}
+
+func TestSuppressInitialPublish(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{SuppressInitialPublish: true}}
+	mockGekko := NewMockGekko("TestGekko")
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+	}
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	items := map[string]any{
+		"item0": map[string]any{"sumstate": map[string]any{"value": "50"}},
+		"item1": map[string]any{"sumstate": map[string]any{"value": "20"}},
+	}
+	mockGekko.status = map[string]any{"blinds": items}
+	bridge.pollCategories([]string{"blinds"})
+	if _, ok := lastPublished(mockMQTT, "blinds/item0/get/position"); ok {
+		t.Fatal("expected no value published by the initial poll")
+	}
+
+	// The getter ends the quiet start after its initial poll
+	bridge.quietStart = false
+	items["item0"] = map[string]any{"sumstate": map[string]any{"value": "60"}}
+	bridge.pollCategories([]string{"blinds"})
+	if got, _ := lastPublished(mockMQTT, "blinds/item0/get/position"); got != int64(60) {
+		t.Errorf("expected changed value published, got %v", got)
+	}
+	if _, ok := lastPublished(mockMQTT, "blinds/item1/get/position"); ok {
+		t.Error("expected unchanged value not published")
+	}
+}
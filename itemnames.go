@@ -0,0 +1,106 @@
+package main
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var slugReplacer = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss")
+
+// slugify turns an item name into a topic segment: lower case ASCII letters,
+// digits and underscores ("Living Room Blind" -> "living_room_blind").
+func slugify(name string) string {
+	var sb strings.Builder
+	underscore := false
+	for _, r := range slugReplacer.Replace(strings.ToLower(name)) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			sb.WriteRune(r)
+			underscore = false
+		} else if !underscore && sb.Len() > 0 {
+			sb.WriteByte('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "_")
+}
+
+// itemNumber orders item keys numerically (item2 before item10).
+func itemNumber(item string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(item, "item"))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// compareItems orders item keys by number, then by name.
+func compareItems(a, b string) int {
+	return cmp.Or(cmp.Compare(itemNumber(a), itemNumber(b)), cmp.Compare(a, b))
+}
+
+// itemSlugs maps the items of every category to the slug of their name, for
+// item_names. Items without a usable name keep their key. A slug that is
+// already taken in the category gets the item key appended
+// ("blind_item3"), so the lowest item keeps the plain slug.
+func itemSlugs(info map[string]map[string]ItemInfo) map[string]map[string]string {
+	result := make(map[string]map[string]string, len(info))
+	for category, items := range info {
+		keys := slices.SortedFunc(maps.Keys(items), compareItems)
+
+		slugs := make(map[string]string, len(items))
+		taken := make(map[string]bool, len(items))
+		// Unnamed items keep their key, which no slug may shadow
+		for _, item := range keys {
+			if slugify(items[item].Name) == "" {
+				slugs[item] = item
+				taken[item] = true
+			}
+		}
+		for _, item := range keys {
+			slug := slugify(items[item].Name)
+			if slug == "" {
+				continue
+			}
+			if taken[slug] {
+				slug += "_" + item
+			}
+			slugs[item] = slug
+			taken[slug] = true
+		}
+		result[category] = slugs
+	}
+	return result
+}
+
+// itemTopic returns the topic segment of an item: its slug with item_names,
+// else the item key.
+func (b *Bridge) itemTopic(category, item string) string {
+	if !b.cfg.MyGekko.ItemNames {
+		return item
+	}
+	b.defsMu.RLock()
+	defer b.defsMu.RUnlock()
+	if slug, ok := b.slugs[category][item]; ok {
+		return slug
+	}
+	return item
+}
+
+// itemKey maps the item segment of a topic back to the item key, the
+// reverse of itemTopic. The key itself is accepted as well.
+func (b *Bridge) itemKey(category, segment string) string {
+	if !b.cfg.MyGekko.ItemNames {
+		return segment
+	}
+	b.defsMu.RLock()
+	defer b.defsMu.RUnlock()
+	for item, slug := range b.slugs[category] {
+		if slug == segment {
+			return item
+		}
+	}
+	return segment
+}
@@ -0,0 +1,91 @@
+package main
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	cases := map[string]string{
+		"Living Room Blind": "living_room_blind",
+		"Küche / Süd":       "kueche_sued",
+		"  Licht 2 ":        "licht_2",
+		"---":               "",
+	}
+	for name, want := range cases {
+		if got := slugify(name); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestItemSlugs_Collisions(t *testing.T) {
+	slugs := itemSlugs(map[string]map[string]ItemInfo{
+		"blinds": {
+			"item10": {Name: "Kitchen"},
+			"item2":  {Name: "kitchen"},
+			"item3":  {Name: "Living Room"},
+			"item4":  {},
+			"item5":  {Name: "item4"},
+		},
+	})["blinds"]
+
+	want := map[string]string{
+		"item2":  "kitchen",
+		"item10": "kitchen_item10",
+		"item3":  "living_room",
+		"item4":  "item4",
+		"item5":  "item4_item5",
+	}
+	for item, slug := range want {
+		if slugs[item] != slug {
+			t.Errorf("expected %s -> %s, got %s", item, slug, slugs[item])
+		}
+	}
+}
+
+func TestItemNames_Topics(t *testing.T) {
+	var sent []string
+	mockGekko := NewMockGekko("TestGekko")
+	mockGekko.setValue = func(category, item, value string) error {
+		sent = append(sent, item+"="+value)
+		return nil
+	}
+	mockMQTT := NewMockMQTT()
+	cfg := &Config{MyGekko: MyGekkoConfig{ItemNames: true, PublishMeta: true}}
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bridge.SetItemInfo(ParseItemInfo(map[string]any{
+		"blinds": map[string]any{
+			"item0": map[string]any{"en": "Living Room Blind"},
+			"item1": map[string]any{},
+		},
+	}))
+
+	bridge.processItem("blinds", "item0", map[string]any{"value": "50"})
+	bridge.processItem("blinds", "item1", map[string]any{"value": "20"})
+	if _, ok := lastPublished(mockMQTT, "blinds/living_room_blind/get/position"); !ok {
+		t.Errorf("expected the slug in the topic, got %+v", mockMQTT.published)
+	}
+	if _, ok := lastPublished(mockMQTT, "blinds/item1/get/position"); !ok {
+		t.Errorf("expected an unnamed item to keep its key, got %+v", mockMQTT.published)
+	}
+
+	bridge.processSetCommand("blinds/living_room_blind/set", []byte("P30"))
+	bridge.processSetCommand("blinds/item1/set", []byte("P10"))
+	if len(sent) != 2 || sent[0] != "item0=P30" || sent[1] != "item1=P10" {
+		t.Errorf("expected set commands to be sent to the item keys, got %v", sent)
+	}
+
+	bridge.publishItemInfo()
+	found := false
+	for _, msg := range mockMQTT.jsonPublished {
+		if meta, ok := msg.Data.(itemMeta); ok && msg.Topic == "blinds/living_room_blind/meta" {
+			found = meta.Item == "item0" && meta.Name == "Living Room Blind"
+		}
+	}
+	if !found {
+		t.Errorf("expected the meta document with the item key, got %+v", mockMQTT.jsonPublished)
+	}
+}
@@ -1,30 +1,64 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"strings"
 )
 
-func SetupLogger(level string) {
-	var logLevel slog.Level
+// logLevel is the level of the default logger. It is a LevelVar so it can be
+// changed at runtime without rebuilding the handler.
+var logLevel = new(slog.LevelVar)
 
-	switch strings.ToUpper(level) {
+// ParseLogLevel parses a level name: DEBUG, INFO, WARN/WARNING or ERROR
+// (case-insensitive).
+func ParseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(level)) {
 	case "DEBUG":
-		logLevel = slog.LevelDebug
+		return slog.LevelDebug, nil
 	case "INFO":
-		logLevel = slog.LevelInfo
+		return slog.LevelInfo, nil
 	case "WARN", "WARNING":
-		logLevel = slog.LevelWarn
+		return slog.LevelWarn, nil
 	case "ERROR":
-		logLevel = slog.LevelError
+		return slog.LevelError, nil
 	default:
-		logLevel = slog.LevelInfo
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", level)
 	}
+}
+
+// SetupLogger installs the default logger, writing in the given format (text
+// or json). Unknown level names fall back to INFO. The returned LevelVar
+// changes the level at runtime.
+func SetupLogger(level, format string) *slog.LevelVar {
+	lvl, _ := ParseLogLevel(level)
+	logLevel.Set(lvl)
+
+	slog.SetDefault(slog.New(newLogHandler(os.Stdout, format)))
+	return logLevel
+}
 
-	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+// newLogHandler creates the handler for the log format: one JSON object per
+// record for json, key=value pairs otherwise.
+func newLogHandler(w io.Writer, format string) slog.Handler {
+	opts := &slog.HandlerOptions{
 		Level: logLevel,
-	})
+	}
+	if format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
 
-	slog.SetDefault(slog.New(handler))
+// SetLogLevel changes the level of the default logger at runtime. An invalid
+// level name is rejected and leaves the current level intact.
+func SetLogLevel(level string) error {
+	lvl, err := ParseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	logLevel.Set(lvl)
+	return nil
 }
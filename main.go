@@ -1,38 +1,71 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log/slog"
+	"maps"
+	"net"
 	"os"
 	"os/signal"
-	"syscall"
+	"slices"
+	"time"
 )
 
-// Set by -ldflags at build time
-var commit = "unknown"
-
 func main() {
 	// Parse command line flags
 	configPath := flag.String("config", "config.toml", "path to config file")
 	showVersion := flag.Bool("version", false, "show version and exit")
+	dumpDefinitions := flag.Bool("dump-definitions", false, "print the field definitions parsed from MyGEKKO and exit")
+	validate := flag.Bool("validate", false, "check the config file (and definitions_file) and exit")
+	dryRun := flag.Bool("dry-run", false, "log set commands instead of sending them (overrides mygekko.dry_run)")
 	flag.Parse()
 
 	if *showVersion {
-		fmt.Println(commit)
+		fmt.Println(currentBuildInfo())
 		return
 	}
 
 	// Load configuration
 	cfg, err := LoadConfig(*configPath)
+	if *validate {
+		// Only local files are checked; nothing is connected
+		if err == nil && cfg.MyGekko.DefinitionsFile != "" {
+			_, err = LoadDefinitionsFile(cfg.MyGekko.DefinitionsFile)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: OK\n", *configPath)
+		return
+	}
 	if err != nil {
 		slog.Error("Failed to load config", "error", err)
 		os.Exit(1)
 	}
+	if *dryRun {
+		cfg.MyGekko.DryRun = true
+	}
 
 	// Setup logging
-	SetupLogger(cfg.LogLevel)
-	slog.Info("Starting mygekko-mqtt bridge", "commit", commit)
+	levelVar := SetupLogger(cfg.LogLevel, cfg.LogFormat)
+	slog.Info("Starting mygekko-mqtt bridge", "version", version, "commit", commit)
+	if cfg.MyGekko.DryRun {
+		slog.Warn("Dry run: set commands are logged, not sent to MyGEKKO")
+	}
+
+	// Load local field definitions before connecting anywhere, so a broken
+	// file fails fast
+	var fileDefinitions map[string][]FieldDef
+	if cfg.MyGekko.DefinitionsFile != "" {
+		fileDefinitions, err = LoadDefinitionsFile(cfg.MyGekko.DefinitionsFile)
+		if err != nil {
+			slog.Error("Failed to load definitions file", "error", err)
+			os.Exit(1)
+		}
+	}
 
 	// Lookup user/group before chroot (needs /etc/passwd, /etc/group)
 	uid, err := lookupUID(cfg.Sandbox.User)
@@ -53,32 +86,92 @@ func main() {
 		os.Exit(4)
 	}
 
+	// A controller booting along with the bridge may not answer yet
+	startupAttempts := cfg.MyGekko.StartupAttempts
+	startupInterval := time.Duration(cfg.MyGekko.StartupRetryInterval * float64(time.Second))
+
 	// Get gekko name first (needed for MQTT LWT topic)
-	gekkoName, err := gekko.GetGekkoName()
+	var rawName string
+	err = retryStartup(startupAttempts, startupInterval, "gekko name", func() error {
+		rawName, err = gekko.GetGekkoName()
+		return err
+	})
 	if err != nil {
 		slog.Error("Failed to get gekko name", "error", err)
 		os.Exit(4)
 	}
+	gekkoName, err := cleanGekkoName(rawName)
+	if err != nil {
+		slog.Error("Invalid gekko name", "error", err)
+		os.Exit(4)
+	}
+	if gekkoName != rawName {
+		slog.Info("Cleaned gekko name for MQTT topics", "raw", rawName, "name", gekkoName)
+	}
 	slog.Info("Gekko name", "name", gekkoName)
 
-	// Load field definitions from MyGEKKO
-	fieldDefinitions, err := LoadFieldDefinitions(gekko)
+	// Load field definitions from MyGEKKO, with the local overrides on top.
+	// The same loader refreshes them at runtime.
+	configDefinitions, _ := convertDefinitions(cfg.MyGekko.Definitions) // validated with the config
+	loadDefinitions := func(ctx context.Context) (map[string][]FieldDef, map[string]map[string]ItemInfo, error) {
+		fieldDefinitions, itemInfo, err := LoadFieldDefinitions(ctx, gekko)
+		if err != nil {
+			return nil, nil, err
+		}
+		MergeFieldDefinitions(fieldDefinitions, fileDefinitions)
+		MergeFieldDefinitions(fieldDefinitions, configDefinitions)
+		if cfg.MyGekko.BoolEnums {
+			ApplyBoolEnums(fieldDefinitions)
+		}
+		ApplyFieldTypes(fieldDefinitions, cfg.MyGekko.FieldTypes)
+		return fieldDefinitions, itemInfo, nil
+	}
+	var fieldDefinitions map[string][]FieldDef
+	var itemInfo map[string]map[string]ItemInfo
+	err = retryStartup(startupAttempts, startupInterval, "definitions", func() error {
+		defCtx, defCancel := context.WithTimeout(context.Background(), time.Duration(cfg.MyGekko.DefinitionsTimeout*float64(time.Second)))
+		defer defCancel()
+		fieldDefinitions, itemInfo, err = loadDefinitions(defCtx)
+		return err
+	})
 	if err != nil {
 		slog.Error("Failed to parse definitions", "error", err)
 		os.Exit(4)
 	}
+	if *dumpDefinitions {
+		if err := DumpDefinitions(os.Stdout, fieldDefinitions); err != nil {
+			slog.Error("Failed to dump definitions", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	DiscoverItems(&cfg.MyGekko, fieldDefinitions)
+	if err := CheckCategories(&cfg.MyGekko, fieldDefinitions); err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		os.Exit(4)
+	}
 
 	// Connect to MQTT with LWT (Last Will Testament)
-	mqtt, err := NewMQTTClient(cfg.MQTT, gekkoName)
+	mqtt, err := newBrokerClient(cfg.MQTT, gekkoName)
 	if err != nil {
 		slog.Error("Failed to connect to MQTT", "error", err)
 		os.Exit(5)
 	}
 	defer mqtt.Disconnect()
 
+	// Listen for the state API before the sandbox (privileged ports)
+	var apiListener net.Listener
+	if cfg.APIAddr != "" {
+		apiListener, err = net.Listen("tcp", cfg.APIAddr)
+		if err != nil {
+			slog.Error("Failed to listen for the state API", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	// Sandbox: chroot, drop privileges, pledge
 	// Done after connections are established - only needs existing sockets
-	if err := sandbox(cfg.Sandbox.Chroot, uid, gid); err != nil {
+	if err := sandbox(cfg.Sandbox.Chroot, uid, gid, cfg.MyGekko.HistoryFile != ""); err != nil {
 		slog.Error("Failed to sandbox", "error", err)
 		os.Exit(3)
 	}
@@ -89,16 +182,77 @@ func main() {
 		slog.Error("Failed to create bridge", "error", err)
 		os.Exit(1)
 	}
+	bridge.SetItemInfo(itemInfo)
+	bridge.PublishName(rawName)
+	bridge.PublishVersion(currentBuildInfo())
+	bridge.SetDefinitionsLoader(loadDefinitions)
+	if err := bridge.Subscribe(); err != nil {
+		slog.Error("Failed to subscribe", "error", err)
+		os.Exit(7)
+	}
+	bridge.PublishDiscovery()
+	// Retained state the broker may have lost, or that could not be
+	// published before the first connect, including the running state of
+	// the getter and setter
+	mqtt.OnConnect(func() {
+		bridge.PublishName(rawName)
+		bridge.PublishVersion(currentBuildInfo())
+		bridge.PublishDiscovery()
+		bridge.publishRunning("getter", true)
+		if !cfg.MyGekko.ReadOnly {
+			bridge.publishRunning("setter", true)
+		}
+	})
 
-	// Handle shutdown signals
+	// Handle signals: shutdown and the runtime actions from [signals]
+	actions, err := signalActions(cfg.Signals)
+	if err != nil {
+		slog.Error("Invalid signal configuration", "error", err)
+		os.Exit(1)
+	}
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, slices.Collect(maps.Keys(actions))...)
 
-	go bridge.RunGetter()
-	go bridge.RunSetter()
+	bridge.Go(bridge.RunGetter)
+	if apiListener != nil {
+		bridge.Go(func() { bridge.ServeAPI(apiListener) })
+	}
+	if cfg.MyGekko.ReadOnly {
+		slog.Info("Read-only mode, set commands are disabled")
+	} else {
+		bridge.Go(bridge.RunSetter)
+	}
 
-	// Wait for shutdown signal
-	sig := <-sigChan
-	slog.Info("Received signal, shutting down", "signal", sig)
-	bridge.Stop()
+	configuredLevel, _ := ParseLogLevel(cfg.LogLevel)
+	for sig := range sigChan {
+		switch actions[sig] {
+		case actionShutdown:
+			slog.Info("Received signal, shutting down", "signal", sig)
+			bridge.Stop()
+			return
+		case actionReload:
+			// A config that fails to load or validate keeps the running one
+			newCfg, err := LoadConfig(*configPath)
+			if err != nil {
+				slog.Error("Failed to reload config, keeping the current one", "signal", sig, "error", err)
+				continue
+			}
+			if *dryRun {
+				newCfg.MyGekko.DryRun = true
+			}
+			configuredLevel, _ = ParseLogLevel(newCfg.LogLevel)
+			levelVar.Set(configuredLevel)
+			bridge.Reload(newCfg)
+			slog.Info("Reloaded config", "signal", sig, "path", *configPath)
+		case actionDumpStats:
+			bridge.LogStats("Bridge statistics")
+		case actionToggleLogLevel:
+			if levelVar.Level() == slog.LevelDebug {
+				levelVar.Set(configuredLevel)
+			} else {
+				levelVar.Set(slog.LevelDebug)
+			}
+			slog.Info("Toggled log level", "signal", sig, "level", levelVar.Level())
+		}
+	}
 }
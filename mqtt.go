@@ -1,20 +1,215 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/url"
 	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+// tokenTimeout bounds the wait for paho to complete a publish or subscribe,
+// so a connection lost while one is in flight cannot block the caller.
+const tokenTimeout = 10 * time.Second
+
+// errNotConnected is returned by publishes while the broker is unreachable
+var errNotConnected = errors.New("not connected to the MQTT broker")
+
+// connState tracks the broker connection for Stats and reacts to a lost
+// connection. It is shared by MQTTClient and MQTT5Client, which report their
+// connection events to it.
+type connState struct {
+	// Counters for Stats, updated from publishing goroutines and the
+	// connection handlers of the client library.
+	published   atomic.Uint64
+	acked       atomic.Uint64
+	failed      atomic.Uint64
+	inFlight    atomic.Int64
+	connects    atomic.Uint64
+	lastConnect atomic.Int64 // Unix seconds, 0 if never connected
+
+	// lostGrace delays the reaction to an unexpected connection loss; a
+	// reconnect within the grace period cancels it.
+	lostGrace  time.Duration
+	graceMu    sync.Mutex
+	graceTimer *time.Timer
+	// onOffline is called when the connection stays lost past the grace period
+	onOffline func(err error)
+
+	// maxReconnects bounds the reconnect attempts after a lost connection
+	// (0: unlimited); onGiveUp is called once they are used up.
+	maxReconnects     int
+	reconnectAttempts atomic.Int64
+	onGiveUp          func(attempts int64)
+}
+
 type MQTTClient struct {
+	connState
+
 	client mqtt.Client
 	root   string
+
+	// QoS and retained flag of state publishes
+	qos    byte
+	retain bool
+	// subQoS is the QoS of the subscriptions, i.e. of incoming commands
+	subQoS byte
+
+	// Availability topic (relative to root) and its payloads, also used as
+	// the LWT
+	willTopic      string
+	onlinePayload  string
+	offlinePayload string
+
+	// subs remembers the subscriptions to restore them after a reconnect
+	subsMu sync.Mutex
+	subs   map[string]mqtt.MessageHandler
+	// onConnectFn is called after subscriptions were restored (OnConnect),
+	// guarded by subsMu
+	onConnectFn func()
+
+	// bufferSize caps the retained topics held back while the connection is
+	// down (offline_buffer, 0: none). buffer keeps the latest payload per
+	// topic, bufferOrder the topics in order of their first publish.
+	bufferSize  int
+	bufferMu    sync.Mutex
+	buffer      map[string]bufferedPublish
+	bufferOrder []string
+	bufferFull  bool
+}
+
+// bufferedPublish is a retained publish held back while disconnected
+type bufferedPublish struct {
+	qos     byte
+	payload any
+}
+
+// MQTTStats is a snapshot of the MQTT connection state and publish counters
+type MQTTStats struct {
+	Connected   bool   `json:"connected"`
+	Published   uint64 `json:"published"`
+	Acked       uint64 `json:"acked"`
+	Failed      uint64 `json:"failed"`
+	InFlight    int64  `json:"in_flight"`
+	Reconnects  uint64 `json:"reconnects"`
+	LastConnect int64  `json:"last_connect"`
+	Buffered    int    `json:"buffered"`
+}
+
+// cleanGekkoName turns the gekko name reported by the controller into a topic
+// segment: runs of whitespace, slashes, MQTT wildcards and control characters
+// become a single underscore, and leading or trailing ones are dropped
+// ("Haus Müller" -> "Haus_Müller"). A name that is empty afterwards is
+// rejected.
+func cleanGekkoName(name string) (string, error) {
+	var sb strings.Builder
+	pending := false
+	for _, r := range name {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune("/+#", r) {
+			pending = sb.Len() > 0
+			continue
+		}
+		if pending {
+			sb.WriteByte('_')
+			pending = false
+		}
+		sb.WriteRune(r)
+	}
+	if sb.Len() == 0 {
+		return "", fmt.Errorf("gekko name %q is empty", name)
+	}
+	return sb.String(), nil
+}
+
+// tlsSchemes are the broker URL schemes paho connects to with TLS
+var tlsSchemes = map[string]bool{"ssl": true, "tls": true, "mqtts": true, "tcps": true, "wss": true}
+
+// newBrokerTLSConfig builds the TLS configuration for the broker from the
+// tls_* options, or returns nil to use paho's default (system roots).
+func newBrokerTLSConfig(cfg MQTTConfig) (*tls.Config, error) {
+	if cfg.TLSCAFile == "" && cfg.TLSCertFile == "" && !cfg.TLSInsecureSkipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.TLSInsecureSkipVerify}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read MQTT TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("MQTT TLS CA file %s contains no certificates", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load MQTT client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// parseBrokerURL parses and checks the broker URL: a network URL with a
+// scheme paho supports and a host, or unix:///path/to/socket.
+func parseBrokerURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT URL: %w", err)
+	}
+	switch u.Scheme {
+	case "unix":
+		if u.Path == "" {
+			return nil, fmt.Errorf("invalid MQTT URL %q: unix socket path is missing", raw)
+		}
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "tcps", "ws", "wss":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid MQTT URL %q: host is missing", raw)
+		}
+	default:
+		return nil, fmt.Errorf("invalid MQTT URL %q: unsupported scheme %q", raw, u.Scheme)
+	}
+	return u, nil
+}
+
+// brokerURLs returns url followed by urls, in the order paho tries them.
+func (c MQTTConfig) brokerURLs() []string {
+	var brokers []string
+	if c.URL != "" {
+		brokers = append(brokers, c.URL)
+	}
+	return append(brokers, c.URLs...)
+}
+
+// brokerClient is an MQTTClient or MQTT5Client, as used by main.
+type brokerClient interface {
+	MQTTPublisher
+	OnConnect(fn func())
+	Disconnect()
+}
+
+// newBrokerClient connects to the broker with the client for
+// protocol_version.
+func newBrokerClient(cfg MQTTConfig, gekkoName string) (brokerClient, error) {
+	if cfg.ProtocolVersion == 5 {
+		return NewMQTT5Client(cfg, gekkoName)
+	}
+	return NewMQTTClient(cfg, gekkoName)
 }
 
 func NewMQTTClient(cfg MQTTConfig, gekkoName string) (*MQTTClient, error) {
@@ -22,27 +217,58 @@ func NewMQTTClient(cfg MQTTConfig, gekkoName string) (*MQTTClient, error) {
 
 	// Root topic includes gekko name
 	root := cfg.Root + "/" + gekkoName
-
-	// Parse the URL to determine connection type
-	parsedURL, err := url.Parse(cfg.URL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid MQTT URL: %w", err)
+	m := &MQTTClient{
+		root:           root,
+		qos:            cfg.QoS,
+		subQoS:         cfg.SubscribeQoS,
+		retain:         cfg.Retain == nil || *cfg.Retain,
+		willTopic:      cfg.WillTopic,
+		onlinePayload:  cfg.WillOnline,
+		offlinePayload: cfg.WillOffline,
+		connState:      newConnState(cfg),
+		bufferSize:     cfg.OfflineBuffer,
 	}
 
-	slog.Info("Connecting to MQTT", "url", cfg.URL)
+	// Every broker is added in order; paho fails over to the next one when
+	// a connect fails
+	for _, brokerURL := range cfg.brokerURLs() {
+		// Parse the URL to determine connection type
+		parsedURL, err := parseBrokerURL(brokerURL)
+		if err != nil {
+			return nil, err
+		}
 
-	// Handle Unix socket connections
-	if parsedURL.Scheme == "unix" {
-		socketPath := parsedURL.Path
-		slog.Info("Using Unix socket", "path", socketPath)
-		opts.SetCustomOpenConnectionFn(func(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
-			slog.Debug("Opening Unix socket connection", "path", socketPath)
-			return net.Dial("unix", socketPath)
-		})
-		// paho needs a broker URL, use tcp://localhost as dummy since we override the connection
-		opts.AddBroker("tcp://localhost:1883")
-	} else {
-		opts.AddBroker(cfg.URL)
+		slog.Info("Adding MQTT broker", "url", brokerURL)
+
+		// Handle Unix socket connections (validated to be the only broker);
+		// every other scheme, including WebSockets (ws://, wss://), is a
+		// broker URL paho dials itself
+		switch parsedURL.Scheme {
+		case "unix":
+			socketPath := parsedURL.Path
+			slog.Info("Using Unix socket", "path", socketPath)
+			opts.SetCustomOpenConnectionFn(func(uri *url.URL, options mqtt.ClientOptions) (net.Conn, error) {
+				slog.Debug("Opening Unix socket connection", "path", socketPath)
+				return net.Dial("unix", socketPath)
+			})
+			// paho needs a broker URL, use tcp://localhost as dummy since we override the connection
+			opts.AddBroker("tcp://localhost:1883")
+		case "ws", "wss":
+			// The URL path is the WebSocket endpoint (often /mqtt); wss uses
+			// the TLS options like ssl://
+			slog.Info("Using WebSocket", "path", parsedURL.Path)
+			opts.AddBroker(brokerURL)
+		default:
+			opts.AddBroker(brokerURL)
+		}
+	}
+	// Certificates are read now, before the sandbox
+	tlsConfig, err := newBrokerTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
 	}
 	opts.SetUsername(cfg.Username)
 	opts.SetPassword(cfg.Password)
@@ -57,74 +283,416 @@ func NewMQTTClient(cfg MQTTConfig, gekkoName string) (*MQTTClient, error) {
 	opts.SetConnectRetry(true)
 	opts.SetConnectRetryInterval(5 * time.Second)
 
-	// Set Last Will Testament - broker publishes "false" if we disconnect unexpectedly
-	onlineTopic := root + "/online"
-	slog.Info("Setting LWT", "topic", onlineTopic)
-	opts.SetWill(onlineTopic, "false", 1, true) // QoS 1 for reliability
+	// Set Last Will Testament - broker publishes the offline payload if we
+	// disconnect unexpectedly
+	willTopic := m.Topic(m.willTopic)
+	slog.Info("Setting LWT", "topic", willTopic, "payload", m.offlinePayload)
+	opts.SetWill(willTopic, m.offlinePayload, 1, true) // QoS 1 for reliability
 
-	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
-		if err != nil {
-			slog.Error("Unexpected MQTT disconnection. Will exit", "error", err)
-			os.Exit(10)
-		} else {
-			slog.Info("Expected MQTT disconnection. Will auto-reconnect")
+	opts.SetConnectionLostHandler(m.onConnectionLost)
+	opts.SetReconnectingHandler(m.onReconnecting)
+	opts.SetOnConnectHandler(m.onConnect)
+
+	m.client = mqtt.NewClient(opts)
+	timeout := time.Duration(cfg.ConnectTimeout * float64(time.Second))
+	if err := m.connect(cfg.StartWithoutBroker, timeout); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// connect performs the initial connect. Normally it waits until paho is
+// connected; with startWithoutBroker it gives up waiting after timeout and
+// leaves paho retrying in the background. Until the broker comes up,
+// publishes fail (or are buffered, see offline_buffer) and subscriptions are
+// only recorded, to be made by onConnect.
+func (m *MQTTClient) connect(startWithoutBroker bool, timeout time.Duration) error {
+	token := m.client.Connect()
+	if !startWithoutBroker {
+		if token.Wait() && token.Error() != nil {
+			return fmt.Errorf("MQTT connection failed: %w", token.Error())
 		}
-	})
+		return nil
+	}
+
+	if !token.WaitTimeout(timeout) {
+		slog.Warn("MQTT broker not reachable, starting without it", "timeout", timeout)
+		return nil
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("MQTT connection failed: %w", err)
+	}
+	return nil
+}
 
-	opts.SetOnConnectHandler(func(c mqtt.Client) {
-		slog.Info("Connected to MQTT")
-		// Publish online status (retained)
-		token := c.Publish(onlineTopic, 0, true, "true")
-		token.Wait()
-		if token.Error() != nil {
-			slog.Error("Failed to publish online status", "error", token.Error())
-			os.Exit(6)
+// newConnState returns the connection state for the reconnect options of cfg.
+func newConnState(cfg MQTTConfig) connState {
+	return connState{
+		lostGrace:     time.Duration(cfg.ConnectionLostGrace * float64(time.Second)),
+		onOffline:     logOffline,
+		maxReconnects: cfg.MaxReconnectAttempts,
+		onGiveUp:      exitGiveUp,
+	}
+}
+
+// logOffline is the default reaction to a connection that stays lost past
+// the grace period; paho keeps reconnecting in the background.
+func logOffline(err error) {
+	slog.Error("Unexpected MQTT disconnection. Will auto-reconnect", "error", err)
+}
+
+// exitGiveUp is called once max_reconnect_attempts reconnects have failed:
+// exit, so a supervisor restarts the bridge.
+func exitGiveUp(attempts int64) {
+	slog.Error("Giving up reconnecting to MQTT. Will exit", "attempts", attempts)
+	os.Exit(10)
+}
+
+// onReconnecting runs before every reconnect attempt after a lost connection.
+func (m *MQTTClient) onReconnecting(c mqtt.Client, opts *mqtt.ClientOptions) {
+	m.reconnecting()
+}
+
+// onConnectionLost runs when paho loses the broker connection; paho then
+// reconnects on its own.
+func (m *MQTTClient) onConnectionLost(c mqtt.Client, err error) {
+	if err == nil {
+		slog.Info("Expected MQTT disconnection. Will auto-reconnect")
+		return
+	}
+	m.lost(err)
+}
+
+// reconnecting counts a reconnect attempt and gives up once
+// max_reconnect_attempts are used up.
+func (s *connState) reconnecting() {
+	n := s.reconnectAttempts.Add(1)
+	slog.Debug("Reconnecting to MQTT", "attempt", n)
+	if s.maxReconnects > 0 && n > int64(s.maxReconnects) {
+		s.onGiveUp(n - 1)
+	}
+}
+
+// lost handles an unexpected connection loss. It is reported only if no
+// reconnect happens within the grace period, so brief network hiccups stay
+// quiet.
+func (s *connState) lost(err error) {
+	if s.lostGrace <= 0 {
+		s.onOffline(err)
+		return
+	}
+
+	s.graceMu.Lock()
+	defer s.graceMu.Unlock()
+	if s.graceTimer != nil {
+		return
+	}
+	slog.Info("MQTT connection lost, waiting for reconnect", "grace", s.lostGrace, "error", err)
+	var timer *time.Timer
+	timer = time.AfterFunc(s.lostGrace, func() {
+		s.graceMu.Lock()
+		expired := s.graceTimer == timer
+		if expired {
+			s.graceTimer = nil
+		}
+		s.graceMu.Unlock()
+		// A reconnect may have cancelled us while we waited for the lock
+		if expired {
+			s.onOffline(err)
 		}
 	})
+	s.graceTimer = timer
+}
+
+// connected records a (re)connect and cancels a pending grace period.
+func (s *connState) connected() {
+	slog.Info("Connected to MQTT")
+	s.connects.Add(1)
+	s.lastConnect.Store(time.Now().Unix())
+	s.reconnectAttempts.Store(0)
+
+	s.graceMu.Lock()
+	if s.graceTimer != nil {
+		s.graceTimer.Stop()
+		slog.Info("Reconnected within grace period")
+	}
+	s.graceTimer = nil
+	s.graceMu.Unlock()
+}
+
+// stats returns a snapshot of the counters.
+func (s *connState) stats(connected bool, buffered int) MQTTStats {
+	var reconnects uint64
+	if n := s.connects.Load(); n > 1 {
+		reconnects = n - 1
+	}
+	return MQTTStats{
+		Connected:   connected,
+		Published:   s.published.Load(),
+		Acked:       s.acked.Load(),
+		Failed:      s.failed.Load(),
+		InFlight:    s.inFlight.Load(),
+		Reconnects:  reconnects,
+		LastConnect: s.lastConnect.Load(),
+		Buffered:    buffered,
+	}
+}
+
+// onConnect runs on every (re)connect to the broker.
+func (m *MQTTClient) onConnect(c mqtt.Client) {
+	m.connected()
+
+	// Publish online status (retained). A failure must not end the process
+	// from within a reconnect; it is logged and the connect carries on.
+	token := c.Publish(m.Topic(m.willTopic), 0, true, m.onlinePayload)
+	if !token.WaitTimeout(tokenTimeout) {
+		m.failed.Add(1)
+		slog.Error("Failed to publish online status", "error", "timed out")
+	} else if err := token.Error(); err != nil {
+		m.failed.Add(1)
+		slog.Error("Failed to publish online status", "error", err)
+	}
+
+	// A clean session drops our subscriptions with the connection, and
+	// subscriptions recorded before the first connect are still to be made
+	m.resubscribe(c)
+	m.subsMu.Lock()
+	fn := m.onConnectFn
+	m.subsMu.Unlock()
+	if fn != nil {
+		fn()
+	}
+
+	m.flushBuffer()
+}
+
+// OnConnect registers fn to run after every following connect to the
+// broker, e.g. to republish state the broker may have lost, or that could not
+// be published before the first connect with start_without_broker.
+func (m *MQTTClient) OnConnect(fn func()) {
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+	m.onConnectFn = fn
+}
+
+// resubscribe makes all recorded subscriptions after a connect.
+func (m *MQTTClient) resubscribe(c mqtt.Client) {
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+	for topic, handler := range m.subs {
+		token := c.Subscribe(topic, m.subQoS, handler)
+		if !token.WaitTimeout(tokenTimeout) {
+			slog.Error("Failed to resubscribe", "topic", topic, "error", "timed out")
+			continue
+		}
+		if err := token.Error(); err != nil {
+			slog.Error("Failed to resubscribe", "topic", topic, "error", err)
+			continue
+		}
+		slog.Debug("Resubscribed", "topic", topic)
+	}
+}
+
+// publish sends a payload to an absolute topic and waits for completion,
+// keeping the counters reported by Stats up to date. While the connection is
+// down, paho would hold the message until the broker comes up and block the
+// caller meanwhile, so the publish fails instead; with offline_buffer, a
+// retained publish is held back.
+func (m *MQTTClient) publish(topic string, qos byte, retained bool, payload any) error {
+	if !m.client.IsConnectionOpen() {
+		if m.bufferSize > 0 && retained {
+			return m.hold(topic, qos, payload)
+		}
+		m.published.Add(1)
+		m.failed.Add(1)
+		return fmt.Errorf("publish %s: %w", topic, errNotConnected)
+	}
+	if m.bufferSize > 0 {
+		// A newer value supersedes a held back one
+		m.drop(topic)
+	}
+
+	m.published.Add(1)
+	m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+
+	token := m.client.Publish(topic, qos, retained, payload)
+	if !token.WaitTimeout(tokenTimeout) {
+		m.failed.Add(1)
+		return fmt.Errorf("publish %s: timed out", topic)
+	}
+	if err := token.Error(); err != nil {
+		m.failed.Add(1)
+		return err
+	}
+	m.acked.Add(1)
+	return nil
+}
+
+// hold buffers the latest payload of a retained topic while disconnected. A
+// new topic is rejected once the buffer is full.
+func (m *MQTTClient) hold(topic string, qos byte, payload any) error {
+	m.bufferMu.Lock()
+	defer m.bufferMu.Unlock()
+	if _, ok := m.buffer[topic]; !ok {
+		if len(m.bufferOrder) >= m.bufferSize {
+			if !m.bufferFull {
+				slog.Warn("MQTT offline buffer full, dropping publishes", "size", m.bufferSize)
+				m.bufferFull = true
+			}
+			m.failed.Add(1)
+			return fmt.Errorf("not connected and offline buffer full")
+		}
+		if m.buffer == nil {
+			m.buffer = make(map[string]bufferedPublish)
+		}
+		m.bufferOrder = append(m.bufferOrder, topic)
+	}
+	m.buffer[topic] = bufferedPublish{qos: qos, payload: payload}
+	return nil
+}
+
+// drop removes a held back topic.
+func (m *MQTTClient) drop(topic string) {
+	m.bufferMu.Lock()
+	defer m.bufferMu.Unlock()
+	if _, ok := m.buffer[topic]; ok {
+		delete(m.buffer, topic)
+		m.bufferOrder = slices.DeleteFunc(m.bufferOrder, func(t string) bool { return t == topic })
+	}
+}
+
+// flushBuffer publishes the held back topics in order after a connect. It
+// stops if the connection is lost again; the rest stays buffered.
+func (m *MQTTClient) flushBuffer() {
+	m.bufferMu.Lock()
+	if n := len(m.bufferOrder); n > 0 {
+		slog.Info("Publishing buffered MQTT messages", "topics", n)
+	}
+	m.bufferFull = false
+	m.bufferMu.Unlock()
+
+	for m.client.IsConnectionOpen() {
+		m.bufferMu.Lock()
+		if len(m.bufferOrder) == 0 {
+			m.bufferMu.Unlock()
+			return
+		}
+		topic := m.bufferOrder[0]
+		p := m.buffer[topic]
+		m.bufferOrder = m.bufferOrder[1:]
+		delete(m.buffer, topic)
+		m.bufferMu.Unlock()
 
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		return nil, fmt.Errorf("MQTT connection failed: %w", token.Error())
+		if err := m.publish(topic, p.qos, true, p.payload); err != nil {
+			slog.Error("Failed to publish buffered message", "topic", topic, "error", err)
+		}
 	}
+}
 
-	return &MQTTClient{
-		client: client,
-		root:   root,
-	}, nil
+// Topic returns the fully-qualified topic of a topic relative to the root
+// ({root}/{gekkoname}). All topics the client publishes or subscribes to,
+// including the LWT, are built with it.
+func (m *MQTTClient) Topic(topic string) string {
+	return m.root + "/" + topic
 }
 
+// Publish publishes a state value below the root with the configured QoS and
+// retained flag.
 func (m *MQTTClient) Publish(topic string, value any) error {
-	fullTopic := fmt.Sprintf("%s/%s", m.root, topic)
-	token := m.client.Publish(fullTopic, 0, true, fmt.Sprintf("%v", value))
-	token.Wait()
-	return token.Error()
+	return m.publish(m.Topic(topic), m.qos, m.retain, fmt.Sprintf("%v", value))
 }
 
 func (m *MQTTClient) PublishJSON(topic string, data any) error {
-	fullTopic := fmt.Sprintf("%s/%s", m.root, topic)
+	fullTopic := m.Topic(topic)
 	jsonBytes, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal JSON: %w", err)
 	}
-	token := m.client.Publish(fullTopic, 0, true, jsonBytes)
-	token.Wait()
-	return token.Error()
+	return m.publish(fullTopic, m.qos, m.retain, jsonBytes)
+}
+
+// PublishTransient publishes a JSON document below the root with the
+// configured QoS but never retained, regardless of retain.
+func (m *MQTTClient) PublishTransient(topic string, data any) error {
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return m.publish(m.Topic(topic), m.qos, false, jsonBytes)
+}
+
+// PublishRaw publishes a payload to an absolute topic outside the root, e.g.
+// a Home Assistant discovery config. It is always retained.
+func (m *MQTTClient) PublishRaw(topic string, payload []byte) error {
+	return m.publish(topic, m.qos, true, payload)
 }
 
+// Subscribe subscribes to a topic below the root. The handler receives the
+// message topic relative to the root, like the subscribed one. The
+// subscription is recorded and, while the connection is down, only made by
+// onConnect once the broker is reachable.
 func (m *MQTTClient) Subscribe(topic string, handler func(topic string, payload []byte)) error {
-	fullTopic := fmt.Sprintf("%s/%s", m.root, topic)
-	token := m.client.Subscribe(fullTopic, 0, func(c mqtt.Client, msg mqtt.Message) {
-		handler(msg.Topic(), msg.Payload())
-	})
-	token.Wait()
+	fullTopic := m.Topic(topic)
+	callback := func(c mqtt.Client, msg mqtt.Message) {
+		handler(strings.TrimPrefix(msg.Topic(), m.root+"/"), msg.Payload())
+	}
+
+	m.subsMu.Lock()
+	if m.subs == nil {
+		m.subs = make(map[string]mqtt.MessageHandler)
+	}
+	m.subs[fullTopic] = callback
+	m.subsMu.Unlock()
+
+	if !m.client.IsConnectionOpen() {
+		slog.Debug("Not connected, subscribing on connect", "topic", fullTopic)
+		return nil
+	}
+	token := m.client.Subscribe(fullTopic, m.subQoS, callback)
+	if !token.WaitTimeout(tokenTimeout) {
+		return fmt.Errorf("subscribe %s: timed out", fullTopic)
+	}
+	return token.Error()
+}
+
+// Unsubscribe removes a subscription made with Subscribe, so it does not
+// outlive the bridge in a persistent session.
+func (m *MQTTClient) Unsubscribe(topic string) error {
+	fullTopic := m.Topic(topic)
+	m.subsMu.Lock()
+	delete(m.subs, fullTopic)
+	m.subsMu.Unlock()
+
+	// Without a connection there is nothing to tell the broker, and paho
+	// would only queue the request
+	if !m.client.IsConnectionOpen() {
+		return nil
+	}
+	token := m.client.Unsubscribe(fullTopic)
+	// Do not hang on shutdown if the broker is gone
+	if !token.WaitTimeout(time.Second) {
+		return fmt.Errorf("unsubscribe %s: timed out", fullTopic)
+	}
 	return token.Error()
 }
 
+// Stats returns the current connection state and publish counters. Publishes
+// are counted as acked once paho reports their flow complete (for QoS 0 that
+// is when the message was written to the network).
+func (m *MQTTClient) Stats() MQTTStats {
+	m.bufferMu.Lock()
+	buffered := len(m.bufferOrder)
+	m.bufferMu.Unlock()
+	return m.stats(m.client.IsConnected(), buffered)
+}
+
 func (m *MQTTClient) Disconnect() {
 	// Publish offline status before graceful disconnect
 	// (LWT only triggers on unexpected disconnect, not graceful ones)
-	onlineTopic := m.root + "/online"
-	token := m.client.Publish(onlineTopic, 1, true, "false")
-	token.Wait()
+	token := m.client.Publish(m.Topic(m.willTopic), 1, true, m.offlinePayload)
+	// Do not hang on shutdown if the broker never came up
+	token.WaitTimeout(time.Second)
 	m.client.Disconnect(1000)
 }
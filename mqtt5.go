@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// errConnectionLost is reported for a lost MQTT 5 connection without a more
+// specific reason
+var errConnectionLost = errors.New("connection to the MQTT broker lost")
+
+// MQTT5Client is the MQTT 5 counterpart of MQTTClient (protocol_version = 5),
+// built on paho.golang's autopaho. Values published below the root carry the
+// message expiry interval of message_expiry, so the broker drops retained
+// values that were not refreshed in time. It has no offline buffer.
+type MQTT5Client struct {
+	connState
+
+	cm   *autopaho.ConnectionManager
+	root string
+
+	// QoS and retained flag of state publishes
+	qos    byte
+	retain bool
+	// subQoS is the QoS of the subscriptions, i.e. of incoming commands
+	subQoS byte
+	// expiry is the message expiry interval in seconds (0: none)
+	expiry uint32
+
+	// Availability topic (relative to root) and its payloads, also used as
+	// the LWT
+	willTopic      string
+	onlinePayload  string
+	offlinePayload string
+
+	// up is set while autopaho has a connection. downErr is the reason of
+	// the last connection loss, reported by autopaho before the connection
+	// goes down.
+	up      atomic.Bool
+	downErr atomic.Pointer[error]
+
+	// subs remembers the subscriptions and their handlers, to restore them
+	// after a reconnect and to route incoming messages
+	subsMu sync.Mutex
+	subs   map[string]func(topic string, payload []byte)
+	// onConnectFn is called after subscriptions were restored (OnConnect),
+	// guarded by subsMu
+	onConnectFn func()
+}
+
+func NewMQTT5Client(cfg MQTTConfig, gekkoName string) (*MQTT5Client, error) {
+	m := &MQTT5Client{
+		root:           cfg.Root + "/" + gekkoName,
+		qos:            cfg.QoS,
+		subQoS:         cfg.SubscribeQoS,
+		retain:         cfg.Retain == nil || *cfg.Retain,
+		expiry:         uint32(math.Ceil(cfg.MessageExpiry)),
+		willTopic:      cfg.WillTopic,
+		onlinePayload:  cfg.WillOnline,
+		offlinePayload: cfg.WillOffline,
+		connState:      newConnState(cfg),
+	}
+
+	// autopaho tries the brokers in order on every connect attempt, and
+	// dials WebSockets (ws://, wss://) itself
+	var servers []*url.URL
+	socketPath := ""
+	for _, brokerURL := range cfg.brokerURLs() {
+		parsedURL, err := parseBrokerURL(brokerURL)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Adding MQTT broker", "url", brokerURL)
+		if parsedURL.Scheme == "unix" {
+			// Validated to be the only broker
+			socketPath = parsedURL.Path
+			slog.Info("Using Unix socket", "path", socketPath)
+		}
+		servers = append(servers, parsedURL)
+	}
+	// Certificates are read now, before the sandbox
+	tlsConfig, err := newBrokerTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = "mygekko-mqtt"
+	}
+	slog.Info("MQTT client ID", "client_id", clientID, "protocol_version", 5)
+
+	willTopic := m.Topic(m.willTopic)
+	slog.Info("Setting LWT", "topic", willTopic, "payload", m.offlinePayload)
+	acfg := autopaho.ClientConfig{
+		ServerUrls: servers,
+		TlsCfg:     tlsConfig,
+		KeepAlive:  60,
+		// A clean session like MQTTClient; subscriptions are restored by
+		// onConnect
+		CleanStartOnInitialConnection: true,
+		ReconnectBackoff:              autopaho.NewConstantBackoff(5 * time.Second),
+		ConnectUsername:               cfg.Username,
+		ConnectPassword:               []byte(cfg.Password),
+		WillMessage: &paho.WillMessage{
+			Topic:   willTopic,
+			Payload: []byte(m.offlinePayload),
+			QoS:     1,
+			Retain:  true,
+		},
+		OnConnectionUp:   m.onConnectionUp,
+		OnConnectionDown: m.onConnectionDown,
+		OnConnectError:   m.onConnectError,
+		ClientConfig: paho.ClientConfig{
+			ClientID:          clientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){m.route},
+			OnClientError: func(err error) {
+				m.downErr.Store(&err)
+			},
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				err := fmt.Errorf("disconnected by the broker (reason %d)", d.ReasonCode)
+				m.downErr.Store(&err)
+			},
+		},
+	}
+	if socketPath != "" {
+		acfg.AttemptConnection = func(ctx context.Context, _ autopaho.ClientConfig, _ *url.URL) (net.Conn, error) {
+			slog.Debug("Opening Unix socket connection", "path", socketPath)
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		}
+	}
+
+	m.cm, err = autopaho.NewConnection(context.Background(), acfg)
+	if err != nil {
+		return nil, fmt.Errorf("MQTT connection failed: %w", err)
+	}
+	timeout := time.Duration(cfg.ConnectTimeout * float64(time.Second))
+	if err := m.connect(cfg.StartWithoutBroker, timeout); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// connect waits for the initial connect like MQTTClient.connect: normally
+// until autopaho is connected, with startWithoutBroker at most timeout.
+func (m *MQTT5Client) connect(startWithoutBroker bool, timeout time.Duration) error {
+	ctx := context.Background()
+	if startWithoutBroker {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := m.cm.AwaitConnection(ctx)
+	if startWithoutBroker && errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("MQTT broker not reachable, starting without it", "timeout", timeout)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("MQTT connection failed: %w", err)
+	}
+	return nil
+}
+
+// onConnectionUp runs on every (re)connect. autopaho must not be blocked
+// here, so the online status and the subscriptions are sent by onConnect.
+func (m *MQTT5Client) onConnectionUp(cm *autopaho.ConnectionManager, connack *paho.Connack) {
+	m.up.Store(true)
+	m.downErr.Store(nil)
+	go m.onConnect()
+}
+
+// onConnectionDown runs when autopaho lost the connection, before it starts
+// reconnecting.
+func (m *MQTT5Client) onConnectionDown() bool {
+	m.up.Store(false)
+	err := errConnectionLost
+	if p := m.downErr.Load(); p != nil {
+		err = *p
+	}
+	m.lost(err)
+	m.reconnecting()
+	return true
+}
+
+// onConnectError runs for every failed connect attempt. After a lost
+// connection, each one is followed by another reconnect attempt.
+func (m *MQTT5Client) onConnectError(err error) {
+	slog.Warn("MQTT connect failed", "error", err)
+	if m.connects.Load() > 0 {
+		m.reconnecting()
+	}
+}
+
+// onConnect publishes the online status and restores the subscriptions
+// after a connect.
+func (m *MQTT5Client) onConnect() {
+	m.connected()
+
+	// A failure is logged and the connect carries on, like in MQTTClient
+	ctx, cancel := context.WithTimeout(context.Background(), tokenTimeout)
+	_, err := m.cm.Publish(ctx, &paho.Publish{
+		Topic:   m.Topic(m.willTopic),
+		Retain:  true,
+		Payload: []byte(m.onlinePayload),
+	})
+	cancel()
+	if err != nil {
+		m.failed.Add(1)
+		slog.Error("Failed to publish online status", "error", err)
+	}
+
+	m.resubscribe()
+	m.subsMu.Lock()
+	fn := m.onConnectFn
+	m.subsMu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// OnConnect registers fn to run after every following connect to the
+// broker, see MQTTClient.OnConnect.
+func (m *MQTT5Client) OnConnect(fn func()) {
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+	m.onConnectFn = fn
+}
+
+// resubscribe makes all recorded subscriptions after a connect. subsMu is
+// not held while waiting for the SUBACKs, as route needs it for the retained
+// messages the broker sends meanwhile.
+func (m *MQTT5Client) resubscribe() {
+	m.subsMu.Lock()
+	topics := slices.Collect(maps.Keys(m.subs))
+	m.subsMu.Unlock()
+	for _, topic := range topics {
+		if err := m.subscribe(topic, tokenTimeout); err != nil {
+			slog.Error("Failed to resubscribe", "topic", topic, "error", err)
+			continue
+		}
+		slog.Debug("Resubscribed", "topic", topic)
+	}
+}
+
+// subscribe sends a SUBSCRIBE for an absolute topic and waits for the SUBACK.
+func (m *MQTT5Client) subscribe(topic string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err := m.cm.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: m.subQoS}},
+	})
+	if err != nil {
+		return fmt.Errorf("subscribe %s: %w", topic, err)
+	}
+	return nil
+}
+
+// route passes an incoming message to the handlers of the matching
+// subscriptions.
+func (m *MQTT5Client) route(pr paho.PublishReceived) (bool, error) {
+	topic := pr.Packet.Topic
+	m.subsMu.Lock()
+	var handlers []func(topic string, payload []byte)
+	for filter, handler := range m.subs {
+		if topicMatches(filter, topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	m.subsMu.Unlock()
+
+	for _, handler := range handlers {
+		handler(strings.TrimPrefix(topic, m.root+"/"), pr.Packet.Payload)
+	}
+	return len(handlers) > 0, nil
+}
+
+// topicMatches reports whether a topic matches a subscription filter with
+// the + and # wildcards.
+func topicMatches(filter, topic string) bool {
+	filterParts := strings.Split(filter, "/")
+	topicParts := strings.Split(topic, "/")
+	for i, part := range filterParts {
+		if part == "#" {
+			return true
+		}
+		if i >= len(topicParts) || part != "+" && part != topicParts[i] {
+			return false
+		}
+	}
+	return len(filterParts) == len(topicParts)
+}
+
+// publish sends a payload to an absolute topic and waits for completion,
+// keeping the counters reported by Stats up to date. While the connection is
+// down the publish fails. With expire, the message carries the message
+// expiry interval.
+func (m *MQTT5Client) publish(topic string, qos byte, retained bool, payload []byte, expire bool) error {
+	m.published.Add(1)
+	if !m.up.Load() {
+		m.failed.Add(1)
+		return fmt.Errorf("publish %s: %w", topic, errNotConnected)
+	}
+	m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+
+	p := &paho.Publish{Topic: topic, QoS: qos, Retain: retained, Payload: payload}
+	if expire && m.expiry > 0 {
+		p.Properties = &paho.PublishProperties{MessageExpiry: &m.expiry}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tokenTimeout)
+	defer cancel()
+	if _, err := m.cm.Publish(ctx, p); err != nil {
+		m.failed.Add(1)
+		return fmt.Errorf("publish %s: %w", topic, err)
+	}
+	m.acked.Add(1)
+	return nil
+}
+
+// expires reports whether a topic below the root gets the message expiry
+// interval: every value except the bridge/ topics, which describe the
+// bridge rather than the controller and are not republished periodically.
+func expires(topic string) bool {
+	return !strings.HasPrefix(topic, "bridge/")
+}
+
+// Topic returns the fully-qualified topic of a topic relative to the root,
+// see MQTTClient.Topic.
+func (m *MQTT5Client) Topic(topic string) string {
+	return m.root + "/" + topic
+}
+
+// Publish publishes a state value below the root with the configured QoS,
+// retained flag and message expiry.
+func (m *MQTT5Client) Publish(topic string, value any) error {
+	return m.publish(m.Topic(topic), m.qos, m.retain, fmt.Appendf(nil, "%v", value), expires(topic))
+}
+
+func (m *MQTT5Client) PublishJSON(topic string, data any) error {
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return m.publish(m.Topic(topic), m.qos, m.retain, jsonBytes, expires(topic))
+}
+
+// PublishTransient publishes a JSON document below the root with the
+// configured QoS but never retained, regardless of retain.
+func (m *MQTT5Client) PublishTransient(topic string, data any) error {
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return m.publish(m.Topic(topic), m.qos, false, jsonBytes, expires(topic))
+}
+
+// PublishRaw publishes a payload to an absolute topic outside the root, e.g.
+// a Home Assistant discovery config. It is always retained and never
+// expires.
+func (m *MQTT5Client) PublishRaw(topic string, payload []byte) error {
+	return m.publish(topic, m.qos, true, payload, false)
+}
+
+// Subscribe subscribes to a topic below the root, see
+// MQTTClient.Subscribe.
+func (m *MQTT5Client) Subscribe(topic string, handler func(topic string, payload []byte)) error {
+	fullTopic := m.Topic(topic)
+	m.subsMu.Lock()
+	if m.subs == nil {
+		m.subs = make(map[string]func(topic string, payload []byte))
+	}
+	m.subs[fullTopic] = handler
+	m.subsMu.Unlock()
+
+	if !m.up.Load() {
+		slog.Debug("Not connected, subscribing on connect", "topic", fullTopic)
+		return nil
+	}
+	return m.subscribe(fullTopic, tokenTimeout)
+}
+
+// Unsubscribe removes a subscription made with Subscribe.
+func (m *MQTT5Client) Unsubscribe(topic string) error {
+	fullTopic := m.Topic(topic)
+	m.subsMu.Lock()
+	delete(m.subs, fullTopic)
+	m.subsMu.Unlock()
+
+	if !m.up.Load() {
+		return nil
+	}
+	// Do not hang on shutdown if the broker is gone
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := m.cm.Unsubscribe(ctx, &paho.Unsubscribe{Topics: []string{fullTopic}}); err != nil {
+		return fmt.Errorf("unsubscribe %s: %w", fullTopic, err)
+	}
+	return nil
+}
+
+// Stats returns the current connection state and publish counters. A
+// publish is counted as acked once paho.golang completed its flow.
+func (m *MQTT5Client) Stats() MQTTStats {
+	return m.stats(m.up.Load(), 0)
+}
+
+func (m *MQTT5Client) Disconnect() {
+	// Publish offline status before graceful disconnect, like MQTTClient;
+	// do not hang on shutdown if the broker never came up
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if m.up.Load() {
+		m.cm.Publish(ctx, &paho.Publish{
+			Topic:   m.Topic(m.willTopic),
+			QoS:     1,
+			Retain:  true,
+			Payload: []byte(m.offlinePayload),
+		})
+	}
+	m.cm.Disconnect(ctx)
+}
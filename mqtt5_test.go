@@ -0,0 +1,154 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMQTT5Client_Broker(t *testing.T) {
+	broker := newTestBroker(t, "127.0.0.1:0")
+	cfg := MQTTConfig{
+		URL: broker.URL(), Root: "test", QoS: 1, ProtocolVersion: 5, MessageExpiry: 600,
+		WillTopic: "online", WillOnline: "true", WillOffline: "false",
+	}
+	m, err := NewMQTT5Client(cfg, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer m.Disconnect()
+	eventually(t, "the online status", func() bool {
+		payload, _ := broker.retainedPayload("test/TestGekko/online")
+		return payload == "true"
+	})
+
+	// Values carry the message expiry, the bridge topics, the availability
+	// topic and raw publishes do not
+	if err := m.Publish("blinds/item0/get/position", 50); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msgs := broker.messages("test/TestGekko/blinds/item0/get/position")
+	if len(msgs) != 1 || msgs[0].payload != "50" || msgs[0].qos != 1 || !msgs[0].retain || msgs[0].expiry != 600 {
+		t.Errorf("expected a retained QoS 1 publish of 50 expiring in 600s, got %+v", msgs)
+	}
+	if err := m.PublishJSON("bridge/version", map[string]string{"version": "dev"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.PublishRaw("homeassistant/cover/x/config", []byte("{}")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, topic := range []string{"test/TestGekko/bridge/version", "homeassistant/cover/x/config", "test/TestGekko/online"} {
+		if msgs := broker.messages(topic); len(msgs) == 0 || msgs[0].expiry != 0 {
+			t.Errorf("expected %s without expiry, got %+v", topic, msgs)
+		}
+	}
+	if err := m.PublishTransient("blinds/item0/set/result", setResult{Value: "P50"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msgs := broker.messages("test/TestGekko/blinds/item0/set/result"); len(msgs) != 1 || msgs[0].retain {
+		t.Errorf("expected a non-retained set result, got %+v", msgs)
+	}
+	stats := m.Stats()
+	if !stats.Connected || stats.Published != 4 || stats.Acked != 4 || stats.Failed != 0 || stats.InFlight != 0 {
+		t.Errorf("expected four acked publishes while connected, got %+v", stats)
+	}
+
+	received := make(chan string, 4)
+	if err := m.Subscribe("blinds/+/set", func(topic string, payload []byte) {
+		received <- topic + "=" + string(payload)
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	broker.inject("test/TestGekko/blinds/item0/set", "P50")
+	select {
+	case got := <-received:
+		if got != "blinds/item0/set=P50" {
+			t.Errorf("expected blinds/item0/set=P50, got %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the set command")
+	}
+
+	// A dropped connection publishes the will; autopaho reconnects, the
+	// online status is restored and the subscription made again
+	broker.dropClients()
+	eventually(t, "the reconnect", func() bool { return m.Stats().Reconnects == 1 })
+	if msgs := broker.messages("test/TestGekko/online"); len(msgs) < 2 || msgs[1].payload != "false" {
+		t.Errorf("expected the will after the dropped connection, got %+v", msgs)
+	}
+	eventually(t, "the online status after the reconnect", func() bool {
+		payload, _ := broker.retainedPayload("test/TestGekko/online")
+		return payload == "true"
+	})
+	eventually(t, "the resubscription", func() bool {
+		return slices.Equal(broker.subscriptions(), []string{"test/TestGekko/blinds/+/set", "test/TestGekko/blinds/+/set"})
+	})
+	broker.inject("test/TestGekko/blinds/item1/set", "P20")
+	select {
+	case got := <-received:
+		if got != "blinds/item1/set=P20" {
+			t.Errorf("expected blinds/item1/set=P20, got %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the set command after the reconnect")
+	}
+
+	// Unsubscribed topics are no longer delivered
+	if err := m.Unsubscribe("blinds/+/set"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	broker.inject("test/TestGekko/blinds/item2/set", "P10")
+	select {
+	case got := <-received:
+		t.Errorf("expected no message after unsubscribing, got %s", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// A graceful disconnect publishes the offline status
+	m.Disconnect()
+	if payload, _ := broker.retainedPayload("test/TestGekko/online"); payload != "false" {
+		t.Errorf("expected the offline status after disconnecting, got %q", payload)
+	}
+}
+
+func TestMQTT5Client_StartWithoutBroker(t *testing.T) {
+	cfg := MQTTConfig{
+		URL: "tcp://127.0.0.1:1", Root: "test", ProtocolVersion: 5,
+		StartWithoutBroker: true, ConnectTimeout: 0.1, WillTopic: "online",
+	}
+	m, err := NewMQTT5Client(cfg, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer m.Disconnect()
+
+	// Publishes fail fast, subscriptions are recorded for the connect
+	if err := m.Publish("blinds/item0/get/position", 50); err == nil {
+		t.Error("expected a publish to fail while disconnected")
+	}
+	if err := m.Subscribe("blinds/+/set", func(string, []byte) {}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if stats := m.Stats(); stats.Connected || stats.Published != 1 || stats.Failed != 1 {
+		t.Errorf("expected one failed publish while disconnected, got %+v", stats)
+	}
+}
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b/set", "a/b/set", true},
+		{"a/+/set", "a/b/set", true},
+		{"a/+/set", "a/b/c/set", false},
+		{"a/#", "a/b/c", true},
+		{"a/b", "a/b/c", false},
+		{"a/b/c", "a/b", false},
+	}
+	for _, tc := range tests {
+		if got := topicMatches(tc.filter, tc.topic); got != tc.want {
+			t.Errorf("topicMatches(%q, %q) = %v, want %v", tc.filter, tc.topic, got, tc.want)
+		}
+	}
+}
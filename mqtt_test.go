@@ -0,0 +1,834 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeToken is a completed paho token with an optional error
+type fakeToken struct {
+	err error
+}
+
+func (t *fakeToken) Wait() bool                     { return true }
+func (t *fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t *fakeToken) Error() error                   { return t.err }
+
+func (t *fakeToken) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+// fakePaho implements mqtt.Client in memory, standing in for a broker
+type fakePaho struct {
+	mu           sync.Mutex
+	connected    bool
+	publishErr   error
+	published    []PublishedMessage
+	subscribed   []string
+	unsubscribed []string
+	subQoS       byte
+	// QoS and retained flag of the last publish
+	lastQoS      byte
+	lastRetained bool
+}
+
+func (f *fakePaho) IsConnected() bool      { return f.connected }
+func (f *fakePaho) IsConnectionOpen() bool { return f.connected }
+func (f *fakePaho) Connect() mqtt.Token    { f.connected = true; return &fakeToken{} }
+func (f *fakePaho) Disconnect(uint)        { f.connected = false }
+
+func (f *fakePaho) Publish(topic string, qos byte, retained bool, payload any) mqtt.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.publishErr != nil {
+		return &fakeToken{err: f.publishErr}
+	}
+	f.published = append(f.published, PublishedMessage{Topic: topic, Value: payload})
+	f.lastQoS, f.lastRetained = qos, retained
+	return &fakeToken{}
+}
+
+func (f *fakePaho) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribed = append(f.subscribed, topic)
+	f.subQoS = qos
+	return &fakeToken{}
+}
+
+func (f *fakePaho) SubscribeMultiple(map[string]byte, mqtt.MessageHandler) mqtt.Token {
+	return &fakeToken{}
+}
+
+func (f *fakePaho) Unsubscribe(topics ...string) mqtt.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.unsubscribed = append(f.unsubscribed, topics...)
+	return &fakeToken{}
+}
+
+func (f *fakePaho) AddRoute(string, mqtt.MessageHandler)    {}
+func (f *fakePaho) OptionsReader() mqtt.ClientOptionsReader { return mqtt.ClientOptionsReader{} }
+
+func newTestMQTTClient(paho *fakePaho) *MQTTClient {
+	return &MQTTClient{
+		client:         paho,
+		root:           "test/TestGekko",
+		retain:         true,
+		willTopic:      "online",
+		onlinePayload:  "true",
+		offlinePayload: "false",
+		connState:      connState{onOffline: logOffline, onGiveUp: exitGiveUp},
+	}
+}
+
+func TestMQTTStats_Counters(t *testing.T) {
+	paho := &fakePaho{}
+	m := newTestMQTTClient(paho)
+
+	// Initial connect and one reconnect
+	m.onConnect(paho)
+	paho.connected = true
+	m.onConnect(paho)
+
+	if err := m.Publish("blinds/item0/get/position", 50); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.PublishJSON("blinds/item0/get/json", map[string]any{"position": 50}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	paho.publishErr = errors.New("not connected")
+	if err := m.Publish("blinds/item0/get/angle", 45.5); err == nil {
+		t.Error("expected publish error")
+	}
+
+	stats := m.Stats()
+	if !stats.Connected {
+		t.Error("expected Connected to be true")
+	}
+	if stats.Published != 3 {
+		t.Errorf("expected 3 published, got %d", stats.Published)
+	}
+	if stats.Acked != 2 {
+		t.Errorf("expected 2 acked, got %d", stats.Acked)
+	}
+	if stats.Failed != 1 {
+		t.Errorf("expected 1 failed, got %d", stats.Failed)
+	}
+	if stats.InFlight != 0 {
+		t.Errorf("expected 0 in flight, got %d", stats.InFlight)
+	}
+	if stats.Reconnects != 1 {
+		t.Errorf("expected 1 reconnect, got %d", stats.Reconnects)
+	}
+	if stats.LastConnect == 0 {
+		t.Error("expected LastConnect to be set")
+	}
+}
+
+func TestPublishStats(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	m := newTestMQTTClient(paho)
+
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), m, map[string][]FieldDef{}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bridge.publishStats()
+
+	if len(paho.published) != 1 {
+		t.Fatalf("expected 1 published message, got %d", len(paho.published))
+	}
+	if paho.published[0].Topic != "test/TestGekko/bridge/mqtt" {
+		t.Errorf("unexpected stats topic: %s", paho.published[0].Topic)
+	}
+}
+
+func TestCleanGekkoName(t *testing.T) {
+	cases := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"MyHome", "MyHome", false},
+		{"  MyHome  ", "MyHome", false},
+		{"MyHome/", "MyHome", false},
+		{" /MyHome/ ", "MyHome", false},
+		{"My Home", "My_Home", false},
+		{"Haus  Müller", "Haus_Müller", false},
+		{"My + Home", "My_Home", false},
+		{"Haus/Oben", "Haus_Oben", false},
+		{"MyHome#", "MyHome", false},
+		{"   ", "", true},
+		{"", "", true},
+		{" / ", "", true},
+		{"+#", "", true},
+	}
+
+	for _, tc := range cases {
+		got, err := cleanGekkoName(tc.raw)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("cleanGekkoName(%q): expected error, got %q", tc.raw, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("cleanGekkoName(%q): unexpected error: %v", tc.raw, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("cleanGekkoName(%q): expected %q, got %q", tc.raw, tc.want, got)
+		}
+	}
+}
+
+func TestConnectionLostGrace(t *testing.T) {
+	paho := &fakePaho{}
+	m := newTestMQTTClient(paho)
+	m.lostGrace = 50 * time.Millisecond
+	offline := make(chan error, 1)
+	m.onOffline = func(err error) { offline <- err }
+
+	// A quick reconnect suppresses the offline reaction
+	m.onConnectionLost(paho, errors.New("connection reset"))
+	m.onConnect(paho)
+	select {
+	case err := <-offline:
+		t.Fatalf("expected reconnect to cancel offline reaction, got %v", err)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	// Without a reconnect the grace period expires
+	m.onConnectionLost(paho, errors.New("connection reset"))
+	select {
+	case <-offline:
+	case <-time.After(time.Second):
+		t.Fatal("expected offline reaction after grace period")
+	}
+
+	// An expected disconnection is never acted on
+	m.onConnectionLost(paho, nil)
+	select {
+	case err := <-offline:
+		t.Fatalf("unexpected offline reaction: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNewMQTTClient_StartWithoutBroker(t *testing.T) {
+	// Reserve a port, then close it so nothing is listening there
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	cfg := MQTTConfig{
+		URL:                "tcp://" + addr,
+		Root:               "test",
+		StartWithoutBroker: true,
+		ConnectTimeout:     0.2,
+	}
+	start := time.Now()
+	m, err := NewMQTTClient(cfg, "TestGekko")
+	if err != nil {
+		t.Fatalf("expected client despite unreachable broker, got %v", err)
+	}
+	defer m.client.Disconnect(0)
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected connect to give up after the timeout, took %s", elapsed)
+	}
+	if m.Stats().LastConnect != 0 {
+		t.Error("expected no connect to have happened")
+	}
+}
+
+func TestNewMQTTClient_StartWithoutBroker_PublishAndSubscribe(t *testing.T) {
+	// Reserve a port for the broker that only starts later
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	cfg := MQTTConfig{URL: "tcp://" + addr, Root: "test", StartWithoutBroker: true, ConnectTimeout: 0.2,
+		WillTopic: "online", WillOnline: "true", WillOffline: "false"}
+	m, err := NewMQTTClient(cfg, "TestGekko")
+	if err != nil {
+		t.Fatalf("expected client despite unreachable broker, got %v", err)
+	}
+	defer m.Disconnect()
+	connected := make(chan struct{}, 1)
+	m.OnConnect(func() { connected <- struct{}{} })
+
+	// Neither may block until the broker shows up
+	received := make(chan string, 1)
+	done := make(chan error, 2)
+	go func() { done <- m.Publish("bridge/name", "TestGekko") }()
+	go func() {
+		done <- m.Subscribe("blinds/+/set", func(topic string, payload []byte) { received <- string(payload) })
+	}()
+	var errs []error
+	for range 2 {
+		select {
+		case err := <-done:
+			errs = append(errs, err)
+		case <-time.After(3 * time.Second):
+			t.Fatal("publish or subscribe blocked while disconnected")
+		}
+	}
+	if !slices.ContainsFunc(errs, func(err error) bool { return errors.Is(err, errNotConnected) }) || !slices.Contains(errs, nil) {
+		t.Errorf("expected the publish to fail and the subscribe to succeed, got %v", errs)
+	}
+	if stats := m.Stats(); stats.Published != 1 || stats.Failed != 1 {
+		t.Errorf("expected one failed publish, got %+v", stats)
+	}
+
+	// Once the broker is up, the subscription is made and the callback runs
+	broker := newTestBroker(t, addr)
+	select {
+	case <-connected:
+	case <-time.After(15 * time.Second):
+		t.Fatal("timed out waiting for the connect")
+	}
+	eventually(t, "the subscription", func() bool {
+		return slices.Contains(broker.subscriptions(), "test/TestGekko/blinds/+/set")
+	})
+	broker.inject("test/TestGekko/blinds/item0/set", "P50")
+	select {
+	case got := <-received:
+		if got != "P50" {
+			t.Errorf("expected P50, got %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the set command")
+	}
+	if err := m.Publish("bridge/name", "TestGekko"); err != nil {
+		t.Errorf("unexpected error once connected: %v", err)
+	}
+}
+
+func TestNewMQTTClient_FallbackBrokers(t *testing.T) {
+	cfg := MQTTConfig{
+		URL:                "tcp://127.0.0.1:1",
+		URLs:               []string{"tcp://127.0.0.1:2", "ws://127.0.0.1:3/mqtt"},
+		Root:               "test",
+		StartWithoutBroker: true,
+		ConnectTimeout:     0.2,
+	}
+	m, err := NewMQTTClient(cfg, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer m.client.Disconnect(0)
+
+	opts := m.client.OptionsReader()
+	var got []string
+	for _, server := range opts.Servers() {
+		got = append(got, server.String())
+	}
+	if want := []string{"tcp://127.0.0.1:1", "tcp://127.0.0.1:2", "ws://127.0.0.1:3/mqtt"}; !slices.Equal(got, want) {
+		t.Errorf("expected brokers %v, got %v", want, got)
+	}
+}
+
+func TestTopics_ShareRoot(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	m := newTestMQTTClient(paho)
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), m,
+		map[string][]FieldDef{"lights": {{Name: "state", Type: "int"}}}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m.onConnect(paho)
+	bridge.processItem("lights", "item0", map[string]any{"value": "1"})
+
+	want := map[string]bool{
+		m.Topic("online"):                       false,
+		m.Topic("lights/item0/get/state"):       false,
+		m.Topic("lights/item0/get/json"):        false,
+		"test/TestGekko/online":                 false,
+		"test/TestGekko/lights/item0/get/state": false,
+	}
+	for _, msg := range paho.published {
+		if _, ok := want[msg.Topic]; ok {
+			want[msg.Topic] = true
+		}
+	}
+	for topic, seen := range want {
+		if !seen {
+			t.Errorf("expected a publish to %s, got %+v", topic, paho.published)
+		}
+	}
+}
+
+func TestAvailability_CustomWill(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	m := newTestMQTTClient(paho)
+	m.willTopic = "status"
+	m.onlinePayload = "online"
+	m.offlinePayload = "offline"
+
+	m.onConnect(paho)
+	m.Disconnect()
+
+	want := []PublishedMessage{
+		{Topic: "test/TestGekko/status", Value: "online"},
+		{Topic: "test/TestGekko/status", Value: "offline"},
+	}
+	if !slices.Equal(paho.published, want) {
+		t.Errorf("expected %+v, got %+v", want, paho.published)
+	}
+}
+
+func TestReconnect_Resubscribes(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	m := newTestMQTTClient(paho)
+
+	m.onConnect(paho)
+	if err := m.Subscribe("lights/+/set", func(string, []byte) {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m.onConnectionLost(paho, errors.New("connection reset"))
+	m.onReconnecting(paho, nil)
+	m.onConnect(paho)
+
+	want := []string{"test/TestGekko/lights/+/set", "test/TestGekko/lights/+/set"}
+	if !slices.Equal(paho.subscribed, want) {
+		t.Errorf("expected subscription to be restored, got %v", paho.subscribed)
+	}
+	if paho.subQoS != 0 {
+		t.Errorf("expected subscribe QoS 0 by default, got %d", paho.subQoS)
+	}
+	if got := m.reconnectAttempts.Load(); got != 0 {
+		t.Errorf("expected reconnect attempts to reset on connect, got %d", got)
+	}
+}
+
+func TestReconnect_OnlinePublishFails(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	m := newTestMQTTClient(paho)
+	if err := m.Subscribe("lights/+/set", func(string, []byte) {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	called := false
+	m.OnConnect(func() { called = true })
+
+	// The failed online status is counted; the connect carries on
+	paho.publishErr = errors.New("connection reset")
+	m.onConnect(paho)
+
+	if got := m.Stats().Failed; got != 1 {
+		t.Errorf("expected 1 failed publish, got %d", got)
+	}
+	if want := []string{"test/TestGekko/lights/+/set", "test/TestGekko/lights/+/set"}; !slices.Equal(paho.subscribed, want) {
+		t.Errorf("expected the subscription restored, got %v", paho.subscribed)
+	}
+	if !called {
+		t.Error("expected the connect callback to run")
+	}
+}
+
+func TestReconnect_GivesUpAfterMaxAttempts(t *testing.T) {
+	paho := &fakePaho{}
+	m := newTestMQTTClient(paho)
+	m.maxReconnects = 2
+	var gaveUp int64
+	m.onGiveUp = func(attempts int64) { gaveUp = attempts }
+
+	m.onReconnecting(paho, nil)
+	m.onReconnecting(paho, nil)
+	if gaveUp != 0 {
+		t.Fatalf("expected to keep reconnecting within the limit, gave up after %d", gaveUp)
+	}
+	m.onReconnecting(paho, nil)
+	if gaveUp != 2 {
+		t.Errorf("expected to give up after 2 attempts, got %d", gaveUp)
+	}
+}
+
+func TestPublish_OfflineBuffer(t *testing.T) {
+	paho := &fakePaho{}
+	m := newTestMQTTClient(paho)
+	m.bufferSize = 2
+
+	// Disconnected: the latest retained value per topic is held back
+	for _, err := range []error{
+		m.Publish("blinds/item0/get/position", 10),
+		m.Publish("blinds/item1/get/position", 20),
+		m.Publish("blinds/item0/get/position", 30),
+	} {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := m.Publish("blinds/item2/get/position", 40); err == nil {
+		t.Error("expected error for a new topic with the buffer full")
+	}
+	if len(paho.published) != 0 {
+		t.Fatalf("expected nothing published while disconnected, got %v", paho.published)
+	}
+	if got := m.Stats().Buffered; got != 2 {
+		t.Errorf("expected 2 buffered topics, got %d", got)
+	}
+
+	// Transient publishes are not buffered
+	m.retain = false
+	m.Publish("bridge/event", "x")
+	m.retain = true
+	paho.published = nil
+
+	paho.connected = true
+	m.onConnect(paho)
+	want := []PublishedMessage{
+		{Topic: "test/TestGekko/online", Value: "true"},
+		{Topic: "test/TestGekko/blinds/item0/get/position", Value: "30"},
+		{Topic: "test/TestGekko/blinds/item1/get/position", Value: "20"},
+	}
+	if !slices.Equal(paho.published, want) {
+		t.Errorf("expected buffered values flushed on connect, got %v", paho.published)
+	}
+	if got := m.Stats().Buffered; got != 0 {
+		t.Errorf("expected empty buffer after flush, got %d", got)
+	}
+}
+
+func TestPublish_QoSAndRetain(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	m := newTestMQTTClient(paho)
+
+	m.Publish("lights/item0/get/state", 1)
+	if paho.lastQoS != 0 || !paho.lastRetained {
+		t.Errorf("expected default QoS 0 retained, got QoS %d retained %v", paho.lastQoS, paho.lastRetained)
+	}
+
+	m.qos, m.retain = 1, false
+	m.PublishJSON("lights/item0/get/json", map[string]any{"state": 1})
+	if paho.lastQoS != 1 || paho.lastRetained {
+		t.Errorf("expected QoS 1 not retained, got QoS %d retained %v", paho.lastQoS, paho.lastRetained)
+	}
+
+	// Discovery configs must survive subscriber restarts regardless
+	m.PublishRaw("homeassistant/sensor/x/config", []byte("{}"))
+	if !paho.lastRetained {
+		t.Error("expected raw publish to be retained")
+	}
+
+	// Command results are never retained, even with retain set
+	m.retain = true
+	m.PublishTransient("lights/item0/set/result", map[string]any{"value": "1"})
+	if paho.lastQoS != 1 || paho.lastRetained {
+		t.Errorf("expected transient publish with QoS 1 not retained, got QoS %d retained %v", paho.lastQoS, paho.lastRetained)
+	}
+}
+
+func TestBridge_PublishesLoopState(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	m := newTestMQTTClient(paho)
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{Interval: 3600, IntervalRounds: 4},
+		MQTT:    MQTTConfig{WillTopic: "status", WillOnline: "online", WillOffline: "offline"},
+	}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), m, map[string][]FieldDef{}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bridge.publishRunning("getter", true)
+	bridge.Stop()
+
+	var got []string
+	for _, msg := range paho.published {
+		got = append(got, msg.Topic+"="+string(msg.Value.([]byte)))
+	}
+	want := []string{
+		"test/TestGekko/getter/status=online",
+		"test/TestGekko/getter/status=offline",
+		"test/TestGekko/setter/status=offline",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if !paho.lastRetained {
+		t.Error("expected loop state to be retained")
+	}
+}
+
+func TestBridgeStop_WaitsForGoroutines(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	m := newTestMQTTClient(paho)
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{ReadOnly: true, ShutdownTimeout: 1},
+		MQTT:    MQTTConfig{WillTopic: "status", WillOnline: "online", WillOffline: "offline"},
+	}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), m, map[string][]FieldDef{}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// An in-flight poll publishing after the cancel must come before the
+	// offline state
+	bridge.Go(func() {
+		<-bridge.ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		m.Publish("blinds/get/time", 1)
+	})
+	bridge.Stop()
+
+	var got []string
+	for _, msg := range paho.published {
+		got = append(got, msg.Topic)
+	}
+	if want := []string{"test/TestGekko/blinds/get/time", "test/TestGekko/getter/status"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// A goroutine that does not stop only delays Stop by the timeout
+	cfg.MyGekko.ShutdownTimeout = 0.05
+	bridge, err = NewBridge(cfg, NewMockGekko("TestGekko"), m, map[string][]FieldDef{}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	block := make(chan struct{})
+	defer close(block)
+	bridge.Go(func() { <-block })
+	start := time.Now()
+	bridge.Stop()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Stop to give up after the timeout, took %s", elapsed)
+	}
+}
+
+func TestNewBrokerTLSConfig(t *testing.T) {
+	if tlsConfig, err := newBrokerTLSConfig(MQTTConfig{}); err != nil || tlsConfig != nil {
+		t.Errorf("expected default TLS without options, got %v, %v", tlsConfig, err)
+	}
+
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	cert := srv.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"ca.pem":   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}),
+		"cert.pem": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}),
+		"key.pem":  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	tlsConfig, err := newBrokerTLSConfig(MQTTConfig{
+		TLSCAFile:   filepath.Join(dir, "ca.pem"),
+		TLSCertFile: filepath.Join(dir, "cert.pem"),
+		TLSKeyFile:  filepath.Join(dir, "key.pem"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tlsConfig.RootCAs == nil || len(tlsConfig.Certificates) != 1 {
+		t.Errorf("expected CA pool and client certificate, got %+v", tlsConfig)
+	}
+
+	if _, err := newBrokerTLSConfig(MQTTConfig{TLSCAFile: filepath.Join(dir, "key.pem")}); err == nil {
+		t.Error("expected error for CA file without certificates")
+	}
+}
+
+func TestParseBrokerURL_Transports(t *testing.T) {
+	cases := []struct {
+		url, scheme, host, path string
+		tls                     bool
+	}{
+		{"tcp://broker:1883", "tcp", "broker:1883", "", false},
+		{"mqtt://broker:1883", "mqtt", "broker:1883", "", false},
+		{"ssl://broker:8883", "ssl", "broker:8883", "", true},
+		{"mqtts://broker:8883", "mqtts", "broker:8883", "", true},
+		{"ws://broker:8080/mqtt", "ws", "broker:8080", "/mqtt", false},
+		{"wss://broker.example.com/mqtt", "wss", "broker.example.com", "/mqtt", true},
+		{"unix:///run/mosquitto/mosquitto.sock", "unix", "", "/run/mosquitto/mosquitto.sock", false},
+	}
+	for _, tc := range cases {
+		u, err := parseBrokerURL(tc.url)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.url, err)
+			continue
+		}
+		if u.Scheme != tc.scheme || u.Host != tc.host || u.Path != tc.path {
+			t.Errorf("%s: expected %s %q %q, got %s %q %q", tc.url, tc.scheme, tc.host, tc.path, u.Scheme, u.Host, u.Path)
+		}
+		if tlsSchemes[u.Scheme] != tc.tls {
+			t.Errorf("%s: expected TLS %v", tc.url, tc.tls)
+		}
+	}
+
+	if _, err := parseBrokerURL("ws:///mqtt"); err == nil {
+		t.Error("expected error for a WebSocket URL without host")
+	}
+}
+
+// fakeMessage is an incoming message for subscription callbacks
+type fakeMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (f fakeMessage) Duplicate() bool   { return false }
+func (f fakeMessage) Qos() byte         { return 0 }
+func (f fakeMessage) Retained() bool    { return false }
+func (f fakeMessage) Topic() string     { return f.topic }
+func (f fakeMessage) MessageID() uint16 { return 0 }
+func (f fakeMessage) Payload() []byte   { return f.payload }
+func (f fakeMessage) Ack()              {}
+
+func TestSubscribe_RelativeTopic(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	m := newTestMQTTClient(paho)
+
+	var got string
+	if err := m.Subscribe("lights/+/set", func(topic string, _ []byte) { got = topic }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m.subs["test/TestGekko/lights/+/set"](paho, fakeMessage{topic: "test/TestGekko/lights/item0/set"})
+
+	if got != "lights/item0/set" {
+		t.Errorf("expected the topic relative to the root, got %q", got)
+	}
+}
+
+func TestSubscribe_QoS(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	m := newTestMQTTClient(paho)
+	m.subQoS = 1
+
+	if err := m.Subscribe("lights/+/set", func(string, []byte) {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if paho.subQoS != 1 {
+		t.Errorf("expected subscribe QoS 1, got %d", paho.subQoS)
+	}
+	paho.subQoS = 0
+	m.resubscribe(paho)
+	if paho.subQoS != 1 {
+		t.Errorf("expected subscribe QoS 1 after a reconnect, got %d", paho.subQoS)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	paho := &fakePaho{connected: true}
+	m := newTestMQTTClient(paho)
+
+	if err := m.Subscribe("lights/+/set", func(string, []byte) {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.Unsubscribe("lights/+/set"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"test/TestGekko/lights/+/set"}; !slices.Equal(paho.unsubscribed, want) {
+		t.Errorf("expected %v, got %v", want, paho.unsubscribed)
+	}
+
+	// Not restored after a reconnect
+	paho.subscribed = nil
+	m.onConnect(paho)
+	if len(paho.subscribed) != 0 {
+		t.Errorf("expected no subscription restored, got %v", paho.subscribed)
+	}
+}
+
+func TestMQTTClient_Broker(t *testing.T) {
+	broker := newTestBroker(t, "127.0.0.1:0")
+	cfg := MQTTConfig{URL: broker.URL(), Root: "test", QoS: 1, WillTopic: "online", WillOnline: "true", WillOffline: "false"}
+	m, err := NewMQTTClient(cfg, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer m.Disconnect()
+	eventually(t, "the online status", func() bool {
+		payload, _ := broker.retainedPayload("test/TestGekko/online")
+		return payload == "true"
+	})
+
+	// A QoS 1 publish counts as acked once the broker sent PUBACK
+	if err := m.Publish("blinds/item0/get/position", 50); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msgs := broker.messages("test/TestGekko/blinds/item0/get/position")
+	if len(msgs) != 1 || msgs[0].payload != "50" || msgs[0].qos != 1 || !msgs[0].retain {
+		t.Errorf("expected a retained QoS 1 publish of 50, got %+v", msgs)
+	}
+	stats := m.Stats()
+	if !stats.Connected || stats.Published != 1 || stats.Acked != 1 || stats.Failed != 0 || stats.InFlight != 0 {
+		t.Errorf("expected one acked publish while connected, got %+v", stats)
+	}
+	if stats.Reconnects != 0 || stats.LastConnect == 0 {
+		t.Errorf("expected a first connect only, got %+v", stats)
+	}
+
+	received := make(chan string, 4)
+	if err := m.Subscribe("blinds/+/set", func(topic string, payload []byte) {
+		received <- topic + "=" + string(payload)
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	broker.inject("test/TestGekko/blinds/item0/set", "P50")
+	select {
+	case got := <-received:
+		if got != "blinds/item0/set=P50" {
+			t.Errorf("expected blinds/item0/set=P50, got %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the set command")
+	}
+
+	// A dropped connection publishes the will; paho reconnects, the online
+	// status is restored and the subscription made again
+	broker.dropClients()
+	eventually(t, "the reconnect", func() bool { return m.Stats().Reconnects == 1 })
+	if msgs := broker.messages("test/TestGekko/online"); len(msgs) < 2 || msgs[1].payload != "false" {
+		t.Errorf("expected the will after the dropped connection, got %+v", msgs)
+	}
+	eventually(t, "the online status after the reconnect", func() bool {
+		payload, _ := broker.retainedPayload("test/TestGekko/online")
+		return payload == "true"
+	})
+	eventually(t, "the resubscription", func() bool {
+		return slices.Equal(broker.subscriptions(), []string{"test/TestGekko/blinds/+/set", "test/TestGekko/blinds/+/set"})
+	})
+	broker.inject("test/TestGekko/blinds/item1/set", "P20")
+	select {
+	case got := <-received:
+		if got != "blinds/item1/set=P20" {
+			t.Errorf("expected blinds/item1/set=P20, got %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the set command after the reconnect")
+	}
+}
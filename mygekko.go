@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,7 +11,10 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,40 +23,232 @@ type MyGekkoClient struct {
 	username   string
 	password   string
 	httpClient *http.Client
+
+	// apiKey and gekkoID authenticate against the MyGEKKO Plus cloud API
+	// instead of the password
+	apiKey  string
+	gekkoID string
+	// minInterval spaces the requests to the cloud API, which limits the
+	// request rate; nextRequest is the earliest time of the next one
+	minInterval time.Duration
+	limitMu     sync.Mutex
+	nextRequest time.Time
+	// maxBackoff caps how long a 429 response holds back further requests
+	maxBackoff time.Duration
 }
 
 func NewMyGekkoClient(cfg MyGekkoConfig) (*MyGekkoClient, error) {
-	// Resolve hostname to IP at startup (needed for chroot/sandbox)
+	return NewMyGekkoClientWithHTTPClient(cfg, nil)
+}
+
+// NewMyGekkoClientWithHTTPClient is like NewMyGekkoClient, but sends the
+// requests with httpClient, e.g. one with a proxy transport or a test server's
+// client. The timeout and TLS options of cfg are then up to httpClient. A nil
+// httpClient creates the default one.
+func NewMyGekkoClientWithHTTPClient(cfg MyGekkoConfig, httpClient *http.Client) (*MyGekkoClient, error) {
+	if cfg.Mode == "cloud" {
+		return newCloudClient(cfg, httpClient)
+	}
+
+	// Resolve hostname to IP at startup (needed for chroot/sandbox). Behind
+	// proxy_url, the proxy resolves it.
 	host := cfg.Host
-	if ips, err := net.LookupHost(host); err == nil && len(ips) > 0 {
+	if cfg.ProxyURL != "" {
+		slog.Debug("Not resolving hostname behind proxy", "host", host)
+	} else if ips, err := net.LookupHost(host); err == nil && len(ips) > 0 {
 		slog.Info("Resolved hostname", "host", host, "ip", ips[0])
 		host = ips[0]
 	} else if err != nil {
 		return nil, fmt.Errorf("DNS lookup failed for %s: %w", host, err)
 	}
 
+	scheme := "http"
+	if cfg.UseTLS {
+		scheme = "https"
+	}
 	baseURL := &url.URL{
-		Scheme: "http",
+		Scheme: scheme,
 		Host:   host,
 		Path:   "/api/v1/",
 	}
 
+	if httpClient == nil {
+		// The certificate is issued for the configured name, not the resolved IP
+		var err error
+		httpClient, err = newHTTPClient(cfg, cfg.Host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &MyGekkoClient{
-		baseURL:  baseURL,
-		username: cfg.Username,
-		password: cfg.Password,
-		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
-		},
+		baseURL:    baseURL,
+		username:   cfg.Username,
+		password:   cfg.Password,
+		httpClient: httpClient,
+		maxBackoff: time.Duration(cfg.MaxBackoff * float64(time.Second)),
 	}, nil
 }
 
+// newCloudClient creates a client for the MyGEKKO Plus query API, which
+// serves the same endpoints as the local API for the controller gekko_id.
+func newCloudClient(cfg MyGekkoConfig, httpClient *http.Client) (*MyGekkoClient, error) {
+	baseURL, err := url.Parse(cfg.CloudURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cloud URL: %w", err)
+	}
+	slog.Info("Using MyGEKKO cloud API", "url", baseURL.Redacted(), "gekko_id", cfg.GekkoID)
+	if httpClient == nil {
+		httpClient, err = newHTTPClient(cfg, baseURL.Hostname())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &MyGekkoClient{
+		baseURL:     baseURL,
+		username:    cfg.Username,
+		apiKey:      cfg.APIKey,
+		gekkoID:     cfg.GekkoID,
+		httpClient:  httpClient,
+		minInterval: time.Duration(cfg.CloudRequestInterval * float64(time.Second)),
+		maxBackoff:  time.Duration(cfg.MaxBackoff * float64(time.Second)),
+	}, nil
+}
+
+// wait delays a request until minInterval passed since the previous one and
+// a Retry-After of a rate-limited response elapsed.
+func (c *MyGekkoClient) wait(ctx context.Context) error {
+	c.limitMu.Lock()
+	now := time.Now()
+	at := now
+	if c.nextRequest.After(now) {
+		at = c.nextRequest
+	}
+	if c.minInterval > 0 {
+		c.nextRequest = at.Add(c.minInterval)
+	}
+	c.limitMu.Unlock()
+
+	if at.Equal(now) {
+		return nil
+	}
+	select {
+	case <-time.After(at.Sub(now)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newHTTPClient creates the HTTP client for the MyGEKKO API. Requests go
+// through proxy_url if set, else through the proxy of the environment
+// (HTTP_PROXY, HTTPS_PROXY, NO_PROXY). With TLS, the server certificate is
+// verified against serverName and, if configured, the CA certificates in
+// tls_ca_file instead of the system roots.
+func newHTTPClient(cfg MyGekkoConfig, serverName string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+		slog.Info("Using proxy for MyGEKKO API", "proxy", proxy.Redacted())
+	}
+	client := &http.Client{
+		Timeout:   time.Duration(cfg.HTTPTimeout * float64(time.Second)),
+		Transport: transport,
+	}
+	if !cfg.UseTLS {
+		return client, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TLS CA file %s contains no certificates", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+	return client, nil
+}
+
+// httpStatusError is returned for a response other than 200 OK. retryAfter
+// is the delay requested by a 429 response, capped by max_backoff.
+type httpStatusError struct {
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP status %d", e.code)
+}
+
+// permanent reports whether repeating the request cannot help, e.g. on
+// wrong credentials (401) or an unknown category (404).
+func (e *httpStatusError) permanent() bool {
+	return e.code >= 400 && e.code < 500 && e.code != http.StatusRequestTimeout && e.code != http.StatusTooManyRequests
+}
+
+// statusError creates the error for a response other than 200 OK. A 429
+// response holds back all further requests for its Retry-After delay.
+func (c *MyGekkoClient) statusError(resp *http.Response) *httpStatusError {
+	err := &httpStatusError{code: resp.StatusCode}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return err
+	}
+
+	err.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if c.maxBackoff > 0 {
+		err.retryAfter = min(err.retryAfter, c.maxBackoff)
+	}
+	slog.Warn("MyGEKKO API rate limit hit", "retry_after", err.retryAfter)
+
+	c.limitMu.Lock()
+	if until := time.Now().Add(err.retryAfter); until.After(c.nextRequest) {
+		c.nextRequest = until
+	}
+	c.limitMu.Unlock()
+	return err
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP
+// date. A missing or invalid header yields 0.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
 func (c *MyGekkoClient) buildURL(endpoint string, extraParams url.Values) string {
 	u := c.baseURL.JoinPath(endpoint)
 
 	params := url.Values{}
 	params.Set("username", c.username)
-	params.Set("password", c.password)
+	if c.apiKey != "" {
+		params.Set("key", c.apiKey)
+		params.Set("gekkoid", c.gekkoID)
+	} else {
+		params.Set("password", c.password)
+	}
 
 	for key, values := range extraParams {
 		for _, v := range values {
@@ -63,39 +261,75 @@ func (c *MyGekkoClient) buildURL(endpoint string, extraParams url.Values) string
 }
 
 func (c *MyGekkoClient) Get(endpoint string) (map[string]any, error) {
-	resp, err := c.httpClient.Get(c.buildURL(endpoint, nil))
+	return c.GetContext(context.Background(), endpoint)
+}
+
+// GetContext is like Get, but aborts the request when ctx is done.
+func (c *MyGekkoClient) GetContext(ctx context.Context, endpoint string) (map[string]any, error) {
+	var result map[string]any
+	if err := c.getJSON(ctx, endpoint, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// getJSON requests an endpoint and decodes the JSON response into result.
+func (c *MyGekkoClient) getJSON(ctx context.Context, endpoint string, result any) error {
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.buildURL(endpoint, nil), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return fmt.Errorf("HTTP request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP status %d", resp.StatusCode)
+		return c.statusError(resp)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return fmt.Errorf("failed to read response: %w", err)
 	}
 
-	var result map[string]any
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("failed to parse JSON: %w", err)
 	}
+	return nil
+}
 
-	return result, nil
+// retryStartup calls fn up to attempts times, waiting interval between
+// failed tries, so a controller that is still booting does not stop the
+// bridge from starting. It returns the last error.
+func retryStartup(attempts int, interval time.Duration, what string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts {
+			return err
+		}
+		slog.Warn("MyGEKKO not reachable at startup, retrying", "request", what,
+			"attempt", attempt, "attempts", attempts, "delay", interval, "error", err)
+		time.Sleep(interval)
+	}
 }
 
-func (c *MyGekkoClient) GetStatus(categories []string) (map[string]any, error) {
+// GetStatus fetches the status of the given categories, or of all categories
+// if none are given. The requests are aborted when ctx is done.
+func (c *MyGekkoClient) GetStatus(ctx context.Context, categories []string) (map[string]any, error) {
 	if len(categories) == 0 {
-		return c.Get("var/status")
+		return c.GetContext(ctx, "var/status")
 	}
 
 	// Query each category individually and merge results
 	result := make(map[string]any)
 	for _, cat := range categories {
 		endpoint := fmt.Sprintf("var/%s/status", cat)
-		catResult, err := c.Get(endpoint)
+		catResult, err := c.GetContext(ctx, endpoint)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get %s: %w", cat, err)
 		}
@@ -105,12 +339,28 @@ func (c *MyGekkoClient) GetStatus(categories []string) (map[string]any, error) {
 	return result, nil
 }
 
-func (c *MyGekkoClient) SetValue(category, item, value string) error {
-	endpoint := fmt.Sprintf("var/%s/%s/scmd/set", category, item)
+// SetValue sends a set command for an item. The request is aborted when ctx
+// is done.
+func (c *MyGekkoClient) SetValue(ctx context.Context, category, item, value string) error {
+	return c.SendCommand(ctx, category, item, "set", value)
+}
+
+// SendCommand sends an scmd command of an item: set, or another verb the
+// element accepts (e.g. stop), with value as its parameter. The request is
+// aborted when ctx is done.
+func (c *MyGekkoClient) SendCommand(ctx context.Context, category, item, command, value string) error {
+	endpoint := fmt.Sprintf("var/%s/%s/scmd/%s", category, item, command)
 	params := url.Values{}
 	params.Set("value", value)
 
-	resp, err := c.httpClient.Get(c.buildURL(endpoint, params))
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.buildURL(endpoint, params), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("HTTP request failed: %w", err)
 	}
@@ -121,10 +371,10 @@ func (c *MyGekkoClient) SetValue(category, item, value string) error {
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 	bodyStr := strings.TrimSpace(string(body))
-	slog.Debug("SetValue response", "category", category, "item", item, "status", resp.StatusCode, "body", bodyStr)
+	slog.Debug("Command response", "category", category, "item", item, "command", command, "status", resp.StatusCode, "body", bodyStr)
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP status %d: %s", resp.StatusCode, bodyStr)
+		return fmt.Errorf("%w: %s", c.statusError(resp), bodyStr)
 	}
 
 	// MyGEKKO signals success either with the literal "OK" or, depending on
@@ -151,6 +401,22 @@ func (c *MyGekkoClient) GetGekkoName() (string, error) {
 	return value, nil
 }
 
-func (c *MyGekkoClient) GetDefinitions() (map[string]any, error) {
-	return c.Get("var")
+// GetGlobal fetches the status of a global by its path below var/globals,
+// e.g. network/gekkoname. The request is aborted when ctx is done.
+func (c *MyGekkoClient) GetGlobal(ctx context.Context, path string) (map[string]any, error) {
+	return c.GetContext(ctx, fmt.Sprintf("var/globals/%s/status", path))
+}
+
+func (c *MyGekkoClient) GetDefinitions(ctx context.Context) (map[string]any, error) {
+	return c.GetContext(ctx, "var")
+}
+
+// GetAlarms fetches the alarm list at endpoint (alarms_endpoint), an array
+// or an object of alarms depending on the firmware.
+func (c *MyGekkoClient) GetAlarms(ctx context.Context, endpoint string) (any, error) {
+	var result any
+	if err := c.getJSON(ctx, endpoint, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestSetValue_ResponseHandling(t *testing.T) {
@@ -39,7 +47,7 @@ func TestSetValue_ResponseHandling(t *testing.T) {
 				httpClient: srv.Client(),
 			}
 
-			err := c.SetValue("blinds", "item14", "P70")
+			err := c.SetValue(context.Background(), "blinds", "item14", "P70")
 			if tc.wantErr && err == nil {
 				t.Errorf("expected error for body %q (status %d), got nil", tc.body, tc.status)
 			}
@@ -50,11 +58,35 @@ func TestSetValue_ResponseHandling(t *testing.T) {
 	}
 }
 
+func TestMyGekkoClient_CanceledContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/api/v1/")
+	c := &MyGekkoClient{baseURL: base, username: "u", password: "p", httpClient: srv.Client()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if err := c.SetValue(ctx, "blinds", "item14", "P70"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled set command, got %v", err)
+	}
+	if _, err := c.GetStatus(ctx, []string{"blinds"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled status request, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("requests were not aborted promptly (%v)", elapsed)
+	}
+}
+
 func TestNewMyGekkoClient(t *testing.T) {
 	cfg := MyGekkoConfig{
-		Host:     "127.0.0.1",
-		Username: "testuser",
-		Password: "testpass",
+		Host:        "127.0.0.1",
+		Username:    "testuser",
+		Password:    "testpass",
+		HTTPTimeout: 2.5,
 	}
 
 	client, err := NewMyGekkoClient(cfg)
@@ -77,6 +109,54 @@ func TestNewMyGekkoClient(t *testing.T) {
 	if client.password != "testpass" {
 		t.Errorf("expected password 'testpass', got '%s'", client.password)
 	}
+	if client.httpClient.Timeout != 2500*time.Millisecond {
+		t.Errorf("expected HTTP timeout 2.5s, got %s", client.httpClient.Timeout)
+	}
+}
+
+// roundTripFunc is an http.RoundTripper answering requests with a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewMyGekkoClientWithHTTPClient(t *testing.T) {
+	var requested string
+	httpClient := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = req.URL.Path + "?" + req.URL.Query().Get("value")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("OK")),
+			Request:    req,
+		}, nil
+	})}
+
+	client, err := NewMyGekkoClientWithHTTPClient(MyGekkoConfig{
+		Host:     "127.0.0.1",
+		Username: "testuser",
+		Password: "testpass",
+	}, httpClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.httpClient != httpClient {
+		t.Error("expected the given HTTP client to be used")
+	}
+
+	if err := client.SetValue(context.Background(), "blinds", "item0", "P50"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "/api/v1/var/blinds/item0/scmd/set?P50"; requested != want {
+		t.Errorf("expected request %q, got %q", want, requested)
+	}
+
+	if err := client.SendCommand(context.Background(), "blinds", "item0", "stop", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "/api/v1/var/blinds/item0/scmd/stop?"; requested != want {
+		t.Errorf("expected request %q, got %q", want, requested)
+	}
 }
 
 func TestBuildURL_Basic(t *testing.T) {
@@ -218,3 +298,263 @@ func TestBuildURL_ValueWithSpaces(t *testing.T) {
 		t.Errorf("value with space should be URL-encoded: %s", result)
 	}
 }
+
+func TestLoadFieldDefinitions_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Simulate a controller that is stuck producing the definitions
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	base, _ := url.Parse(srv.URL + "/api/v1/")
+	c := &MyGekkoClient{
+		baseURL:    base,
+		username:   "u",
+		password:   "p",
+		httpClient: srv.Client(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := LoadFieldDefinitions(ctx, c)
+	if err == nil {
+		t.Fatal("expected error for slow definitions server")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected load to be aborted promptly, took %s", elapsed)
+	}
+}
+
+func TestNewMyGekkoClient_TLS(t *testing.T) {
+	client, err := NewMyGekkoClient(MyGekkoConfig{
+		Host:     "127.0.0.1",
+		Username: "user",
+		Password: "pass",
+		UseTLS:   true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result := client.buildURL("var/status", nil); !strings.HasPrefix(result, "https://127.0.0.1/api/v1/var/status") {
+		t.Errorf("expected https URL, got %s", result)
+	}
+}
+
+func TestNewHTTPClient_CAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0644); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+
+	// The test certificate is issued for example.com; requests go to the IP
+	httpClient, err := newHTTPClient(MyGekkoConfig{UseTLS: true, TLSCAFile: caFile}, "example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	base, _ := url.Parse(srv.URL + "/api/v1/")
+	c := &MyGekkoClient{baseURL: base, username: "u", password: "p", httpClient: httpClient}
+	if _, err := c.Get("var/status"); err != nil {
+		t.Errorf("expected request verified against CA file to succeed, got %v", err)
+	}
+
+	// Without the CA file the self-signed certificate is rejected
+	httpClient, err = newHTTPClient(MyGekkoConfig{UseTLS: true}, "example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.httpClient = httpClient
+	if _, err := c.Get("var/status"); err == nil {
+		t.Error("expected unverified certificate to be rejected")
+	}
+}
+
+func TestNewMyGekkoClient_ProxyURL(t *testing.T) {
+	// A plain HTTP proxy receives the request for the controller
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer proxy.Close()
+
+	// The controller name only resolves behind the proxy
+	client, err := NewMyGekkoClient(MyGekkoConfig{
+		Host:     "mygekko.invalid",
+		Username: "u",
+		Password: "p",
+		ProxyURL: proxy.URL,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.SetValue(context.Background(), "blinds", "item0", "P50"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(requested, "http://mygekko.invalid/api/v1/var/blinds/item0/scmd/set?") {
+		t.Errorf("expected request for the controller through the proxy, got %q", requested)
+	}
+}
+
+func TestCloudClient(t *testing.T) {
+	var queries []url.Values
+	var times []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		times = append(times, time.Now())
+		if r.URL.Path != "/api/v1/var/globals/network/gekkoname/status" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"value": "MyHome"}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewMyGekkoClient(MyGekkoConfig{
+		Mode:                 "cloud",
+		Username:             "user@example.com",
+		APIKey:               "apikey",
+		GekkoID:              "K999-7UOZ-8ZYZ-6TH3",
+		CloudURL:             srv.URL + "/api/v1/",
+		CloudRequestInterval: 0.05,
+		HTTPTimeout:          5,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for range 2 {
+		if name, err := c.GetGekkoName(); err != nil || name != "MyHome" {
+			t.Fatalf("expected gekko name, got %q, %v", name, err)
+		}
+	}
+
+	q := queries[0]
+	if q.Get("username") != "user@example.com" || q.Get("key") != "apikey" || q.Get("gekkoid") != "K999-7UOZ-8ZYZ-6TH3" || q.Has("password") {
+		t.Errorf("unexpected cloud auth parameters: %v", q)
+	}
+	if gap := times[1].Sub(times[0]); gap < 40*time.Millisecond {
+		t.Errorf("expected requests to be spaced by the request interval, got %v", gap)
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	var times []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		if len(times) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"value": "MyHome"}`))
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL + "/api/v1/")
+	c := &MyGekkoClient{baseURL: u, httpClient: srv.Client(), maxBackoff: 50 * time.Millisecond}
+
+	_, err := c.GetGekkoName()
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) || statusErr.code != http.StatusTooManyRequests || statusErr.permanent() {
+		t.Fatalf("expected a transient 429 error, got %v", err)
+	}
+	if statusErr.retryAfter != 50*time.Millisecond {
+		t.Errorf("expected Retry-After capped by max_backoff, got %v", statusErr.retryAfter)
+	}
+
+	if _, err := c.GetGekkoName(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gap := times[1].Sub(times[0]); gap < 40*time.Millisecond {
+		t.Errorf("expected the next request to wait for Retry-After, got %v", gap)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"30":                            30 * time.Second,
+		"-5":                            0,
+		"soon":                          0,
+		"Wed, 01 May 2024 12:02:00 GMT": 2 * time.Minute,
+		"Wed, 01 May 2024 11:00:00 GMT": 0,
+	}
+	for value, want := range cases {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestGetStatus_Endpoints(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/api/v1/var/status":
+			_, _ = w.Write([]byte(`{"blinds": {"item0": {"sumstate": {"value": "1;50"}}}, "globals": {}}`))
+		default:
+			_, _ = w.Write([]byte(`{"item0": {"sumstate": {"value": "1;50"}}}`))
+		}
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL + "/api/v1/")
+	c := &MyGekkoClient{baseURL: u, httpClient: srv.Client()}
+
+	single, err := c.GetStatus(context.Background(), []string{"blinds"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	all, err := c.GetStatus(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if paths[0] != "/api/v1/var/blinds/status" || paths[1] != "/api/v1/var/status" {
+		t.Errorf("unexpected endpoints %v", paths)
+	}
+	// Both are keyed by category
+	if !reflect.DeepEqual(single["blinds"], all["blinds"]) {
+		t.Errorf("expected the same shape, got %v and %v", single, all)
+	}
+}
+
+func TestRetryStartup(t *testing.T) {
+	calls := 0
+	err := retryStartup(3, time.Millisecond, "gekko name", func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success on the third try, got %v after %d", err, calls)
+	}
+
+	calls = 0
+	err = retryStartup(2, time.Millisecond, "definitions", func() error {
+		calls++
+		return errors.New("connection refused")
+	})
+	if err == nil || calls != 2 {
+		t.Errorf("expected the last error after 2 tries, got %v after %d", err, calls)
+	}
+}
@@ -8,15 +8,20 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func pledge() error {
+func pledge(writeFiles bool) error {
 	// stdio: standard I/O
 	// rpath: read files (/dev/urandom for crypto, /etc/localtime for timezone)
 	// inet: network sockets (MyGEKKO and MQTT)
 	// dns: DNS resolution
 	// unix: unix sockets (MQTT)
-	err := unix.Pledge("stdio rpath inet dns unix", "")
+	promises := "stdio rpath inet dns unix"
+	if writeFiles {
+		// wpath, cpath: write and replace the history file
+		promises += " wpath cpath"
+	}
+	err := unix.Pledge(promises, "")
 	if err == nil {
-		slog.Debug("pledge", "promises", "stdio rpath inet dns unix")
+		slog.Debug("pledge", "promises", promises)
 	}
 	return err
 }
@@ -2,6 +2,6 @@
 
 package main
 
-func pledge() error {
+func pledge(writeFiles bool) error {
 	return nil
 }
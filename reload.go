@@ -0,0 +1,108 @@
+package main
+
+import (
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// pollSettings are the parts of the configuration the getter picks up on a
+// reload, without a restart.
+type pollSettings struct {
+	interval       time.Duration
+	intervalItems  []string
+	mainItems      []string
+	intervalRounds int
+	// categoryIntervals are the categories polled on their own schedule
+	// (category_intervals); they are left out of intervalItems and mainItems
+	categoryIntervals map[string]time.Duration
+	// cfg is the configuration the settings were made from, to discover
+	// main_items again when the definitions are refreshed
+	cfg *Config
+}
+
+func newPollSettings(cfg *Config) pollSettings {
+	s := pollSettings{
+		interval:       time.Duration(cfg.MyGekko.Interval * float64(time.Second)),
+		intervalItems:  cfg.MyGekko.IntervalItems,
+		mainItems:      cfg.MyGekko.MainItems,
+		intervalRounds: cfg.MyGekko.IntervalRounds,
+		cfg:            cfg,
+	}
+	if len(cfg.MyGekko.CategoryIntervals) == 0 {
+		return s
+	}
+
+	s.categoryIntervals = make(map[string]time.Duration, len(cfg.MyGekko.CategoryIntervals))
+	for category, seconds := range cfg.MyGekko.CategoryIntervals {
+		s.categoryIntervals[category] = time.Duration(seconds * float64(time.Second))
+	}
+	own := func(category string) bool {
+		_, ok := s.categoryIntervals[category]
+		return ok
+	}
+	s.intervalItems = slices.DeleteFunc(slices.Clone(s.intervalItems), own)
+	s.mainItems = slices.DeleteFunc(slices.Clone(s.mainItems), own)
+	return s
+}
+
+// allItems returns every category the getter polls.
+func (s pollSettings) allItems() []string {
+	return slices.Concat(s.intervalItems, s.mainItems, slices.Sorted(maps.Keys(s.categoryIntervals)))
+}
+
+// Reload applies the hot-reloadable parts of a freshly loaded and validated
+// configuration: interval, interval_items, main_items, interval_rounds and
+// category_intervals are handed to the getter, which resets its tickers.
+// The log level is applied by the caller. With auto_discover, an empty
+// main_items is filled from the known field definitions as at startup.
+// Changes to any other option are ignored with a warning; they need a
+// restart.
+func (b *Bridge) Reload(cfg *Config) {
+	DiscoverItems(&cfg.MyGekko, b.fieldDefs())
+	if sections := restartRequired(b.cfg, cfg); len(sections) > 0 {
+		slog.Warn("Ignoring configuration changes that need a restart", "sections", sections)
+	}
+
+	// Only the latest settings matter if the getter has not picked up the
+	// previous ones yet
+	select {
+	case <-b.reloadCh:
+	default:
+	}
+	b.reloadCh <- newPollSettings(cfg)
+}
+
+// restartRequired lists the configuration sections whose changes between
+// old and new cannot be applied at runtime.
+func restartRequired(old, new *Config) []string {
+	oldGekko, newGekko := old.MyGekko, new.MyGekko
+	for _, c := range []*MyGekkoConfig{&oldGekko, &newGekko} {
+		c.Interval, c.IntervalItems, c.MainItems, c.IntervalRounds = 0, nil, nil, 0
+		c.CategoryIntervals, c.discovered = nil, false
+		// Compared by name (Timezone)
+		c.location = nil
+	}
+
+	var sections []string
+	for _, s := range []struct {
+		name     string
+		old, new any
+	}{
+		{"log_format", old.LogFormat, new.LogFormat},
+		{"api_addr", old.APIAddr, new.APIAddr},
+		{"mygekko", oldGekko, newGekko},
+		{"mqtt", old.MQTT, new.MQTT},
+		{"sandbox", old.Sandbox, new.Sandbox},
+		{"signals", old.Signals, new.Signals},
+		{"aggregates", old.Aggregates, new.Aggregates},
+		{"homeassistant", old.HomeAssistant, new.HomeAssistant},
+	} {
+		if !reflect.DeepEqual(s.old, s.new) {
+			sections = append(sections, s.name)
+		}
+	}
+	return sections
+}
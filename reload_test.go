@@ -0,0 +1,55 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRestartRequired(t *testing.T) {
+	old := &Config{
+		MyGekko: MyGekkoConfig{Host: "gekko", Interval: 5, IntervalItems: []string{"blinds"}, IntervalRounds: 4},
+		MQTT:    MQTTConfig{URL: "tcp://localhost:1883", Root: "mygekko"},
+	}
+
+	reloadable := *old
+	reloadable.LogLevel = "DEBUG"
+	reloadable.MyGekko.Interval = 1
+	reloadable.MyGekko.IntervalItems = []string{"lights"}
+	reloadable.MyGekko.MainItems = []string{"vents"}
+	reloadable.MyGekko.IntervalRounds = 2
+	if sections := restartRequired(old, &reloadable); len(sections) != 0 {
+		t.Errorf("expected reloadable changes only, got %v", sections)
+	}
+
+	changed := *old
+	changed.MyGekko.Host = "other"
+	changed.MQTT.URL = "tcp://broker:1883"
+	changed.LogFormat = "json"
+	if sections := restartRequired(old, &changed); !slices.Equal(sections, []string{"log_format", "mygekko", "mqtt"}) {
+		t.Errorf("expected log_format, mygekko and mqtt to need a restart, got %v", sections)
+	}
+}
+
+func TestReload_AppliesPollSettings(t *testing.T) {
+	mockGekko := NewMockGekko("TestGekko")
+	cfg := &Config{MyGekko: MyGekkoConfig{Interval: 3600, IntervalItems: []string{"blinds"}, IntervalRounds: 4}}
+	bridge, err := NewBridge(cfg, mockGekko, NewMockMQTT(), map[string][]FieldDef{}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	go bridge.RunGetter()
+	defer bridge.Stop()
+
+	reloaded := *cfg
+	reloaded.MyGekko.Interval = 0.01
+	bridge.Reload(&reloaded)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for bridge.polls.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the reloaded interval to be used, got %d polls", bridge.polls.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -45,7 +45,9 @@ func dropPrivileges(uid, gid int) error {
 	return nil
 }
 
-func sandbox(chrootPath string, uid, gid int) error {
+// sandbox confines the process; writeFiles keeps the permission to create
+// and write files (history_file).
+func sandbox(chrootPath string, uid, gid int, writeFiles bool) error {
 	// Order: chroot, drop privileges, pledge
 	if err := chroot(chrootPath); err != nil {
 		return err
@@ -53,5 +55,5 @@ func sandbox(chrootPath string, uid, gid int) error {
 	if err := dropPrivileges(uid, gid); err != nil {
 		return err
 	}
-	return pledge()
+	return pledge(writeFiles)
 }
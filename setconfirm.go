@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setResult is published to {category}/{item}/set/result after a set command
+// was confirmed or not (confirm_sets), or skipped in a dry run. Command is the
+// scmd verb of a cmd/{verb} command, empty for set.
+type setResult struct {
+	Command   string `json:"command,omitempty"`
+	Value     string `json:"value"`
+	Confirmed bool   `json:"confirmed"`
+	Actual    string `json:"actual,omitempty"`
+	Error     string `json:"error,omitempty"`
+	DryRun    bool   `json:"dry_run,omitempty"`
+}
+
+// publishSetResult publishes the outcome of a set command, not retained: it
+// is an acknowledgement, not state.
+func (b *Bridge) publishSetResult(category, item string, result setResult) {
+	if err := b.publishTransient(fmt.Sprintf("%s/%s/set/result", category, b.itemTopic(category, item)), result); err != nil {
+		slog.Error("Failed to publish set result", "category", category, "item", item, "error", err)
+	}
+}
+
+// confirmSet reads the field a set command wrote back from the controller
+// and publishes whether it took the requested value. The field is read
+// confirm_retries times, evenly spread over confirm_timeout, until it
+// matches.
+func (b *Bridge) confirmSet(category, item, value string) {
+	result := setResult{Value: value}
+	defer func() { b.publishSetResult(category, item, result) }()
+
+	name, want, err := b.setTarget(category, value)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	attempts := max(b.cfg.MyGekko.ConfirmRetries, 1)
+	delay := time.Duration(b.cfg.MyGekko.ConfirmTimeout * float64(time.Second) / float64(attempts))
+	for range attempts {
+		select {
+		case <-time.After(delay):
+		case <-b.ctx.Done():
+			result.Error = b.ctx.Err().Error()
+			return
+		}
+
+		actual, err := b.readField(category, item, name)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		result.Actual, result.Error = actual, ""
+		var known any = actual
+		if f, err := strconv.ParseFloat(actual, 64); err == nil {
+			known = f
+		}
+		if valueMatches(known, want) {
+			result.Confirmed = true
+			slog.Debug("Set command confirmed", "category", category, "item", item, "value", value)
+			return
+		}
+	}
+	slog.Warn("Set command not confirmed", "category", category, "item", item, "value", value, "actual", result.Actual, "error", result.Error)
+}
+
+// readField fetches the current raw value of a field of an item.
+func (b *Bridge) readField(category, item, name string) (string, error) {
+	defs := b.fieldDefs()[category]
+	index := fieldIndex(defs, name)
+	if index == len(defs) {
+		return "", fmt.Errorf("unknown field %s of category %s", name, category)
+	}
+
+	status, err := b.gekko.GetStatus(b.ctx, []string{category})
+	if err != nil {
+		return "", err
+	}
+	catMap, _ := status[category].(map[string]any)
+	itemMap, _ := catMap[item].(map[string]any)
+	sumstate, _ := itemMap["sumstate"].(map[string]any)
+	valueStr, ok := b.sumstateValue(category, sumstate)
+	if !ok {
+		return "", fmt.Errorf("no value for %s/%s", category, item)
+	}
+	values := strings.Split(valueStr, ";")
+	if index >= len(values) {
+		return "", fmt.Errorf("field %s missing in value of %s/%s", name, category, item)
+	}
+	return values[index], nil
+}
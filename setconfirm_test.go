@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestConfirmSet(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{
+		SetPrefixes:    map[string]map[string]string{"blinds": {"P": "position"}},
+		ConfirmTimeout: 0.01,
+		ConfirmRetries: 2,
+	}}
+	mockGekko := NewMockGekko("TestGekko")
+	mockGekko.status = map[string]any{
+		"blinds": map[string]any{"item0": map[string]any{"sumstate": map[string]any{"value": "1;50.0"}}},
+	}
+	mockMQTT := NewMockMQTT()
+	fieldDefs := map[string][]FieldDef{"blinds": {{Name: "state", Type: "int"}, {Name: "position", Type: "float"}}}
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result := func() setResult {
+		t.Helper()
+		for i := len(mockMQTT.jsonPublished) - 1; i >= 0; i-- {
+			if msg := mockMQTT.jsonPublished[i]; msg.Topic == "blinds/item0/set/result" {
+				return msg.Data.(setResult)
+			}
+		}
+		t.Fatal("expected a set result to be published")
+		return setResult{}
+	}
+
+	bridge.confirmSet("blinds", "item0", "P50")
+	if got := result(); !got.Confirmed || got.Actual != "50.0" {
+		t.Errorf("expected confirmed result, got %+v", got)
+	}
+
+	bridge.confirmSet("blinds", "item0", "P75")
+	if got := result(); got.Confirmed || got.Actual != "50.0" {
+		t.Errorf("expected unconfirmed result, got %+v", got)
+	}
+
+	bridge.confirmSet("blinds", "item0", "UP")
+	if got := result(); got.Confirmed || got.Error == "" {
+		t.Errorf("expected error for a command without known field, got %+v", got)
+	}
+}
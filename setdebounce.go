@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// pendingSet is the last set command received for an item within the
+// set_debounce window
+type pendingSet struct {
+	topic   string
+	payload []byte
+}
+
+// debounceSet holds back a set command for set_debounce. Further commands for
+// the same item within that window replace it, so a burst (e.g. a slider
+// dragged in a UI) is sent as its last value once the window, started by the
+// first command, has passed.
+func (b *Bridge) debounceSet(category, item, topic string, payload []byte) {
+	key := category + "/" + item
+
+	b.debounceMu.Lock()
+	defer b.debounceMu.Unlock()
+	if b.debounced == nil {
+		b.debounced = make(map[string]pendingSet)
+	}
+	_, waiting := b.debounced[key]
+	// Copied: paho may reuse the payload buffer after the callback returns
+	b.debounced[key] = pendingSet{topic: topic, payload: slices.Clone(payload)}
+	if waiting {
+		slog.Debug("Debouncing set command", "category", category, "item", item)
+		return
+	}
+
+	time.AfterFunc(b.setDebounce, func() {
+		b.debounceMu.Lock()
+		pending := b.debounced[key]
+		delete(b.debounced, key)
+		b.debounceMu.Unlock()
+
+		if b.ctx.Err() != nil {
+			return
+		}
+		b.queueSet(category, item, pending.topic, pending.payload)
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHandleSetCommand_Debounce(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{SetDebounce: 0.05}}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), NewMockMQTT(), map[string][]FieldDef{
+		"blinds": {{Name: "position", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	payload := []byte("P10")
+	bridge.handleSetCommand("blinds/item0/set", payload)
+	// The payload buffer may be reused after the callback
+	copy(payload, "P99")
+	bridge.handleSetCommand("blinds/item0/set", []byte("P30"))
+	bridge.handleSetCommand("blinds/item0/set", []byte("P50"))
+	bridge.handleSetCommand("blinds/item1/set", []byte("P70"))
+	if got := len(bridge.cmdQueue); got != 0 {
+		t.Fatalf("expected commands held back during the window, got %d queued", got)
+	}
+
+	got := map[string]string{}
+	deadline := time.After(2 * time.Second)
+	for len(got) < 2 {
+		select {
+		case cmd := <-bridge.cmdQueue:
+			got[cmd.topic] = string(cmd.payload)
+		case <-deadline:
+			t.Fatalf("expected one command per item after the window, got %v", got)
+		}
+	}
+	if got["blinds/item0/set"] != "P50" || got["blinds/item1/set"] != "P70" {
+		t.Errorf("expected the last value per item, got %v", got)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := len(bridge.cmdQueue); n != 0 {
+		t.Errorf("expected no further commands, got %d", n)
+	}
+}
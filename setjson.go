@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// expandSetJSON turns a JSON object set payload ({"position": 50, "angle":
+// 20}) into one command value per key. A key names a field of the category:
+// the set_fields field is sent as the plain value, a field listed in
+// set_prefixes with its prefix (blinds position 50 -> "P50"). Enum labels are
+// translated to their index; a color may be given as {"r": .., "g": .., "b":
+// ..}. The commands are ordered like the fields in the definitions; MyGEKKO
+// takes one value per request, so they are sent one after the other, not
+// atomically.
+//
+// ok is false if the payload is not a JSON object, which is then sent as is.
+func (b *Bridge) expandSetJSON(category string, payload []byte) (values []string, ok bool, err error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(payload), []byte("{")) {
+		return nil, false, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, false, nil
+	}
+
+	prefixes := make(map[string]string)
+	if field, ok := b.cfg.MyGekko.SetFields[category]; ok {
+		prefixes[field] = ""
+	}
+	for prefix, field := range b.cfg.MyGekko.SetPrefixes[category] {
+		prefixes[field] = prefix
+	}
+
+	defs := b.fieldDefs()[category]
+	names := slices.Sorted(maps.Keys(fields))
+	slices.SortStableFunc(names, func(a, b string) int {
+		return fieldIndex(defs, a) - fieldIndex(defs, b)
+	})
+
+	for _, name := range names {
+		prefix, ok := prefixes[name]
+		if !ok {
+			return nil, true, fmt.Errorf("field %s of category %s cannot be set", name, category)
+		}
+		i := fieldIndex(defs, name)
+		if i < len(defs) && defs[i].Type == "color" {
+			value, err := colorJSONValue(fields[name])
+			if err != nil {
+				return nil, true, fmt.Errorf("field %s: %w", name, err)
+			}
+			values = append(values, prefix+value)
+			continue
+		}
+		value, err := setValueString(fields[name])
+		if err != nil {
+			return nil, true, fmt.Errorf("field %s: %w", name, err)
+		}
+		if i < len(defs) {
+			for index, label := range defs[i].EnumValues {
+				if strings.EqualFold(label, value) {
+					value = strconv.Itoa(index)
+					break
+				}
+			}
+			if bit, ok := boolBit(value); ok && defs[i].Type == "bool" {
+				value = bit
+			}
+		}
+		values = append(values, prefix+value)
+	}
+	return values, true, nil
+}
+
+// fieldIndex returns the position of a field in the definitions, or
+// len(defs) for an unknown field.
+func fieldIndex(defs []FieldDef, name string) int {
+	for i, field := range defs {
+		if field.Name == name {
+			return i
+		}
+	}
+	return len(defs)
+}
+
+// setValueString formats a JSON value as a command value.
+func setValueString(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExpandSetJSON(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{
+		SetFields:   map[string]string{"roomtemps": "mode"},
+		SetPrefixes: map[string]map[string]string{"roomtemps": {"S": "setpoint"}},
+	}}
+	fieldDefs := map[string][]FieldDef{"roomtemps": {
+		{Name: "temperature", Type: "float"},
+		{Name: "setpoint", Type: "float"},
+		{Name: "mode", Type: "int", EnumValues: []string{"off", "comfort", "auto"}},
+	}}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), NewMockMQTT(), fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	values, ok, err := bridge.expandSetJSON("roomtemps", []byte(`{"mode": "auto", "setpoint": 21.5}`))
+	if err != nil || !ok {
+		t.Fatalf("expected JSON payload to be expanded, got ok=%v err=%v", ok, err)
+	}
+	if want := []string{"S21.5", "2"}; !slices.Equal(values, want) {
+		t.Errorf("expected %v, got %v", want, values)
+	}
+
+	if _, ok, _ := bridge.expandSetJSON("roomtemps", []byte("S21.5")); ok {
+		t.Error("expected a plain payload to be sent as is")
+	}
+	if _, _, err := bridge.expandSetJSON("roomtemps", []byte(`{"temperature": 20}`)); err == nil {
+		t.Error("expected error for a field without set command")
+	}
+}
+
+func TestHandleSetCommand_JSONQueuesOneCommandPerField(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{
+		SetFields:   map[string]string{"blinds": "state"},
+		SetPrefixes: map[string]map[string]string{"blinds": {"P": "position"}},
+	}}
+	fieldDefs := map[string][]FieldDef{"blinds": {{Name: "state", Type: "int"}, {Name: "position", Type: "int"}}}
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), NewMockMQTT(), fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bridge.handleSetCommand("blinds/item0/set", []byte(`{"position": 50, "state": 1}`))
+
+	var got []string
+	for len(bridge.cmdQueue) > 0 {
+		got = append(got, string((<-bridge.cmdQueue).payload))
+	}
+	if want := []string{"1", "P50"}; !slices.Equal(got, want) {
+		t.Errorf("expected commands %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// checkValue checks a set command value against the type and constraints of
+// the field it writes.
+func (f FieldDef) checkValue(value string) error {
+	var n float64
+	switch f.Type {
+	case "int":
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		n = float64(i)
+		if len(f.EnumValues) > 0 && (i < 0 || i >= int64(len(f.EnumValues))) {
+			return fmt.Errorf("%d is not one of the %d enum values of %s", i, len(f.EnumValues), f.Name)
+		}
+	case "float":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		n = v
+	case "bool":
+		if value != "0" && value != "1" {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		return nil
+	case "color":
+		if _, err := parseColor(value); err != nil {
+			return fmt.Errorf("%q is not a packed RGB color", value)
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	if f.HasRange && (n < f.Min || n > f.Max) {
+		return fmt.Errorf("%s is out of range [%g, %g] of %s", value, f.Min, f.Max, f.Name)
+	}
+	if len(f.Allowed) > 0 && !slices.ContainsFunc(f.Allowed, func(a string) bool {
+		v, _ := strconv.ParseFloat(a, 64)
+		return v == n
+	}) {
+		return fmt.Errorf("%s is not one of %s of %s", value, strings.Join(f.Allowed, ","), f.Name)
+	}
+	return nil
+}
+
+// writable reports whether set commands for an item are allowed by
+// writable_categories and writable_items.
+func (b *Bridge) writable(category, item string) bool {
+	cfg := &b.cfg.MyGekko
+	if len(cfg.WritableCategories) == 0 && len(cfg.WritableItems) == 0 {
+		return true
+	}
+	return slices.Contains(cfg.WritableCategories, category) || slices.Contains(cfg.WritableItems, category+"/"+item)
+}
+
+// setTarget returns the field a set command value writes and the value
+// without its prefix: the field of the longest matching set_prefixes entry
+// (e.g. blinds "P50" -> position, "50"), or else the category's set_fields
+// field.
+func (b *Bridge) setTarget(category, value string) (name, rest string, err error) {
+	matched := ""
+	for prefix, field := range b.cfg.MyGekko.SetPrefixes[category] {
+		if strings.HasPrefix(value, prefix) && len(prefix) > len(matched) {
+			name, matched = field, prefix
+		}
+	}
+	if name != "" {
+		return name, value[len(matched):], nil
+	}
+	field, ok := b.cfg.MyGekko.SetFields[category]
+	if !ok {
+		return "", "", fmt.Errorf("no set field defined for category %s", category)
+	}
+	return field, value, nil
+}
+
+// validateSet checks a set command value against the field definition it
+// writes (see setTarget). Values that match no known field are rejected.
+func (b *Bridge) validateSet(category, value string) error {
+	name, rest, err := b.setTarget(category, value)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range b.fieldDefs()[category] {
+		if field.Name == name {
+			return field.checkValue(rest)
+		}
+	}
+	return fmt.Errorf("unknown field %s of category %s", name, category)
+}
+
+// publishSetError reports a rejected set command on {category}/{item}/set_error,
+// if publish_set_errors is enabled.
+func (b *Bridge) publishSetError(category, item string, reason error) {
+	if !b.cfg.MyGekko.PublishSetErrors {
+		return
+	}
+	topic := fmt.Sprintf("%s/%s/set_error", category, b.itemTopic(category, item))
+	if err := b.publish(topic, reason.Error()); err != nil {
+		slog.Error("Failed to publish", "topic", topic, "error", err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+func TestParseFormatField_Constraints(t *testing.T) {
+	field, err := parseFormatField("position float[0.0:100.0](unit:%)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !field.HasRange || field.Min != 0 || field.Max != 100 {
+		t.Errorf("expected range [0, 100], got %+v", field)
+	}
+
+	field, err = parseFormatField("state int[0,1,2]")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(field.Allowed) != 3 || field.HasRange {
+		t.Errorf("expected allowed values 0,1,2, got %+v", field)
+	}
+
+	field, err = parseFormatField("mode enum[off,on,auto]")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if field.HasRange || field.Allowed != nil {
+		t.Errorf("expected enum labels not to be taken as constraints, got %+v", field)
+	}
+}
+
+func TestValidateSet(t *testing.T) {
+	cfg := &Config{
+		MyGekko: MyGekkoConfig{
+			ValidateSets:     true,
+			PublishSetErrors: true,
+			SetFields:        map[string]string{"blinds": "state", "lights": "state"},
+			SetPrefixes:      map[string]map[string]string{"blinds": {"P": "position"}},
+		},
+	}
+	mockMQTT := NewMockMQTT()
+	mockGekko := NewMockGekko("TestGekko")
+	var sent []string
+	mockGekko.setValue = func(category, item, value string) error {
+		sent = append(sent, category+"="+value)
+		return nil
+	}
+	fieldDefs := map[string][]FieldDef{
+		"blinds": {
+			{Name: "state", Type: "int", Allowed: []string{"-2", "-1", "0", "1", "2"}},
+			{Name: "position", Type: "float", Min: 0, Max: 100, HasRange: true},
+		},
+		"lights": {{Name: "brightness", Type: "int"}},
+		"vents":  {{Name: "level", Type: "int"}},
+	}
+	bridge, err := NewBridge(cfg, mockGekko, mockMQTT, fieldDefs, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	accepted := []string{"P50", "P0", "P100", "-1", "2"}
+	for _, v := range accepted {
+		bridge.processSetCommand("blinds/item0/set", []byte(v))
+	}
+	rejected := []string{"P9999", "P-5", "Pabc", "3", "UP"}
+	for _, v := range rejected {
+		bridge.processSetCommand("blinds/item0/set", []byte(v))
+	}
+	// lights has a set field that is not defined, vents has none at all
+	bridge.processSetCommand("lights/item0/set", []byte("1"))
+	bridge.processSetCommand("vents/item0/set", []byte("1"))
+
+	if len(sent) != len(accepted) {
+		t.Errorf("expected only the %d valid commands to be sent, got %v", len(accepted), sent)
+	}
+	if value, ok := lastPublished(mockMQTT, "blinds/item0/set_error"); !ok || value == "" {
+		t.Error("expected rejection reason on blinds/item0/set_error")
+	}
+	if got := bridge.failures.Load(); got != uint64(len(rejected)+2) {
+		t.Errorf("expected %d failures, got %d", len(rejected)+2, got)
+	}
+}
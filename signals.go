@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// signalAction is what the bridge does when it receives a signal
+type signalAction string
+
+const (
+	actionShutdown       signalAction = "shutdown"
+	actionReload         signalAction = "reload"
+	actionDumpStats      signalAction = "dump-stats"
+	actionToggleLogLevel signalAction = "toggle-log-level"
+	actionIgnore         signalAction = "ignore"
+)
+
+var signalActionNames = []signalAction{
+	actionShutdown,
+	actionReload,
+	actionDumpStats,
+	actionToggleLogLevel,
+	actionIgnore,
+}
+
+// signalActions builds the signal dispatch table: the platform defaults (see
+// defaultSignalActions) with the configured [signals] entries applied on top.
+// Signal names are case-insensitive and may omit the "SIG" prefix; a signal
+// mapped to "ignore" is dropped from the table.
+func signalActions(overrides map[string]string) (map[os.Signal]signalAction, error) {
+	actions := make(map[os.Signal]signalAction)
+	for name, action := range defaultSignalActions {
+		actions[signalsByName[name]] = action
+	}
+
+	for name, value := range overrides {
+		sigName := strings.ToUpper(name)
+		if !strings.HasPrefix(sigName, "SIG") {
+			sigName = "SIG" + sigName
+		}
+		sig, ok := signalsByName[sigName]
+		if !ok {
+			return nil, fmt.Errorf("signals.%s: unsupported signal", name)
+		}
+		action := signalAction(strings.ToLower(value))
+		if !slices.Contains(signalActionNames, action) {
+			return nil, fmt.Errorf("signals.%s: unknown action %q", name, value)
+		}
+		if action == actionIgnore {
+			delete(actions, sig)
+			continue
+		}
+		actions[sig] = action
+	}
+
+	if !slices.Contains(slices.Collect(maps.Values(actions)), actionShutdown) {
+		return nil, fmt.Errorf("signals: at least one signal must trigger %q", actionShutdown)
+	}
+	return actions, nil
+}
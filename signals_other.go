@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var signalsByName = map[string]os.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+var defaultSignalActions = map[string]signalAction{
+	"SIGINT":  actionShutdown,
+	"SIGTERM": actionShutdown,
+}
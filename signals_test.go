@@ -0,0 +1,72 @@
+//go:build unix
+
+package main
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestSignalActions_Defaults(t *testing.T) {
+	actions, err := signalActions(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[syscall.Signal]signalAction{
+		syscall.SIGINT:  actionShutdown,
+		syscall.SIGTERM: actionShutdown,
+		syscall.SIGHUP:  actionReload,
+		syscall.SIGUSR1: actionDumpStats,
+		syscall.SIGUSR2: actionToggleLogLevel,
+	}
+	if len(actions) != len(want) {
+		t.Errorf("expected %d signals, got %v", len(want), actions)
+	}
+	for sig, action := range want {
+		if actions[sig] != action {
+			t.Errorf("%v: expected %q, got %q", sig, action, actions[sig])
+		}
+	}
+}
+
+func TestSignalActions_Overrides(t *testing.T) {
+	actions, err := signalActions(map[string]string{
+		"SIGHUP":  "reload",
+		"usr1":    "toggle-log-level",
+		"SIGUSR2": "ignore",
+		"SIGQUIT": "Shutdown",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if actions[syscall.SIGHUP] != actionReload {
+		t.Errorf("SIGHUP: expected reload, got %q", actions[syscall.SIGHUP])
+	}
+	if actions[syscall.SIGUSR1] != actionToggleLogLevel {
+		t.Errorf("SIGUSR1: expected toggle-log-level, got %q", actions[syscall.SIGUSR1])
+	}
+	if _, ok := actions[syscall.SIGUSR2]; ok {
+		t.Error("SIGUSR2: expected ignored signal to be removed")
+	}
+	if actions[syscall.SIGQUIT] != actionShutdown {
+		t.Errorf("SIGQUIT: expected shutdown, got %q", actions[syscall.SIGQUIT])
+	}
+	if actions[syscall.SIGTERM] != actionShutdown {
+		t.Errorf("SIGTERM: expected default shutdown, got %q", actions[syscall.SIGTERM])
+	}
+}
+
+func TestSignalActions_Invalid(t *testing.T) {
+	cases := map[string]map[string]string{
+		"unknown signal": {"SIGFOO": "shutdown"},
+		"unknown action": {"SIGUSR1": "explode"},
+		"no shutdown":    {"SIGINT": "ignore", "SIGTERM": "dump-stats"},
+	}
+	for name, overrides := range cases {
+		if _, err := signalActions(overrides); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
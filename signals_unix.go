@@ -0,0 +1,25 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var signalsByName = map[string]os.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+var defaultSignalActions = map[string]signalAction{
+	"SIGINT":  actionShutdown,
+	"SIGTERM": actionShutdown,
+	"SIGHUP":  actionReload,
+	"SIGUSR1": actionDumpStats,
+	"SIGUSR2": actionToggleLogLevel,
+}
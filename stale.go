@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// checkStale publishes, retained, to {category}/{item}/stale whether no field
+// of a polled item changed within stale_after. Unchanged values are
+// deduplicated, so without it a frozen sensor looks like a steady one. The
+// state is published once per item and again when it flips.
+func (b *Bridge) checkStale(category string, seen map[string]bool) {
+	if b.staleAfter <= 0 || b.quietStart {
+		return
+	}
+
+	now := b.clock()
+	for item, changed := range b.lastChanges(category) {
+		if !seen[item] {
+			continue
+		}
+		key := category + "/" + item
+		stale := now.Sub(changed) >= b.staleAfter
+		if reported, ok := b.stale[key]; ok && reported == stale {
+			continue
+		}
+		if stale {
+			slog.Warn("Item values stale", "category", category, "item", item, "last_change", changed)
+		} else if b.stale[key] {
+			slog.Info("Item values changing again", "category", category, "item", item)
+		}
+
+		topic := fmt.Sprintf("%s/%s/stale", category, b.itemTopic(category, item))
+		if err := b.publish(topic, stale); err != nil {
+			slog.Error("Failed to publish", "topic", topic, "error", err)
+			continue
+		}
+		b.stale[key] = stale
+	}
+}
+
+// lastChanges returns per item of a category the last time one of its fields
+// changed.
+func (b *Bridge) lastChanges(category string) map[string]time.Time {
+	prefix := category + "/"
+
+	b.historyMu.RLock()
+	defer b.historyMu.RUnlock()
+
+	changes := make(map[string]time.Time)
+	for histKey, entry := range b.history {
+		rest, ok := strings.CutPrefix(histKey, prefix)
+		if !ok {
+			continue
+		}
+		item, _, _ := strings.Cut(rest, "/")
+		if entry.changed.After(changes[item]) {
+			changes[item] = entry.changed
+		}
+	}
+	return changes
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckStale(t *testing.T) {
+	cfg := &Config{MyGekko: MyGekkoConfig{StaleAfter: 60}}
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(cfg, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{
+		"roomtemps": {{Name: "temperature", Type: "float"}, {Name: "setpoint", Type: "float"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+	seen := map[string]bool{"item0": true}
+	staleState := func() any {
+		t.Helper()
+		got, _ := lastPublished(mockMQTT, "roomtemps/item0/stale")
+		return got
+	}
+
+	bridge.processItem("roomtemps", "item0", map[string]any{"value": "21.5;20.0"})
+	bridge.checkStale("roomtemps", seen)
+	if got := staleState(); got != false {
+		t.Fatalf("expected stale false after the first poll, got %v", got)
+	}
+
+	// An unchanged value, even when republished, does not count as a change
+	bridge.backdateChanges(2 * time.Minute)
+	bridge.processItem("roomtemps", "item0", map[string]any{"value": "21.5;20.0"})
+	bridge.checkStale("roomtemps", seen)
+	if got := staleState(); got != true {
+		t.Fatalf("expected stale true without changes, got %v", got)
+	}
+	published := len(mockMQTT.published)
+	bridge.checkStale("roomtemps", seen)
+	if len(mockMQTT.published) != published {
+		t.Error("expected the stale state to be published only when it flips")
+	}
+
+	bridge.processItem("roomtemps", "item0", map[string]any{"value": "21.5;20.5"})
+	bridge.checkStale("roomtemps", seen)
+	if got := staleState(); got != false {
+		t.Errorf("expected stale false after a change of any field, got %v", got)
+	}
+}
+
+// backdateChanges moves the change time of every history entry into the past
+func (b *Bridge) backdateChanges(d time.Duration) {
+	b.historyMu.Lock()
+	defer b.historyMu.Unlock()
+	for histKey, entry := range b.history {
+		entry.changed = entry.changed.Add(-d)
+		b.history[histKey] = entry
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBroker is a minimal in-process MQTT 3.1.1 and 5 broker, to test
+// MQTTClient and MQTT5Client against the real paho clients and their token
+// handling. It acknowledges QoS 1 and 2 publishes, keeps retained messages,
+// forwards publishes to matching subscriptions at QoS 0 and publishes the
+// will of a client that drops without DISCONNECT. MQTT 5 properties are
+// skipped, except the message expiry interval of a publish.
+type testBroker struct {
+	ln net.Listener
+
+	mu         sync.Mutex
+	sessions   map[*brokerSession]bool
+	retained   map[string][]byte
+	received   []brokerMessage
+	subscribed []string
+	wg         sync.WaitGroup
+}
+
+// brokerMessage is a publish as received by the broker
+type brokerMessage struct {
+	topic   string
+	payload string
+	qos     byte
+	retain  bool
+	// expiry is the message expiry interval of an MQTT 5 publish (0: none)
+	expiry uint32
+}
+
+type brokerSession struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	subs    []string
+	will    *brokerMessage
+	// v5 is set for an MQTT 5 client
+	v5 bool
+}
+
+// newTestBroker starts a broker on addr ("127.0.0.1:0" for any free port)
+// that is closed when the test ends.
+func newTestBroker(t *testing.T, addr string) *testBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	b := &testBroker{ln: ln, sessions: make(map[*brokerSession]bool), retained: make(map[string][]byte)}
+	b.wg.Add(1)
+	go b.serve()
+	t.Cleanup(b.Close)
+	return b
+}
+
+// URL returns the broker URL to connect to.
+func (b *testBroker) URL() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+// Close stops the broker and drops all clients.
+func (b *testBroker) Close() {
+	b.ln.Close()
+	b.dropClients()
+	b.wg.Wait()
+}
+
+// dropClients closes every client connection as if the network failed.
+func (b *testBroker) dropClients() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+}
+
+// messages returns the publishes received for a topic, oldest first.
+func (b *testBroker) messages(topic string) []brokerMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var msgs []brokerMessage
+	for _, msg := range b.received {
+		if msg.topic == topic {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// retainedPayload returns the retained payload of a topic.
+func (b *testBroker) retainedPayload(topic string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	payload, ok := b.retained[topic]
+	return string(payload), ok
+}
+
+// subscriptions returns every topic filter subscribed so far, including
+// repeated subscriptions.
+func (b *testBroker) subscriptions() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.subscribed...)
+}
+
+// inject publishes a message to the subscribed clients, as another client
+// would.
+func (b *testBroker) inject(topic, payload string) {
+	b.route(brokerMessage{topic: topic, payload: payload})
+}
+
+func (b *testBroker) serve() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		s := &brokerSession{conn: conn}
+		b.mu.Lock()
+		b.sessions[s] = true
+		b.mu.Unlock()
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.handle(s)
+		}()
+	}
+}
+
+// handle serves a client connection until it is closed.
+func (b *testBroker) handle(s *brokerSession) {
+	defer func() {
+		s.conn.Close()
+		b.mu.Lock()
+		delete(b.sessions, s)
+		b.mu.Unlock()
+		if s.will != nil {
+			b.publish(*s.will)
+		}
+	}()
+
+	r := bufio.NewReader(s.conn)
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch header >> 4 {
+		case 1: // CONNECT
+			will, v5, err := parseConnect(body)
+			if err != nil {
+				return
+			}
+			s.will, s.v5 = will, v5
+			if s.v5 {
+				s.write(0x20, []byte{0, 0, 0})
+			} else {
+				s.write(0x20, []byte{0, 0})
+			}
+		case 3: // PUBLISH
+			msg := brokerMessage{qos: header >> 1 & 3, retain: header&1 == 1}
+			topic, rest := readString(body)
+			msg.topic = topic
+			var id []byte
+			if msg.qos > 0 {
+				if len(rest) < 2 {
+					return
+				}
+				id, rest = rest[:2], rest[2:]
+			}
+			if s.v5 {
+				var props []byte
+				if props, rest = readProperties(rest); props == nil {
+					return
+				}
+				msg.expiry = messageExpiry(props)
+			}
+			msg.payload = string(rest)
+			b.publish(msg)
+			switch msg.qos {
+			case 1:
+				s.write(0x40, id)
+			case 2:
+				s.write(0x50, id)
+			}
+		case 6: // PUBREL
+			if len(body) < 2 {
+				return
+			}
+			s.write(0x70, body[:2])
+		case 8: // SUBSCRIBE
+			if len(body) < 2 {
+				return
+			}
+			id, rest := append([]byte(nil), body[:2]...), body[2:]
+			if s.v5 {
+				if _, rest = readProperties(rest); rest == nil {
+					return
+				}
+				// Reason codes follow the (empty) SUBACK properties
+				id = append(id, 0)
+			}
+			granted := []byte{}
+			var filters []string
+			for len(rest) > 0 {
+				var filter string
+				filter, rest = readString(rest)
+				if len(rest) == 0 {
+					return
+				}
+				// The QoS; MQTT 5 adds further options to the same byte
+				granted = append(granted, rest[0]&3)
+				rest = rest[1:]
+				filters = append(filters, filter)
+			}
+			b.mu.Lock()
+			s.subs = append(s.subs, filters...)
+			b.subscribed = append(b.subscribed, filters...)
+			var retained []brokerMessage
+			for topic, payload := range b.retained {
+				for _, filter := range filters {
+					if topicMatches(filter, topic) {
+						retained = append(retained, brokerMessage{topic: topic, payload: string(payload), retain: true})
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+			s.write(0x90, append(id, granted...))
+			for _, msg := range retained {
+				s.deliver(msg)
+			}
+		case 10: // UNSUBSCRIBE
+			if len(body) < 2 {
+				return
+			}
+			id, rest := append([]byte(nil), body[:2]...), body[2:]
+			if s.v5 {
+				if _, rest = readProperties(rest); rest == nil {
+					return
+				}
+				id = append(id, 0)
+			}
+			b.mu.Lock()
+			for len(rest) > 0 {
+				var filter string
+				filter, rest = readString(rest)
+				if s.v5 {
+					// One success reason code per filter
+					id = append(id, 0)
+				}
+				for i, sub := range s.subs {
+					if sub == filter {
+						s.subs = append(s.subs[:i], s.subs[i+1:]...)
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+			s.write(0xB0, id)
+		case 12: // PINGREQ
+			s.write(0xD0, nil)
+		case 14: // DISCONNECT
+			s.will = nil
+			return
+		}
+	}
+}
+
+// publish records a received publish, updates the retained messages and
+// forwards it to the subscribers.
+func (b *testBroker) publish(msg brokerMessage) {
+	b.mu.Lock()
+	b.received = append(b.received, msg)
+	if msg.retain {
+		if msg.payload == "" {
+			delete(b.retained, msg.topic)
+		} else {
+			b.retained[msg.topic] = []byte(msg.payload)
+		}
+	}
+	b.mu.Unlock()
+	b.route(brokerMessage{topic: msg.topic, payload: msg.payload})
+}
+
+func (b *testBroker) route(msg brokerMessage) {
+	b.mu.Lock()
+	var targets []*brokerSession
+	for s := range b.sessions {
+		for _, filter := range s.subs {
+			if topicMatches(filter, msg.topic) {
+				targets = append(targets, s)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+	for _, s := range targets {
+		s.deliver(msg)
+	}
+}
+
+// deliver sends a message to the client at QoS 0.
+func (s *brokerSession) deliver(msg brokerMessage) {
+	header := byte(0x30)
+	if msg.retain {
+		header |= 1
+	}
+	body := encodeString(msg.topic)
+	if s.v5 {
+		body = append(body, 0) // no properties
+	}
+	s.write(header, append(body, msg.payload...))
+}
+
+func (s *brokerSession) write(header byte, body []byte) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	packet := []byte{header}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if n == 0 {
+			break
+		}
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	s.conn.Write(append(packet, body...))
+}
+
+// readPacket reads the fixed header and the body of a control packet.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, shift := 0, 0
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(digit&0x7F) << shift
+		if digit&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// parseConnect reads the will of a CONNECT packet, nil if it has none, and
+// whether the client speaks MQTT 5.
+func parseConnect(body []byte) (*brokerMessage, bool, error) {
+	protocol, rest := readString(body)
+	if protocol != "MQTT" && protocol != "MQIsdp" || len(rest) < 4 {
+		return nil, false, fmt.Errorf("unsupported protocol %q", protocol)
+	}
+	v5 := rest[0] == 5
+	flags := rest[1]
+	rest = rest[4:]
+	if v5 {
+		if _, rest = readProperties(rest); rest == nil {
+			return nil, false, errors.New("malformed CONNECT properties")
+		}
+	}
+	_, rest = readString(rest) // client ID
+	if flags&0x04 == 0 {
+		return nil, v5, nil
+	}
+	if v5 {
+		if _, rest = readProperties(rest); rest == nil {
+			return nil, false, errors.New("malformed will properties")
+		}
+	}
+	will := &brokerMessage{qos: flags >> 3 & 3, retain: flags&0x20 != 0}
+	will.topic, rest = readString(rest)
+	will.payload, _ = readString(rest)
+	return will, v5, nil
+}
+
+// readProperties splits the MQTT 5 properties off data. Both are nil if
+// they are malformed; rest is empty, not nil, if nothing follows them.
+func readProperties(data []byte) (props, rest []byte) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return nil, nil
+	}
+	end := n + int(length)
+	return data[n:end:end], data[end:]
+}
+
+// messageExpiry returns the message expiry interval of publish properties,
+// 0 if it is missing.
+func messageExpiry(props []byte) uint32 {
+	for len(props) > 0 {
+		id := props[0]
+		props = props[1:]
+		var size int
+		switch id {
+		case 0x01: // payload format indicator
+			size = 1
+		case 0x02: // message expiry interval
+			if len(props) < 4 {
+				return 0
+			}
+			return binary.BigEndian.Uint32(props)
+		case 0x23: // topic alias
+			size = 2
+		case 0x03, 0x08, 0x09: // content type, response topic, correlation data
+			if len(props) < 2 {
+				return 0
+			}
+			size = 2 + int(binary.BigEndian.Uint16(props))
+		case 0x26: // user property
+			_, rest := readString(props)
+			_, rest = readString(rest)
+			size = len(props) - len(rest)
+		case 0x0B: // subscription identifier
+			_, n := binary.Uvarint(props)
+			size = max(n, 0)
+		default:
+			return 0
+		}
+		if size == 0 || size > len(props) {
+			return 0
+		}
+		props = props[size:]
+	}
+	return 0
+}
+
+func readString(data []byte) (string, []byte) {
+	if len(data) < 2 {
+		return "", nil
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+n {
+		return "", nil
+	}
+	return string(data[2 : 2+n]), data[2+n:]
+}
+
+func encodeString(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+// eventually fails the test if cond does not become true within 5 seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
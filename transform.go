@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Transformer decodes the raw string of a field that the generic parsing,
+// scaling and enums cannot express. It returns the value and true if it
+// handles the field, or false to leave it to the default type conversion.
+// The value must be an int64, float64, string or bool (an int is converted
+// to int64); it is then scaled, labelled and published like a parsed one.
+type Transformer func(category, item, field string, raw string) (any, bool)
+
+// transformers are the transformers registered with RegisterTransformer.
+var transformers []Transformer
+
+// RegisterTransformer adds a transformer for every bridge created afterwards.
+// Call it at startup, before the bridge is created, e.g. from an init
+// function in a file of your own. Transformers are consulted in the order
+// they were registered; the first that handles a field wins.
+func RegisterTransformer(t Transformer) {
+	transformers = append(transformers, t)
+}
+
+// transform consults the transformers of the bridge for a field value. A
+// value of an unsupported type is logged and ignored, as if no transformer
+// handled the field.
+func (b *Bridge) transform(category, item, field, raw string) (any, bool) {
+	for _, t := range b.transformers {
+		value, ok := t(category, item, field, raw)
+		if !ok {
+			continue
+		}
+		switch v := value.(type) {
+		case int:
+			return int64(v), true
+		case int64, float64, string, bool:
+			return v, true
+		default:
+			slog.Warn("Ignoring transformed value of unsupported type", "category", category, "item", item, "field", field, "type", fmt.Sprintf("%T", value))
+			return nil, false
+		}
+	}
+	return nil, false
+}
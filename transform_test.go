@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestProcessItem_Transformer(t *testing.T) {
+	mockMQTT := NewMockMQTT()
+	bridge, err := NewBridge(&Config{}, NewMockGekko("TestGekko"), mockMQTT, map[string][]FieldDef{
+		"meteo": {{Name: "wind", Type: "float"}, {Name: "state", Type: "int"}},
+	}, "TestGekko")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer bridge.Stop()
+
+	bridge.transformers = []Transformer{
+		// Wind speed in tenths of km/h, hex encoded
+		func(category, item, field, raw string) (any, bool) {
+			if category != "meteo" || field != "wind" {
+				return nil, false
+			}
+			n, err := strconv.ParseInt(strings.TrimPrefix(raw, "0x"), 16, 64)
+			if err != nil {
+				return nil, false
+			}
+			return float64(n) / 10, true
+		},
+		// An unsupported type is ignored
+		func(category, item, field, raw string) (any, bool) {
+			return []string{raw}, field == "state"
+		},
+	}
+
+	bridge.processItem("meteo", "item0", map[string]any{"value": "0x7b;3"})
+	if v, _ := lastPublished(mockMQTT, "meteo/item0/get/wind"); v != 12.3 {
+		t.Errorf("expected the transformed wind 12.3, got %v", v)
+	}
+	if v, _ := lastPublished(mockMQTT, "meteo/item0/get/state"); v != int64(3) {
+		t.Errorf("expected the default conversion of state, got %v (%T)", v, v)
+	}
+}
+
+func TestTransform_Int(t *testing.T) {
+	bridge := &Bridge{transformers: []Transformer{
+		func(category, item, field, raw string) (any, bool) { return len(raw), true },
+	}}
+	if v, ok := bridge.transform("lights", "item0", "state", "abc"); !ok || v != int64(3) {
+		t.Errorf("expected an int converted to int64 3, got %v (%T)", v, v)
+	}
+}